@@ -16,3 +16,8 @@ document:
 		$(GODOC) $$c > $$c/README.md ; \
 	done
 
+
+.PHONY: schema
+schema: bin
+	@echo "=== $(PROJECT_NAME) === [ schema           ]: Generating JSON Schema of the config files..."
+	@$(GO_CMD) run ./cmd/flex-schema -output $(BUILD_DIR)/flex-config.schema.json
@@ -0,0 +1,58 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+// flex-schema generates the JSON Schema of flex config files, for editor autocompletion and validation
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/schema"
+)
+
+// defaultSource the go source of the config structs next to this command in the source tree, so the command
+// can run from any directory
+func defaultSource() string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(file), "..", "..", "internal", "load", "load.go")
+}
+
+func main() {
+	source := flag.String("source", defaultSource(), "go source of the config structs, used for the field descriptions")
+	output := flag.String("output", "", "file to write the schema to, defaults to stdout")
+	flag.Parse()
+	if *source == "" {
+		load.Logrus.Fatal("schema: -source is required, the source of the config structs could not be found")
+	}
+
+	comments, err := schema.Comments(*source)
+	if err != nil {
+		load.Logrus.WithError(err).Fatal("schema: failed to read descriptions")
+	}
+
+	out, err := json.MarshalIndent(schema.NewGenerator(comments).Generate(), "", "  ")
+	if err != nil {
+		load.Logrus.WithError(err).Fatal("schema: failed to generate schema")
+	}
+	out = append(out, '\n')
+
+	if *output == "" {
+		_, err = os.Stdout.Write(out)
+	} else {
+		err = ioutil.WriteFile(*output, out, 0644)
+	}
+	if err != nil {
+		load.Logrus.WithError(err).Fatal("schema: failed to write schema")
+	}
+}
@@ -13,7 +13,39 @@ import (
 func main() {
 	runtime.CommonPreInit()
 
+	if load.Args.Validate {
+		err := runtime.RunValidate()
+		if err != nil {
+			load.Logrus.WithError(err).Fatal("flex: invalid configs")
+		}
+		return
+	}
+
+	if load.Args.GoldenFile != "" {
+		err := runtime.RunGolden(runtime.GetTestRuntime())
+		if err != nil {
+			load.Logrus.WithError(err).Fatal("flex: golden test failed")
+		}
+		return
+	}
+
+	if load.Args.ExplainConfig != "" {
+		err := runtime.RunExplain(runtime.GetTestRuntime())
+		if err != nil {
+			load.Logrus.WithError(err).Fatal("flex: failed to explain config")
+		}
+		return
+	}
+
 	i := runtime.GetFlexRuntime()
+	if d, ok := i.(*runtime.Daemon); ok {
+		err := runtime.RunDaemon(d)
+		if err != nil {
+			load.Logrus.WithError(err).Fatal("flex: failed to run daemon")
+		}
+		return
+	}
+
 	err := runtime.RunFlex(i)
 	if err != nil {
 		load.Logrus.WithError(err).Fatal("flex: failed to run runtime")
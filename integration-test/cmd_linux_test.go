@@ -6,6 +6,7 @@
 package integration_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -62,7 +63,7 @@ func TestConfig_cmd_LinuxDirUsage(t *testing.T) {
 	require.Empty(t, errs)
 
 	// when
-	errs = config.RunFiles(&configs)
+	errs = config.RunFiles(context.Background(), &configs)
 	require.Empty(t, errs)
 
 	// 'du' return one line per dir + total UNLESS we use 'summary' flag, then it return 2 lines
@@ -99,7 +100,7 @@ func TestConfig_cmd_LinuxDiskFree(t *testing.T) {
 	require.Empty(t, errs)
 
 	// when
-	errs = config.RunFiles(&configs)
+	errs = config.RunFiles(context.Background(), &configs)
 	require.Empty(t, errs)
 
 	// fs,fsType,usedBytes,availableBytes,usedPerc,mountedOn
@@ -136,7 +137,7 @@ func TestConfig_cmd_OpenFDs(t *testing.T) {
 	require.Empty(t, errs)
 
 	// when
-	errs = config.RunFiles(&configs)
+	errs = config.RunFiles(context.Background(), &configs)
 	require.Empty(t, errs)
 
 	// openFD,maxFD
@@ -1,6 +1,7 @@
 package integration_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/newrelic/infra-integrations-sdk/data/metric"
 	"github.com/newrelic/infra-integrations-sdk/integration"
@@ -80,7 +81,7 @@ func runConfigFile(t *testing.T, configFile string) []*metric.Set {
 	config.LoadFiles(&configs, files, path)
 
 	// and we run the flex integration
-	config.RunFiles(&configs)
+	config.RunFiles(context.Background(), &configs)
 
 	// then we return the metrics generated by the integration
 	return load.Entity.Metrics
@@ -0,0 +1,102 @@
+// AWS signature version 4 signer
+
+package awssigner
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+// Signer service, region and credentials
+type Signer struct {
+	Service     string
+	Region      string
+	Credentials *credentials.Credentials
+}
+
+// now time of the signature
+var now = time.Now
+
+// resolved credentials and region of the signer settings, resolved once so the credentials are only
+// fetched again when they expire
+var resolved = struct {
+	sync.Mutex
+	signers map[string]*Signer
+}{signers: map[string]*Signer{}}
+
+// NewSigner returns the signer of the settings, with the explicit keys when set, otherwise the credentials of the
+// profile or of the default credential chain, the region defaults to the one of the profile or AWS_REGION
+func NewSigner(settings load.AWSSigner) (*Signer, error) {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%s|%s|%s|%s|%s|%s", settings.Service, settings.Region, settings.AccessKey, settings.SecretKey,
+		settings.SessionToken, settings.Profile, settings.RoleARN)
+	key := fmt.Sprintf("%x", h.Sum64())
+
+	resolved.Lock()
+	defer resolved.Unlock()
+	if signer, ok := resolved.signers[key]; ok {
+		return signer, nil
+	}
+
+	config := aws.Config{}
+	if settings.Region != "" {
+		config.Region = aws.String(settings.Region)
+	}
+	if settings.AccessKey != "" {
+		config.Credentials = credentials.NewStaticCredentials(settings.AccessKey, settings.SecretKey, settings.SessionToken)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            config,
+		Profile:           settings.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("awssigner: failed to load aws config: %v", err)
+	}
+
+	signer := &Signer{
+		Service:     settings.Service,
+		Region:      aws.StringValue(sess.Config.Region),
+		Credentials: sess.Config.Credentials,
+	}
+	if signer.Region == "" {
+		return nil, fmt.Errorf("awssigner: no region set for service %s", settings.Service)
+	}
+	if settings.RoleARN != "" {
+		signer.Credentials = stscreds.NewCredentials(sess, settings.RoleARN)
+	}
+	resolved.signers[key] = signer
+	return signer, nil
+}
+
+// Sign sets the Authorization and X-Amz-Date headers on the request, and X-Amz-Security-Token
+// with temporary credentials
+func (s *Signer) Sign(r *http.Request) error {
+	var body io.ReadSeeker
+	if r.Body != nil {
+		payload, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return fmt.Errorf("awssigner: failed to read body: %v", err)
+		}
+		body = bytes.NewReader(payload)
+	}
+	if _, err := v4.NewSigner(s.Credentials).Sign(r, body, s.Service, s.Region, now()); err != nil {
+		return fmt.Errorf("awssigner: failed to sign the request: %v", err)
+	}
+	load.Logrus.Debugf("AWS Signer: signed request to %v for %v in %v", r.URL.Host, s.Service, s.Region)
+	return nil
+}
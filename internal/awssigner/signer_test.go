@@ -0,0 +1,54 @@
+package awssigner
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestSign(t *testing.T) {
+	// get-vanilla and post-x-www-form-urlencoded of the aws signature version 4 test suite
+	now = func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+	signer := Signer{
+		Service:     "service",
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentials("AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", ""),
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, signer.Sign(r))
+	assert.Equal(t, "20150830T123600Z", r.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", r.Header.Get("Authorization"))
+
+	r, _ = http.NewRequest(http.MethodPost, "https://example.amazonaws.com/", strings.NewReader("Param1=value1"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	require.NoError(t, signer.Sign(r))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=content-type;host;x-amz-date, "+
+		"Signature=ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a", r.Header.Get("Authorization"))
+}
+
+func TestNewSigner(t *testing.T) {
+	settings := load.AWSSigner{Service: "es", Region: "eu-west-1", AccessKey: "AKID", SecretKey: "SECRET", SessionToken: "TOKEN"}
+	signer, err := NewSigner(settings)
+	require.NoError(t, err)
+	assert.Equal(t, "es", signer.Service)
+	assert.Equal(t, "eu-west-1", signer.Region)
+	value, err := signer.Credentials.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "AKID", value.AccessKeyID)
+	assert.Equal(t, "TOKEN", value.SessionToken)
+
+	// the same settings share the resolved credentials
+	again, err := NewSigner(settings)
+	require.NoError(t, err)
+	assert.True(t, signer == again)
+}
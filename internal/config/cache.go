@@ -0,0 +1,157 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// responseCache data sets stored for apis using cache_ttl
+type responseCache struct {
+	StoredMs int64           `json:"storedMs"`
+	DataSets json.RawMessage `json:"dataSets"`
+}
+
+// responseCacheKey key used to store the data sets of an api, the api definition is hashed
+// so apis created by lookups get their own entry and changing the api invalidates its cache
+func responseCacheKey(cfg *load.Config, apiNo int) string {
+	api := cfg.APIs[apiNo]
+	apiName := api.Name
+	if apiName == "" {
+		apiName = api.EventType
+	}
+	if apiName == "" {
+		apiName = fmt.Sprintf("%d", apiNo)
+	}
+	hash := fnv.New32a()
+	definition, _ := yaml.Marshal(&api)
+	hash.Write(definition) //nolint
+	return strings.Replace(fmt.Sprintf("flex-cache-%s-%s-%x", cfg.Name, apiName, hash.Sum32()), " ", "_", -1)
+}
+
+// cacheTTL returns the cache ttl of the api, 0 when the api isn't cached or there is no storer
+func cacheTTL(cfg *load.Config, apiNo int) time.Duration {
+	api := cfg.APIs[apiNo]
+	if api.CacheTTL == "" || load.Storer == nil {
+		return 0
+	}
+	ttl, err := time.ParseDuration(api.CacheTTL)
+	if err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name":      cfg.Name,
+			"api":       api.Name,
+			"cache_ttl": api.CacheTTL,
+		}).WithError(err).Error("config: invalid cache_ttl, not caching")
+		return 0
+	}
+	return ttl
+}
+
+// readResponse reads the stored data sets of the api and when they were stored, false if nothing is stored
+func readResponse(cfg *load.Config, apiNo int) ([]interface{}, time.Time, bool) {
+	api := cfg.APIs[apiNo]
+	var cache responseCache
+	_, err := load.Storer.Get(responseCacheKey(cfg, apiNo), &cache)
+	if err == persist.ErrNotFound {
+		return nil, time.Time{}, false
+	}
+	var dataSets []interface{}
+	if err == nil {
+		err = json.Unmarshal(cache.DataSets, &dataSets)
+	}
+	if err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name": cfg.Name,
+			"api":  api.Name,
+		}).WithError(err).Warn("config: failed to read cached api data")
+		return nil, time.Time{}, false
+	}
+	return dataSets, time.Unix(0, cache.StoredMs*int64(time.Millisecond)), true
+}
+
+// cachedResponse returns the stored data sets of the api when they haven't expired yet
+func cachedResponse(cfg *load.Config, apiNo int, now time.Time) ([]interface{}, bool) {
+	ttl := cacheTTL(cfg, apiNo)
+	if ttl == 0 {
+		return nil, false
+	}
+	dataSets, stored, ok := readResponse(cfg, apiNo)
+	if !ok || now.Sub(stored) >= ttl {
+		return nil, false
+	}
+	load.Logrus.WithFields(logrus.Fields{
+		"name": cfg.Name,
+		"api":  cfg.APIs[apiNo].Name,
+		"age":  now.Sub(stored).Round(time.Second).String(),
+	}).Debug("config: serving api data from cache")
+	load.StatusCounterIncrement("CacheHits")
+	return dataSets, true
+}
+
+// storeResponse stores the fetched data sets of the api, when the input failed the stored data sets
+// are served instead, even when expired, and the fetched ones are returned when nothing is stored
+func storeResponse(cfg *load.Config, apiNo int, dataSets []interface{}, failed bool, now time.Time) []interface{} {
+	if cacheTTL(cfg, apiNo) == 0 {
+		return dataSets
+	}
+	api := cfg.APIs[apiNo]
+
+	if failed {
+		stale, stored, ok := readResponse(cfg, apiNo)
+		if !ok {
+			return dataSets
+		}
+		load.Logrus.WithFields(logrus.Fields{
+			"name": cfg.Name,
+			"api":  api.Name,
+			"age":  now.Sub(stored).Round(time.Second).String(),
+		}).Warn("config: api input failed, serving stale data from cache")
+		load.StatusCounterIncrement("CacheStaleServed")
+		return stale
+	}
+
+	// marshal now, as the data sets are modified while being processed
+	data, err := json.Marshal(dataSets)
+	if err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name": cfg.Name,
+			"api":  api.Name,
+		}).WithError(err).Error("config: failed to cache api data")
+		return dataSets
+	}
+	load.Storer.Set(responseCacheKey(cfg, apiNo), responseCache{
+		StoredMs: now.UnixNano() / int64(time.Millisecond),
+		DataSets: data,
+	})
+	return dataSets
+}
+
+// fetchFailed checks if the input returned an error sample or an http error status, no data from an input
+// that didn't report an error is a valid result
+func fetchFailed(dataSets []interface{}) bool {
+	for _, dataSet := range dataSets {
+		sample, ok := dataSet.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err, ok := sample["error"]; ok && fmt.Sprintf("%v", err) != "false" {
+			return true
+		}
+		if status, ok := sample["api.StatusCode"].(int); ok && status >= 400 {
+			return true
+		}
+	}
+	return false
+}
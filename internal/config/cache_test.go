@@ -0,0 +1,132 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchDataCacheTTL(t *testing.T) {
+	load.Refresh()
+	load.Storer = persist.NewInMemoryStore()
+	defer func() { load.Storer = nil }()
+
+	dir, err := ioutil.TempDir("", "flex-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "teams")
+	require.NoError(t, ioutil.WriteFile(file, []byte("team:a"), 0644))
+
+	cfg := load.Config{
+		Name: "cache",
+		APIs: []load.API{{Name: "teams", CacheTTL: "1h", Commands: []load.Command{{Run: "cat " + file, SplitBy: ":"}}}},
+	}
+	fetch := func() interface{} {
+		dataSets := FetchData(context.Background(), 0, &cfg, &load.SamplesToMerge{})
+		require.Len(t, dataSets, 1)
+		return dataSets[0].(map[string]interface{})["team"]
+	}
+
+	assert.Equal(t, "a", fetch())
+
+	// served from the cache until it expires
+	require.NoError(t, ioutil.WriteFile(file, []byte("team:b"), 0644))
+	assert.Equal(t, "a", fetch())
+	assert.Equal(t, 1, load.StatusCounterRead("CacheHits"))
+
+	// expired, fetched again
+	var cache responseCache
+	_, err = load.Storer.Get(responseCacheKey(&cfg, 0), &cache)
+	require.NoError(t, err)
+	cache.StoredMs -= int64(2 * time.Hour / time.Millisecond)
+	load.Storer.Set(responseCacheKey(&cfg, 0), cache)
+	assert.Equal(t, "b", fetch())
+
+	// the input fails, the expired data is served
+	_, err = load.Storer.Get(responseCacheKey(&cfg, 0), &cache)
+	require.NoError(t, err)
+	cache.StoredMs -= int64(2 * time.Hour / time.Millisecond)
+	load.Storer.Set(responseCacheKey(&cfg, 0), cache)
+	require.NoError(t, os.Remove(file))
+	assert.Equal(t, "b", fetch())
+	assert.Equal(t, 1, load.StatusCounterRead("CacheStaleServed"))
+}
+
+func TestFetchDataCacheInputFailed(t *testing.T) {
+	load.Refresh()
+	load.Storer = persist.NewInMemoryStore()
+	defer func() { load.Storer = nil }()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestFetchDataCacheInputFailed", "nri-flex")
+
+	body := `{"team":"a"}`
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	cfg := load.Config{
+		Name:           "cache",
+		MaxConcurrency: 1,
+		APIs:           []load.API{{Name: "teams", CacheTTL: "1h", URL: server.URL}},
+	}
+	expire := func() {
+		var cache responseCache
+		_, err := load.Storer.Get(responseCacheKey(&cfg, 0), &cache)
+		require.NoError(t, err)
+		cache.StoredMs -= int64(2 * time.Hour / time.Millisecond)
+		load.Storer.Set(responseCacheKey(&cfg, 0), cache)
+	}
+	team := func(dataSets []interface{}) interface{} {
+		require.Len(t, dataSets, 1)
+		return dataSets[0].(map[string]interface{})["team"]
+	}
+	assert.Equal(t, "a", team(FetchData(context.Background(), 0, &cfg, &load.SamplesToMerge{})))
+
+	// the body fails to parse, no samples are returned but the stored data is served and kept
+	expire()
+	body = `{"team":`
+	assert.Equal(t, "a", team(FetchData(context.Background(), 0, &cfg, &load.SamplesToMerge{})))
+	assert.Equal(t, 1, load.StatusCounterRead("CacheStaleServed"))
+
+	// cancelled while waiting for a free input slot
+	release, err := fetchPool.acquire(context.Background(), newInputSlot(&cfg, cfg.APIs[0]))
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, "a", team(FetchData(ctx, 0, &cfg, &load.SamplesToMerge{})))
+	release()
+	assert.Equal(t, 2, load.StatusCounterRead("CacheStaleServed"))
+
+	// an empty result of an input that succeeded replaces the stored data
+	body = `[]`
+	assert.Empty(t, FetchData(context.Background(), 0, &cfg, &load.SamplesToMerge{}))
+	expire()
+	body = `{"team":`
+	assert.Empty(t, FetchData(context.Background(), 0, &cfg, &load.SamplesToMerge{}))
+}
+
+func TestFetchFailed(t *testing.T) {
+	assert.False(t, fetchFailed(nil))
+	assert.True(t, fetchFailed([]interface{}{map[string]interface{}{"error": "connection refused"}}))
+	assert.True(t, fetchFailed([]interface{}{map[string]interface{}{"api.StatusCode": 503}}))
+	assert.False(t, fetchFailed([]interface{}{map[string]interface{}{"api.StatusCode": 200, "error": false}}))
+	assert.False(t, fetchFailed([]interface{}{map[string]interface{}{"value": 1}}))
+}
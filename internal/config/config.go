@@ -6,6 +6,7 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -13,10 +14,10 @@ import (
 	"path"
 	"regexp"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/outputs"
 	"github.com/newrelic/nri-flex/internal/processor"
 	"github.com/sirupsen/logrus"
 
@@ -29,7 +30,11 @@ func LoadFiles(configs *[]load.Config, files []os.FileInfo, filePath string) []e
 	var errors []error
 	for _, f := range files {
 		if f.IsDir() {
-			recurseDirectory(path.Join(filePath, f.Name()), configs)
+			nestedErrors := recurseDirectory(path.Join(filePath, f.Name()), configs)
+			// nested files that fail to load are only reported when validating
+			if load.Args.Validate {
+				errors = append(errors, nestedErrors...)
+			}
 			continue
 		}
 		// ignoring non-yaml files
@@ -58,6 +63,14 @@ func LoadV4IntegrationConfig(v4Str string, configs *[]load.Config, fileName stri
 
 	load.Logrus.Warn("config: testing agent config, agent features will not be available")
 
+	if load.Args.Validate {
+		err = unmarshalYML([]byte(v4Str), &v4IntegrationStrict{})
+		if err != nil {
+			load.Logrus.WithError(err).Error("config: failed to validate v4 config file")
+			return err
+		}
+	}
+
 	for _, integration := range c.Integrations {
 		// ensure it is a flex based integration
 		if integration.Name == "nri-flex" {
@@ -115,7 +128,7 @@ func LoadFile(configs *[]load.Config, f os.FileInfo, dirPath string) error {
 			load.Logrus.WithFields(logrus.Fields{
 				"file": filePath,
 			}).WithError(err).Error("config: failed to load v4 config file")
-			return err
+			return fmt.Errorf("config: %s: %v", filePath, err)
 		}
 	} else {
 		config, err := ReadYML(ymlStr)
@@ -123,7 +136,7 @@ func LoadFile(configs *[]load.Config, f os.FileInfo, dirPath string) error {
 			load.Logrus.WithFields(logrus.Fields{
 				"file": filePath,
 			}).WithError(err).Error("config: failed to load config file")
-			return err
+			return fmt.Errorf("config: %s: %v", filePath, err)
 		}
 
 		applyFlexMeta(&config)
@@ -154,11 +167,11 @@ func LoadFile(configs *[]load.Config, f os.FileInfo, dirPath string) error {
 	return nil
 }
 
-func recurseDirectory(filePath string, configs *[]load.Config) {
+func recurseDirectory(filePath string, configs *[]load.Config) []error {
 	// do not recurse through .git or nr-integrations folder.
 	if strings.Contains(filePath, ".git") ||
 		strings.Contains(filePath, "nr-integrations") {
-		return
+		return nil
 	}
 
 	load.Logrus.WithFields(logrus.Fields{
@@ -170,9 +183,9 @@ func recurseDirectory(filePath string, configs *[]load.Config) {
 		load.Logrus.WithFields(logrus.Fields{
 			"path": filePath,
 		}).WithError(err).Debug("config: failed to read")
-		return
+		return nil
 	}
-	LoadFiles(configs, files, filePath)
+	return LoadFiles(configs, files, filePath)
 }
 
 func checkIngestConfigs(config *load.Config) {
@@ -187,15 +200,15 @@ func checkIngestConfigs(config *load.Config) {
 // ReadYML Unmarshals yml files
 func ReadYML(yml string) (load.Config, error) {
 	c := load.Config{}
-	err := yaml.Unmarshal([]byte(yml), &c)
+	err := unmarshalYML([]byte(yml), &c)
 	if err != nil {
 		return load.Config{}, err
 	}
 	return c, nil
 }
 
-// Run Action each config file
-func Run(yml load.Config) {
+// Run Action each config file, apis are not started once the context is done
+func Run(ctx context.Context, yml load.Config) {
 	// samplesToMerge := map[string][]interface{}{}
 	var samplesToMerge load.SamplesToMerge
 	samplesToMerge.Data = map[string][]interface{}{}
@@ -209,11 +222,32 @@ func Run(yml load.Config) {
 
 	// intentionally handled synchronously
 	for i := range yml.APIs {
+		if ctx.Err() != nil {
+			load.Logrus.WithFields(logrus.Fields{
+				"name": yml.Name,
+				"api":  yml.APIs[i].Name,
+			}).Debug("config: cancelled, skipping remaining apis")
+			break
+		}
 		if err := runVariableProcessor(&yml); err != nil {
 			load.Logrus.WithError(err).Error("config: variable processor error")
 		}
-		dataSets := FetchData(i, &yml, &samplesToMerge)
-		processor.RunDataHandler(dataSets, &samplesToMerge, i, &yml, i)
+		if isScheduled(yml.APIs[i]) {
+			due, replay := checkSchedule(&yml, i, time.Now())
+			if !due {
+				if len(replay) > 0 {
+					cacheData(&yml, yml.APIs[i], replay)
+					processData(replay, &samplesToMerge, i, &yml, i)
+				}
+				continue
+			}
+		}
+		dataSets := FetchData(ctx, i, &yml, &samplesToMerge)
+		// a cut off run is not recorded so the api runs again on the next execution
+		if isScheduled(yml.APIs[i]) && ctx.Err() == nil {
+			recordRun(&yml, i, dataSets, time.Now())
+		}
+		processData(dataSets, &samplesToMerge, i, &yml, i)
 	}
 
 	load.Logrus.WithFields(logrus.Fields{
@@ -227,7 +261,7 @@ func Run(yml load.Config) {
 }
 
 // RunAsync API in Async mode after lookup
-func RunAsync(yml load.Config, samplesToMerge *load.SamplesToMerge, originalAPINo int) {
+func RunAsync(ctx context.Context, yml load.Config, samplesToMerge *load.SamplesToMerge, originalAPINo int) {
 	load.Logrus.WithFields(logrus.Fields{
 		"name": yml.Name,
 		"apis": len(yml.APIs),
@@ -235,8 +269,6 @@ func RunAsync(yml load.Config, samplesToMerge *load.SamplesToMerge, originalAPIN
 
 	// load secrets
 	_ = loadSecrets(&yml)
-	var wgapi sync.WaitGroup
-	wgapi.Add(len(yml.APIs))
 
 	// Throttle to rate limit for Async request
 	rl := ratelimit.NewUnlimited()
@@ -248,15 +280,15 @@ func RunAsync(yml load.Config, samplesToMerge *load.SamplesToMerge, originalAPIN
 		"apis":       yml.APIs[originalAPINo].Name,
 	}).Debug("API Async Throttle Setting: ")
 
-	for i := range yml.APIs {
+	// lookups can generate thousands of apis, so they share a bounded number of workers
+	runWorkers(len(yml.APIs), configConcurrency(&yml), func(i int) {
 		rl.Take()
-		go func(originalAPINo int, i int) {
-			defer wgapi.Done()
-			dataSets := FetchData(i, &yml, samplesToMerge)
-			processor.RunDataHandler(dataSets, samplesToMerge, i, &yml, originalAPINo)
-		}(originalAPINo, i)
-	}
-	wgapi.Wait()
+		if ctx.Err() != nil {
+			return
+		}
+		dataSets := FetchData(ctx, i, &yml, samplesToMerge)
+		processData(dataSets, samplesToMerge, i, &yml, originalAPINo)
+	})
 
 	load.Logrus.WithFields(logrus.Fields{
 		"name": yml.Name,
@@ -270,7 +302,7 @@ func RunAsync(yml load.Config, samplesToMerge *load.SamplesToMerge, originalAPIN
 }
 
 // RunSync API in Sync mode after lookup
-func RunSync(yml load.Config, samplesToMerge *load.SamplesToMerge, originalAPINo int) {
+func RunSync(ctx context.Context, yml load.Config, samplesToMerge *load.SamplesToMerge, originalAPINo int) {
 	load.Logrus.WithFields(logrus.Fields{
 		"name": yml.Name,
 		"apis": len(yml.APIs),
@@ -280,8 +312,11 @@ func RunSync(yml load.Config, samplesToMerge *load.SamplesToMerge, originalAPINo
 	_ = loadSecrets(&yml)
 
 	for i := range yml.APIs {
-		dataSets := FetchData(i, &yml, samplesToMerge)
-		processor.RunDataHandler(dataSets, samplesToMerge, i, &yml, originalAPINo)
+		if ctx.Err() != nil {
+			break
+		}
+		dataSets := FetchData(ctx, i, &yml, samplesToMerge)
+		processData(dataSets, samplesToMerge, i, &yml, originalAPINo)
 	}
 
 	load.Logrus.WithFields(logrus.Fields{
@@ -295,22 +330,46 @@ func RunSync(yml load.Config, samplesToMerge *load.SamplesToMerge, originalAPINo
 	// processor.ProcessSamplesMergeJoin(&samplesToMerge, &yml)
 }
 
-// RunFiles Processes yml files
-func RunFiles(configs *[]load.Config) []error {
+// processData runs the data handler on the data of the api and records the processing time in its stats
+func processData(dataSets []interface{}, samplesToMerge *load.SamplesToMerge, i int, yml *load.Config, originalAPINo int) {
+	start := time.Now()
+	processor.RunDataHandler(dataSets, samplesToMerge, i, yml, originalAPINo)
+	processed := time.Since(start)
+	load.APIStatsUpdate(yml, yml.APIs[i].Name, func(stats *load.APIStats) {
+		stats.ProcessMs += float64(processed) / float64(time.Millisecond)
+	})
+}
+
+// RunFiles Processes yml files, configs still running when the context is done are cut off
+// configs with depends_on only run once the configs they depend on completed, also in async mode
+func RunFiles(ctx context.Context, configs *[]load.Config) []error {
 	var errors []error
+	waves, cyclic := configWaves(*configs)
+	for _, i := range cyclic {
+		cfg := (*configs)[i]
+		err := fmt.Errorf("config: %s: depends_on can't be satisfied because of a dependency cycle, config not run", cfg.Name)
+		load.ConfigStatusUpdate(cfg, time.Now(), 0, err)
+		errors = append(errors, err)
+	}
+
 	if load.Args.ProcessConfigsSync {
-		for _, cfg := range *configs {
-			err := verifyConfig(cfg)
-			if err != nil {
-				errors = append(errors, err)
-			} else {
-				load.Logrus.WithFields(logrus.Fields{"name": cfg.Name}).Debug("config: running sync")
-				Run(cfg)
-				load.StatusCounterIncrement("ConfigsProcessed")
+		for _, wave := range waves {
+			for _, i := range wave {
+				cfg := (*configs)[i]
+				err := verifyConfig(cfg)
+				if err != nil {
+					load.ConfigStatusUpdate(cfg, time.Now(), 0, err)
+					errors = append(errors, err)
+				} else {
+					load.Logrus.WithFields(logrus.Fields{"name": cfg.Name}).Debug("config: running sync")
+					runConfig(ctx, cfg)
+					load.StatusCounterIncrement("ConfigsProcessed")
+				}
 			}
 		}
 	} else {
 		errorChannel := make(chan error)
+		collected := make(chan struct{})
 		// listen for errors coming from the verification of the configs and store them for later
 		go func() {
 			for err := range errorChannel {
@@ -318,31 +377,31 @@ func RunFiles(configs *[]load.Config) []error {
 					errors = append(errors, err)
 				}
 			}
+			close(collected)
 		}()
 
 		rl := ratelimit.NewUnlimited()
 		if load.Args.AsyncRate != 0 {
 			rl = ratelimit.New(load.Args.AsyncRate)
 		}
-		var wg sync.WaitGroup
-		wg.Add(len(*configs))
-		for _, cfg := range *configs {
-			rl.Take()
-			go func(cfg load.Config) {
-				defer wg.Done()
+		for _, wave := range waves {
+			wave := wave
+			runWorkers(len(wave), load.Args.MaxConcurrency, func(i int) {
+				cfg := (*configs)[wave[i]]
+				rl.Take()
 				err := verifyConfig(cfg)
 				if err != nil {
+					load.ConfigStatusUpdate(cfg, time.Now(), 0, err)
 					errorChannel <- err
 				} else {
 					load.Logrus.WithFields(logrus.Fields{"name": cfg.Name}).Debug("config: running async")
-					Run(cfg)
+					runConfig(ctx, cfg)
 					load.StatusCounterIncrement("ConfigsProcessed")
 				}
-			}(cfg)
+			})
 		}
-
-		wg.Wait()
 		close(errorChannel)
+		<-collected
 	}
 
 	load.Logrus.WithFields(logrus.Fields{
@@ -352,11 +411,65 @@ func RunFiles(configs *[]load.Config) []error {
 	return errors
 }
 
+// runConfig runs the config within its timeout and records its status, including if it was cut off
+func runConfig(ctx context.Context, cfg load.Config) {
+	runCtx := ctx
+	// the timeout was checked by verifyConfig
+	if timeout, _ := configTimeout(cfg); timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// errors left over from a previous run that was cut off are not counted
+	load.ConfigErrorTake(cfg.Name)
+	start := time.Now()
+	Run(runCtx, cfg)
+	inputErrors, lastError := load.ConfigErrorTake(cfg.Name)
+
+	var err error
+	if inputErrors > 0 {
+		err = fmt.Errorf("config: %d input error(s), last: %s", inputErrors, lastError)
+	}
+	if runCtx.Err() != nil {
+		reason := "timeout"
+		if ctx.Err() != nil {
+			reason = "run_timeout"
+		}
+		err = fmt.Errorf("config: cut off by %s after %v: %v", reason, time.Since(start).Round(time.Millisecond), runCtx.Err())
+		load.StatusCounterIncrement("ConfigsCutOff")
+		load.Logrus.WithFields(logrus.Fields{
+			"name": cfg.Name,
+			"file": cfg.FileName,
+		}).WithError(err).Warn("config: cut off, samples collected before the cut off are kept")
+		outputs.ErrorSample(cfg.Name, "", "config", err)
+	}
+	load.ConfigStatusUpdate(cfg, start, time.Since(start), err)
+}
+
+// configTimeout returns the timeout of the config, zero when not set
+func configTimeout(cfg load.Config) (time.Duration, error) {
+	if cfg.Timeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if timeout < 0 {
+		return 0, fmt.Errorf("timeout must not be negative: %s", cfg.Timeout)
+	}
+	return timeout, nil
+}
+
 // verifyConfig ensure the config file doesn't have anything it should not run
 func verifyConfig(cfg load.Config) error {
 	if strings.HasPrefix(cfg.FileName, "cd-") && !cfg.ContainerDiscovery.ReplaceComplete {
 		return fmt.Errorf("config: failed to apply discovery to config: '%s'", cfg.Name)
 	}
+	if _, err := configTimeout(cfg); err != nil {
+		return fmt.Errorf("config: invalid timeout in config: '%s': %v", cfg.Name, err)
+	}
 	ymlBytes, err := yaml.Marshal(cfg)
 	if err != nil {
 		return err
@@ -6,15 +6,19 @@
 package config
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -77,7 +81,7 @@ func TestConfigDir(t *testing.T) {
 	}
 	require.Empty(t, errs)
 
-	errs = RunFiles(&ymls)
+	errs = RunFiles(context.Background(), &ymls)
 	for _, err = range errs {
 		assert.NoError(t, err)
 	}
@@ -115,7 +119,7 @@ func TestConfigFile(t *testing.T) {
 	}
 	require.Empty(t, errs)
 
-	RunFiles(&ymls)
+	RunFiles(context.Background(), &ymls)
 
 	jsonFile, _ := ioutil.ReadFile(path.Join("..", "..", "test", "payloadsExpected", "configFile.json"))
 	var expectedOutput []metric.Set
@@ -145,7 +149,7 @@ func TestV4ConfigFile(t *testing.T) {
 	files = append(files, file)
 
 	LoadFiles(&ymls, files, filePath) // load standard configs if available
-	RunFiles(&ymls)
+	RunFiles(context.Background(), &ymls)
 
 	jsonFile, _ := ioutil.ReadFile(path.Join("..", "..", "test", "payloadsExpected", "configFileV4.json"))
 	var expectedOutput []metric.Set
@@ -175,3 +179,290 @@ func TestApplyFlexMeta(t *testing.T) {
 		t.Errorf("failed to apply flex meta variable hello expected %v got %v", "123", config.CustomAttributes["hello"])
 	}
 }
+
+func TestRunFilesCutOff(t *testing.T) {
+	load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestRunFilesCutOff", "nri-flex")
+
+	configs := []load.Config{
+		{
+			Name:    "configTimeout",
+			Timeout: "200ms",
+			APIs: []load.API{
+				{Name: "slow", Commands: []load.Command{{Run: "sleep 5"}}},
+				{Name: "skipped", Commands: []load.Command{{Run: `echo "skipped:1"`, SplitBy: ":"}}},
+			},
+		},
+		{
+			Name: "runTimeout",
+			APIs: []load.API{
+				{Name: "fast", Commands: []load.Command{{Run: `echo "fast:1"`, SplitBy: ":"}}},
+				{Name: "slow", Commands: []load.Command{{Run: "sleep 5"}}},
+			},
+		},
+		{
+			Name:    "invalidTimeout",
+			Timeout: "soon",
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	errs := RunFiles(ctx, &configs)
+	assert.Less(t, int64(time.Since(start)), int64(3*time.Second))
+
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "invalid timeout in config: 'invalidTimeout'")
+	assert.Equal(t, 2, load.StatusCounterRead("ConfigsCutOff"))
+	assert.Equal(t, 0, load.StatusCounterRead("skippedSample"))
+	assert.Equal(t, 1, load.StatusCounterRead("fastSample"))
+
+	statuses := map[string]string{}
+	for _, status := range load.ConfigStatusRead() {
+		statuses[status.Name] = status.Error
+	}
+	assert.Contains(t, statuses["configTimeout"], "cut off by timeout")
+	assert.Contains(t, statuses["runTimeout"], "cut off by run_timeout")
+}
+
+func TestRunFilesInputErrors(t *testing.T) {
+	load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestRunFilesInputErrors", "nri-flex")
+
+	configs := []load.Config{
+		{
+			Name: "failing",
+			APIs: []load.API{
+				{Name: "missing", File: "/does/not/exist.json"},
+				{Name: "ok", Commands: []load.Command{{Run: `echo "ok:1"`, SplitBy: ":"}}},
+				{Name: "missingToo", File: "/does/not/exist/either.json"},
+			},
+		},
+		{
+			Name: "working",
+			APIs: []load.API{{Name: "ok", Commands: []load.Command{{Run: `echo "ok:1"`, SplitBy: ":"}}}},
+		},
+	}
+	require.Empty(t, RunFiles(context.Background(), &configs))
+
+	statuses := map[string]string{}
+	for _, status := range load.ConfigStatusRead() {
+		statuses[status.Name] = status.Error
+	}
+	assert.Contains(t, statuses["failing"], "2 input error(s)")
+	assert.Contains(t, statuses["failing"], "either.json")
+	assert.Empty(t, statuses["working"])
+
+	// the errors of a run don't carry over to the next one
+	configs = configs[:1]
+	configs[0].APIs = configs[0].APIs[1:2]
+	require.Empty(t, RunFiles(context.Background(), &configs))
+	for _, status := range load.ConfigStatusRead() {
+		if status.Name == "failing" {
+			assert.Empty(t, status.Error)
+		}
+	}
+}
+
+func TestRunFilesDependsOn(t *testing.T) {
+	load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestRunFilesDependsOn", "nri-flex")
+
+	configs := []load.Config{
+		{
+			Name:      "consumer",
+			DependsOn: []string{"producer"},
+			APIs:      []load.API{{Name: "consumer", Cache: "shared:token"}},
+		},
+		{
+			Name: "producer",
+			APIs: []load.API{{Name: "producer", PublishAs: "token", Commands: []load.Command{{Run: `sleep 0.1; echo "token:abc"`, SplitBy: ":"}}}},
+		},
+		{Name: "cycleA", DependsOn: []string{"cycleB"}},
+		{Name: "cycleB", DependsOn: []string{"cycleA"}},
+	}
+
+	errs := RunFiles(context.Background(), &configs)
+	require.Len(t, errs, 2)
+	assert.Contains(t, errs[0].Error(), "config: cycleA: depends_on can't be satisfied")
+	assert.Contains(t, errs[1].Error(), "config: cycleB: depends_on can't be satisfied")
+
+	assert.Equal(t, 1, load.StatusCounterRead("producerSample"))
+	assert.Equal(t, 1, load.StatusCounterRead("consumerSample"))
+	require.Len(t, load.SharedStoreRead("token"), 1)
+	assert.Equal(t, "abc", load.SharedStoreRead("token")[0].(map[string]interface{})["token"])
+}
+
+func TestRunFilesSharedReaders(t *testing.T) {
+	load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestRunFilesSharedReaders", "nri-flex")
+
+	// the producer and both readers process their own copy of the published data set
+	configs := []load.Config{
+		{
+			Name: "producer",
+			APIs: []load.API{{
+				Name:       "producer",
+				PublishAs:  "items",
+				Commands:   []load.Command{{Run: `echo '[{"name":"a","nested":{"value":1}},{"name":"b","nested":{"value":2}}]'`}},
+				RenameKeys: map[string]string{"name": "producerName"},
+			}},
+		},
+		{
+			Name:      "readerA",
+			DependsOn: []string{"producer"},
+			APIs:      []load.API{{Name: "readerA", Cache: "shared:items", RenameKeys: map[string]string{"name": "readerAName"}}},
+		},
+		{
+			Name:      "readerB",
+			DependsOn: []string{"producer"},
+			APIs:      []load.API{{Name: "readerB", Cache: "shared:items", RenameKeys: map[string]string{"nested": "renamed"}}},
+		},
+	}
+	require.Empty(t, RunFiles(context.Background(), &configs))
+
+	assert.Equal(t, 2, load.StatusCounterRead("readerASample"))
+	assert.Equal(t, 2, load.StatusCounterRead("readerBSample"))
+	items := load.SharedStoreRead("items")
+	require.Len(t, items, 1)
+	samples := items[0].([]interface{})
+	require.Len(t, samples, 2)
+	assert.Equal(t, map[string]interface{}{"name": "a", "nested": map[string]interface{}{"value": 1.0}}, samples[0])
+
+	// the samples read can be changed without changing the store
+	samples[1].(map[string]interface{})["nested"].(map[string]interface{})["value"] = 3.0
+	stored := load.SharedStoreRead("items")[0].([]interface{})[1]
+	assert.Equal(t, 2.0, stored.(map[string]interface{})["nested"].(map[string]interface{})["value"])
+}
+
+func TestRunFilesAPIStats(t *testing.T) {
+	load.Refresh()
+	defer load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestRunFilesAPIStats", "nri-flex")
+
+	output := `[{"name":"keep","value":1},{"name":"skip","value":2}]`
+	configs := []load.Config{
+		{
+			Name:     "stats",
+			FileName: "stats.yml",
+			APIs: []load.API{
+				{
+					Name:                "items",
+					Commands:            []load.Command{{Run: "echo '" + output + "'"}},
+					SampleExcludeFilter: []map[string]string{{"name": "skip"}},
+				},
+			},
+		},
+	}
+	start := load.TimestampMs()
+	require.Empty(t, RunFiles(context.Background(), &configs))
+
+	stats := load.APIStatsFlush()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "stats", stats[0].Name)
+	assert.Equal(t, "stats.yml", stats[0].File)
+	assert.Equal(t, "items", stats[0].API)
+	assert.Equal(t, 1, stats[0].Runs)
+	assert.Equal(t, int64(len(output)+1), stats[0].Bytes)
+	assert.Equal(t, 1, stats[0].Samples)
+	assert.Equal(t, 1, stats[0].Dropped)
+	assert.Greater(t, stats[0].FetchMs, 0.0)
+	assert.GreaterOrEqual(t, stats[0].LastSuccessMs, start)
+	assert.Empty(t, load.APIStatsFlush())
+}
+
+func TestFetchDataQueuedStats(t *testing.T) {
+	load.Refresh()
+	defer load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestFetchDataQueuedStats", "nri-flex")
+
+	yml := load.Config{
+		Name:           "queued",
+		MaxConcurrency: 1,
+		APIs:           []load.API{{Name: "items", Commands: []load.Command{{Run: `echo "value:1"`, SplitBy: ":"}}}},
+	}
+
+	// the time spent waiting for a free input slot is not fetch time
+	release, err := fetchPool.acquire(context.Background(), newInputSlot(&yml, yml.APIs[0]))
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		release()
+	}()
+	start := time.Now()
+	FetchData(context.Background(), 0, &yml, &load.SamplesToMerge{Data: map[string][]interface{}{}})
+	require.True(t, time.Since(start) >= 500*time.Millisecond)
+
+	stats := load.APIStatsFlush()
+	require.Len(t, stats, 1)
+	assert.Less(t, stats[0].FetchMs, 400.0)
+}
+
+func TestRunFilesGraphQL(t *testing.T) {
+	load.Refresh()
+	defer load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestRunFilesGraphQL", "nri-flex")
+
+	var owners []interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var body struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		_ = json.NewDecoder(request.Body).Decode(&body)
+		owners = append(owners, body.Variables["owner"])
+		page := `{"data":{"repository":{"issues":{"nodes":[{"title":"a"},{"title":"b"}],"pageInfo":{"hasNextPage":true,"endCursor":"b"}}}}}`
+		if body.Variables["after"] == "b" {
+			page = `{"data":{"repository":{"issues":{"nodes":[{"title":"c"}],"pageInfo":{"hasNextPage":false,"endCursor":"c"}}}}}`
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(page))
+	}))
+	defer server.Close()
+
+	cfg, err := ReadYML(fmt.Sprintf(`
+name: graphql
+apis:
+  - name: owner
+    commands:
+      - run: echo '{"owner":"newrelic"}'
+    store_variables:
+      owner: owner
+    ignore_output: true
+  - event_type: issueSample
+    url: %s/graphql
+    graphql:
+      query: |
+        query($owner: String!, $after: String) {
+          repository(owner: $owner, name: "nri-flex") {
+            issues(first: 2, after: $after) { nodes { title } pageInfo { hasNextPage endCursor } }
+          }
+        }
+      variables:
+        owner: ${var:owner}
+    start_key:
+      - data
+      - repository
+      - issues
+      - nodes
+`, server.URL))
+	require.NoError(t, err)
+	configs := []load.Config{cfg}
+	require.Empty(t, RunFiles(context.Background(), &configs))
+
+	assert.Equal(t, []interface{}{"newrelic", "newrelic"}, owners)
+	var titles []string
+	for _, metricSet := range load.Entity.Metrics {
+		if metricSet.Metrics["event_type"] == "issueSample" {
+			titles = append(titles, fmt.Sprint(metricSet.Metrics["title"]))
+		}
+	}
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, titles)
+}
@@ -0,0 +1,78 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/sirupsen/logrus"
+)
+
+// configWaves orders the configs in waves by their depends_on, a config only runs once the waves before it completed.
+// Dependencies on configs that are not being run are ignored, eg. when running a single config or in daemon mode
+// where each config runs on its own. The configs that can't be ordered because of a cycle are returned apart
+func configWaves(configs []load.Config) (waves [][]int, cyclic []int) {
+	names := map[string][]int{}
+	for i, cfg := range configs {
+		names[cfg.Name] = append(names[cfg.Name], i)
+	}
+
+	dependencies := make([][]int, len(configs))
+	for i, cfg := range configs {
+		for _, name := range cfg.DependsOn {
+			if len(names[name]) == 0 {
+				load.Logrus.WithFields(logrus.Fields{
+					"name":       cfg.Name,
+					"depends_on": name,
+				}).Debug("config: dependency not being run, ignoring")
+				continue
+			}
+			dependencies[i] = append(dependencies[i], names[name]...)
+		}
+	}
+
+	done := make([]bool, len(configs))
+	remaining := len(configs)
+	for remaining > 0 {
+		var wave []int
+		for i := range configs {
+			if !done[i] && dependenciesDone(dependencies[i], done) {
+				wave = append(wave, i)
+			}
+		}
+		if len(wave) == 0 {
+			break
+		}
+		// mark the wave done after selecting it so a wave never contains a config and its dependency
+		for _, i := range wave {
+			done[i] = true
+		}
+		remaining -= len(wave)
+		waves = append(waves, wave)
+	}
+
+	for i := range configs {
+		if !done[i] {
+			cyclic = append(cyclic, i)
+		}
+	}
+	return waves, cyclic
+}
+
+func dependenciesDone(dependencies []int, done []bool) bool {
+	for _, i := range dependencies {
+		if !done[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// DependencyCycles returns the indexes of the configs that can't be ordered because of a dependency cycle,
+// used by the daemon that runs every config on its own
+func DependencyCycles(configs []load.Config) []int {
+	_, cyclic := configWaves(configs)
+	return cyclic
+}
@@ -0,0 +1,33 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestConfigWaves(t *testing.T) {
+	configs := []load.Config{
+		{Name: "report", DependsOn: []string{"inventory", "token"}},
+		{Name: "inventory", DependsOn: []string{"token"}},
+		{Name: "token"},
+		{Name: "standalone", DependsOn: []string{"notLoaded"}},
+		{Name: "self", DependsOn: []string{"self"}},
+		{Name: "afterSelf", DependsOn: []string{"self"}},
+	}
+
+	waves, cyclic := configWaves(configs)
+	assert.Equal(t, [][]int{{2, 3}, {1}, {0}}, waves)
+	assert.Equal(t, []int{4, 5}, cyclic)
+
+	waves, cyclic = configWaves(nil)
+	assert.Empty(t, waves)
+	assert.Empty(t, cyclic)
+}
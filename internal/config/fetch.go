@@ -6,23 +6,60 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/newrelic/nri-flex/internal/inputs"
 	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/outputs"
 	"github.com/sirupsen/logrus"
 	yaml "gopkg.in/yaml.v2"
 )
 
-// FetchData fetches data from various inputs
+// FetchData fetches data from various inputs, in-flight inputs are cancelled once the context is done
 // Also handles paginated responses for HTTP requests (tested against NR APIs)
-func FetchData(apiNo int, yml *load.Config, samplesToMerge *load.SamplesToMerge) []interface{} {
+func FetchData(ctx context.Context, apiNo int, yml *load.Config, samplesToMerge *load.SamplesToMerge) []interface{} {
 	load.Logrus.WithFields(logrus.Fields{
 		"name": yml.Name,
 	}).Debug("fetch: collect data")
 
+	api := yml.APIs[apiNo]
+	var dataStore []interface{}
+
+	continueProcessing := FetchLookups(ctx, yml, apiNo, samplesToMerge)
+
+	if continueProcessing {
+		if cached, fresh := cachedResponse(yml, apiNo, time.Now()); fresh {
+			dataStore = cached
+		} else {
+			var fetched time.Duration
+			var inputFailed bool
+			dataStore, fetched, inputFailed = fetchInput(ctx, yml, apiNo)
+			failed := inputFailed || fetchFailed(dataStore)
+			load.APIStatsUpdate(yml, api.Name, func(stats *load.APIStats) {
+				stats.Runs++
+				stats.FetchMs += float64(fetched) / float64(time.Millisecond)
+				if !failed {
+					stats.LastSuccessMs = load.TimestampMs()
+				}
+			})
+			dataStore = storeResponse(yml, apiNo, dataStore, failed, time.Now())
+		}
+	}
+
+	cacheData(yml, api, dataStore)
+	publishData(yml, api, dataStore)
+
+	return dataStore
+}
+
+// fetchInput runs the input of the api once a slot is free in the fetch pool, and returns how long the input ran
+// without the time spent waiting for the slot, and if it failed: it was cancelled or reported an error,
+// in which case the data it returned, even empty, isn't a result
+func fetchInput(ctx context.Context, yml *load.Config, apiNo int) ([]interface{}, time.Duration, bool) {
 	api := yml.APIs[apiNo]
 	file := api.File
 	reqURL := api.URL
@@ -30,44 +67,57 @@ func FetchData(apiNo int, yml *load.Config, samplesToMerge *load.SamplesToMerge)
 	doLoop := true
 	var dataStore []interface{}
 
-	continueProcessing := FetchLookups(yml, apiNo, samplesToMerge)
+	// the slot is only held while the input runs, lookups wait for their own slots
+	release, err := fetchPool.acquire(ctx, newInputSlot(yml, api))
+	if err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name": yml.Name,
+			"api":  api.Name,
+		}).WithError(err).Debug("fetch: cancelled waiting for a free input slot")
+		return dataStore, 0, true
+	}
+	defer release()
+	start := time.Now()
+	errorCount := load.APIErrorCount(yml.Name, api.Name)
 
-	if continueProcessing {
-		if file != "" {
-			err := inputs.ProcessFile(&dataStore, yml, apiNo)
-			if err != nil {
-				load.Logrus.WithFields(logrus.Fields{
-					"name": yml.Name,
-					"file": file,
-				}).WithError(err).Error("fetch: failed to process file")
-			}
-		} else if api.Cache != "" {
-			if yml.Datastore[api.Cache] != nil {
-				dataStore = yml.Datastore[api.Cache]
-			}
-		} else if api.Ingest {
-			if yml.Datastore["IngestData"] != nil {
-				dataStore = yml.Datastore["IngestData"]
-			}
-		} else if len(api.Commands) > 0 && api.Database == "" && api.DBConn == "" {
-			inputs.RunCommands(&dataStore, yml, apiNo)
-		} else if reqURL != "" {
-			inputs.RunHTTP(&dataStore, &doLoop, yml, api, &reqURL)
-		} else if api.Database != "" && api.DBConn != "" {
-			inputs.ProcessQueries(&dataStore, yml, apiNo)
-		} else if api.Scp.Host != "" {
-			err := inputs.RunScpWithTimeout(&dataStore, yml, api)
-			if err != nil {
-				load.Logrus.WithFields(logrus.Fields{
-					"name": yml.Name,
-					"host": api.Scp.Host,
-				}).WithError(err).Error("fetch: failed to process remote file")
-			}
+	if file != "" {
+		err := inputs.ProcessFile(ctx, &dataStore, yml, apiNo)
+		if err != nil {
+			load.Logrus.WithFields(logrus.Fields{
+				"name": yml.Name,
+				"file": file,
+			}).WithError(err).Error("fetch: failed to process file")
+			outputs.ErrorSample(yml.Name, api.Name, "file", err)
+		}
+	} else if api.Cache != "" {
+		dataStore = load.CacheRead(yml, api.Cache)
+	} else if api.Ingest {
+		if yml.Datastore["IngestData"] != nil {
+			dataStore = yml.Datastore["IngestData"]
+		}
+	} else if len(api.Commands) > 0 && api.Database == "" && api.DBConn == "" {
+		inputs.RunCommands(ctx, &dataStore, yml, apiNo)
+	} else if reqURL != "" {
+		inputs.RunHTTP(ctx, &dataStore, &doLoop, yml, api, &reqURL)
+	} else if api.Database != "" && api.DBConn != "" {
+		inputs.ProcessQueries(ctx, &dataStore, yml, apiNo)
+	} else if api.Scp.Host != "" {
+		err := inputs.RunScpWithTimeout(ctx, &dataStore, yml, api)
+		if err != nil {
+			load.Logrus.WithFields(logrus.Fields{
+				"name": yml.Name,
+				"host": api.Scp.Host,
+			}).WithError(err).Error("fetch: failed to process remote file")
+			outputs.ErrorSample(yml.Name, api.Name, "scp", err)
 		}
 	}
+	failed := ctx.Err() != nil || load.APIErrorCount(yml.Name, api.Name) > errorCount
+	return dataStore, time.Since(start), failed
+}
 
-	// cache output into datastore for later use
-	// if the source was a cache itself, we don't store it
+// cacheData cache output into datastore for later use
+// if the source was a cache itself, we don't store it
+func cacheData(yml *load.Config, api load.API, dataStore []interface{}) {
 	if len(dataStore) > 0 {
 		load.CacheStoreLock.Lock()
 		if api.URL != "" {
@@ -89,12 +139,24 @@ func FetchData(apiNo int, yml *load.Config, samplesToMerge *load.SamplesToMerge)
 
 		load.CacheStoreLock.Unlock()
 	}
+}
 
-	return dataStore
+// publishData publishes the data to the shared store when the api has publish_as set,
+// an empty result keeps the previously published data
+func publishData(yml *load.Config, api load.API, dataStore []interface{}) {
+	if api.PublishAs == "" || len(dataStore) == 0 {
+		return
+	}
+	load.Logrus.WithFields(logrus.Fields{
+		"name":       yml.Name,
+		"api":        api.Name,
+		"publish_as": api.PublishAs,
+	}).Debug("fetch: publishing data to the shared store")
+	load.SharedStorePublish(api.PublishAs, dataStore)
 }
 
 // FetchLookups x
-func FetchLookups(cfg *load.Config, apiNo int, samplesToMerge *load.SamplesToMerge) bool {
+func FetchLookups(ctx context.Context, cfg *load.Config, apiNo int, samplesToMerge *load.SamplesToMerge) bool {
 	tmpCfgBytes, err := yaml.Marshal(&cfg.APIs[apiNo])
 
 	if err != nil {
@@ -119,10 +181,12 @@ func FetchLookups(cfg *load.Config, apiNo int, samplesToMerge *load.SamplesToMer
 		Name:             cfg.Name,
 		Global:           cfg.Global,
 		FileName:         cfg.FileName,
+		FilePath:         cfg.FilePath,
 		Datastore:        cfg.Datastore,
 		LookupStore:      cfg.LookupStore,
 		VariableStore:    cfg.VariableStore,
 		CustomAttributes: cfg.CustomAttributes,
+		MaxConcurrency:   cfg.MaxConcurrency,
 	}
 
 	for _, newAPI := range newAPIs {
@@ -149,9 +213,9 @@ func FetchLookups(cfg *load.Config, apiNo int, samplesToMerge *load.SamplesToMer
 	//          When in RunAsync/run_async mode, we will disable StoreLookups and VariableLookups due to potential concurrent map write.
 	//          We will address this in the future if required. These two functions are probably not necessary for this use case.
 	if cfg.APIs[apiNo].RunAsync {
-		RunAsync(lookupConfig, samplesToMerge, apiNo)
+		RunAsync(ctx, lookupConfig, samplesToMerge, apiNo)
 	} else {
-		RunSync(lookupConfig, samplesToMerge, apiNo)
+		RunSync(ctx, lookupConfig, samplesToMerge, apiNo)
 	}
 	return false
 }
@@ -265,6 +329,8 @@ func automaticLookup(tmpCfgStr string, cfg *load.Config, apiNo int) []string {
 		return []string{}
 	}
 
+	load.EntityLock.RLock()
+	defer load.EntityLock.RUnlock()
 	eventTypesCompleted := []string{}
 	dedupeCheck := map[string][]string{}
 	for _, lookup := range lookupsFound {
@@ -303,6 +369,7 @@ func automaticLookup(tmpCfgStr string, cfg *load.Config, apiNo int) []string {
 		Name:             cfg.Name,
 		Global:           cfg.Global,
 		FileName:         cfg.FileName,
+		FilePath:         cfg.FilePath,
 		Datastore:        cfg.Datastore,
 		LookupStore:      cfg.LookupStore,
 		VariableStore:    cfg.VariableStore,
@@ -0,0 +1,239 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+// fetchPool limits the inputs running at once across all configs
+var fetchPool = newInputPool()
+
+// inputPool limits the inputs running at once globally, per config and per host.
+// Free slots are handed out round robin between the configs waiting for one,
+// so a config whose lookups generate thousands of apis doesn't starve the others
+type inputPool struct {
+	sync.Mutex
+	running int
+	configs map[string]int
+	hosts   map[string]int
+	waiting []string // configs with inputs waiting for a slot, in the order they are served
+	waiters map[string][]*inputSlot
+}
+
+// inputSlot an input waiting for or holding a slot, and the limits that apply to it, 0 for unlimited
+type inputSlot struct {
+	config      string
+	host        string // empty for local inputs, which are not limited per host
+	globalLimit int
+	configLimit int
+	hostLimit   int
+	ready       chan struct{}
+}
+
+func newInputPool() *inputPool {
+	return &inputPool{
+		configs: map[string]int{},
+		hosts:   map[string]int{},
+		waiters: map[string][]*inputSlot{},
+	}
+}
+
+// acquire waits for a free slot, the returned function releases it
+func (p *inputPool) acquire(ctx context.Context, slot *inputSlot) (func(), error) {
+	slot.ready = make(chan struct{})
+
+	p.Lock()
+	if len(p.waiters[slot.config]) == 0 {
+		p.waiting = append(p.waiting, slot.config)
+	}
+	p.waiters[slot.config] = append(p.waiters[slot.config], slot)
+	p.dispatch()
+	p.Unlock()
+
+	select {
+	case <-slot.ready:
+		return func() { p.release(slot) }, nil
+	case <-ctx.Done():
+		p.Lock()
+		defer p.Unlock()
+		if !p.remove(slot) {
+			// the slot was granted while cancelling
+			p.releaseLocked(slot)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (p *inputPool) release(slot *inputSlot) {
+	p.Lock()
+	defer p.Unlock()
+	p.releaseLocked(slot)
+}
+
+func (p *inputPool) releaseLocked(slot *inputSlot) {
+	p.running--
+	if p.configs[slot.config]--; p.configs[slot.config] <= 0 {
+		delete(p.configs, slot.config)
+	}
+	if slot.host != "" {
+		if p.hosts[slot.host]--; p.hosts[slot.host] <= 0 {
+			delete(p.hosts, slot.host)
+		}
+	}
+	p.dispatch()
+}
+
+// dispatch grants free slots to the waiting configs in turn,
+// within a config the first input that fits is granted so a busy host doesn't hold up the other hosts
+func (p *inputPool) dispatch() {
+	for granted := true; granted; {
+		granted = false
+		for i, config := range p.waiting {
+			waiters := p.waiters[config]
+			for j, slot := range waiters {
+				if !p.fits(slot) {
+					continue
+				}
+				p.running++
+				p.configs[config]++
+				if slot.host != "" {
+					p.hosts[slot.host]++
+				}
+				close(slot.ready)
+
+				p.waiters[config] = append(waiters[:j:j], waiters[j+1:]...)
+				// the config moves to the back of the line
+				p.waiting = append(p.waiting[:i:i], p.waiting[i+1:]...)
+				if len(p.waiters[config]) > 0 {
+					p.waiting = append(p.waiting, config)
+				} else {
+					delete(p.waiters, config)
+				}
+				granted = true
+				break
+			}
+			if granted {
+				break
+			}
+		}
+	}
+}
+
+func (p *inputPool) fits(slot *inputSlot) bool {
+	if slot.globalLimit > 0 && p.running >= slot.globalLimit {
+		return false
+	}
+	if slot.configLimit > 0 && p.configs[slot.config] >= slot.configLimit {
+		return false
+	}
+	if slot.host != "" && slot.hostLimit > 0 && p.hosts[slot.host] >= slot.hostLimit {
+		return false
+	}
+	return true
+}
+
+// remove removes a waiting slot, false if it isn't waiting anymore
+func (p *inputPool) remove(slot *inputSlot) bool {
+	waiters := p.waiters[slot.config]
+	for j, waiter := range waiters {
+		if waiter != slot {
+			continue
+		}
+		p.waiters[slot.config] = append(waiters[:j:j], waiters[j+1:]...)
+		if len(p.waiters[slot.config]) == 0 {
+			delete(p.waiters, slot.config)
+			for i, config := range p.waiting {
+				if config == slot.config {
+					p.waiting = append(p.waiting[:i:i], p.waiting[i+1:]...)
+					break
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// newInputSlot returns the slot used by the input of the api, with the limits of the args and config
+func newInputSlot(yml *load.Config, api load.API) *inputSlot {
+	return &inputSlot{
+		config:      yml.FileName + ":" + yml.Name,
+		host:        apiHost(yml, api),
+		globalLimit: load.Args.MaxConcurrency,
+		configLimit: configConcurrency(yml),
+		hostLimit:   load.Args.MaxHostConcurrency,
+	}
+}
+
+// configConcurrency returns the maximum number of inputs of the config running at once, 0 for unlimited
+func configConcurrency(yml *load.Config) int {
+	if yml.MaxConcurrency > 0 {
+		return yml.MaxConcurrency
+	}
+	return load.Args.MaxConfigConcurrency
+}
+
+// apiHost returns the host the input of the api connects to, in the same order as FetchData picks the input,
+// empty for local inputs and databases
+func apiHost(yml *load.Config, api load.API) string {
+	switch {
+	case api.File != "" || api.Cache != "" || api.Ingest:
+		return ""
+	case len(api.Commands) > 0 && api.Database == "" && api.DBConn == "":
+		for _, command := range api.Commands {
+			if command.Dial != "" {
+				if host, _, err := net.SplitHostPort(command.Dial); err == nil {
+					return host
+				}
+				return command.Dial
+			}
+		}
+		return ""
+	case api.URL != "":
+		reqURL := yml.Global.BaseURL + api.URL
+		if !strings.Contains(reqURL, "://") {
+			reqURL = "http://" + reqURL
+		}
+		u, err := url.Parse(reqURL)
+		if err != nil {
+			return ""
+		}
+		return u.Hostname()
+	case api.Scp.Host != "":
+		return api.Scp.Host
+	}
+	return ""
+}
+
+// runWorkers calls fn for each of the count items on at most workers goroutines, one per item when workers is 0
+func runWorkers(count, workers int, fn func(i int)) {
+	if workers <= 0 || workers > count {
+		workers = count
+	}
+	items := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range items {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		items <- i
+	}
+	close(items)
+	wg.Wait()
+}
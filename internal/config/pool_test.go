@@ -0,0 +1,158 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestInputPoolLimits(t *testing.T) {
+	pool := newInputPool()
+
+	var mu sync.Mutex
+	running := map[string]int{}
+	maxRunning := map[string]int{}
+	track := func(key string, delta int) {
+		mu.Lock()
+		running[key] += delta
+		if running[key] > maxRunning[key] {
+			maxRunning[key] = running[key]
+		}
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		slot := &inputSlot{config: "a", host: "one", globalLimit: 6, configLimit: 4, hostLimit: 2}
+		if i%2 == 1 {
+			slot = &inputSlot{config: "b", host: "two", globalLimit: 6, configLimit: 4, hostLimit: 3}
+		}
+		wg.Add(1)
+		go func(slot *inputSlot) {
+			defer wg.Done()
+			release, err := pool.acquire(context.Background(), slot)
+			require.NoError(t, err)
+			track("global", 1)
+			track(slot.config, 1)
+			track(slot.host, 1)
+			time.Sleep(2 * time.Millisecond)
+			track("global", -1)
+			track(slot.config, -1)
+			track(slot.host, -1)
+			release()
+		}(slot)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, maxRunning["global"], 5)
+	assert.LessOrEqual(t, maxRunning["a"], 2)
+	assert.LessOrEqual(t, maxRunning["b"], 3)
+	assert.Equal(t, 0, pool.running)
+	assert.Empty(t, pool.waiting)
+	assert.Empty(t, pool.waiters)
+}
+
+func TestInputPoolFairness(t *testing.T) {
+	pool := newInputPool()
+	ctx := context.Background()
+
+	// hold the only slot so everything else queues
+	release, err := pool.acquire(ctx, &inputSlot{config: "busy", globalLimit: 1})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	queue := func(config string, queued int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := pool.acquire(ctx, &inputSlot{config: config, globalLimit: 1})
+			require.NoError(t, err)
+			mu.Lock()
+			order = append(order, config)
+			mu.Unlock()
+			release()
+		}()
+		// wait until queued so the order is known
+		for waiting(pool) < queued {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	queue("lookups", 1)
+	queue("lookups", 2)
+	queue("lookups", 3)
+	queue("other", 4)
+
+	release()
+	wg.Wait()
+	assert.Equal(t, []string{"lookups", "other", "lookups", "lookups"}, order)
+}
+
+func waiting(pool *inputPool) int {
+	pool.Lock()
+	defer pool.Unlock()
+	queued := 0
+	for _, waiters := range pool.waiters {
+		queued += len(waiters)
+	}
+	return queued
+}
+
+func TestInputPoolCancel(t *testing.T) {
+	pool := newInputPool()
+	release, err := pool.acquire(context.Background(), &inputSlot{config: "a", globalLimit: 1})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = pool.acquire(ctx, &inputSlot{config: "b", globalLimit: 1})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Empty(t, pool.waiting)
+	assert.Empty(t, pool.waiters)
+
+	release()
+	assert.Equal(t, 0, pool.running)
+}
+
+func TestAPIHost(t *testing.T) {
+	yml := &load.Config{Global: load.Global{BaseURL: "http://localhost:9200/"}}
+	assert.Equal(t, "localhost", apiHost(yml, load.API{URL: "_cluster/health"}))
+	assert.Equal(t, "example.com", apiHost(&load.Config{}, load.API{URL: "https://example.com:8443/status"}))
+	assert.Equal(t, "example.com", apiHost(&load.Config{}, load.API{URL: "example.com/status"}))
+	assert.Equal(t, "redis", apiHost(&load.Config{}, load.API{Commands: []load.Command{{Run: "INFO\r\n", Dial: "redis:6379"}}}))
+	assert.Equal(t, "", apiHost(&load.Config{}, load.API{Commands: []load.Command{{Run: "echo a:1"}}}))
+	assert.Equal(t, "sftp.local", apiHost(&load.Config{}, load.API{Scp: load.SCP{Host: "sftp.local"}}))
+	assert.Equal(t, "", apiHost(yml, load.API{Cache: "_cluster/health"}))
+}
+
+func TestRunWorkers(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning, calls := 0, 0, 0
+	runWorkers(20, 3, func(i int) {
+		mu.Lock()
+		running++
+		calls++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+	assert.Equal(t, 20, calls)
+	assert.Equal(t, 3, maxRunning)
+}
@@ -0,0 +1,128 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/sirupsen/logrus"
+)
+
+// apiSchedule state stored for apis using run_every or min_interval
+type apiSchedule struct {
+	Skipped   int             `json:"skipped"`
+	LastRunMs int64           `json:"lastRunMs"`
+	DataSets  json.RawMessage `json:"dataSets,omitempty"` // stored when replay_on_skip is enabled
+}
+
+// isScheduled checks if the api only runs on some executions
+func isScheduled(api load.API) bool {
+	return api.RunEvery > 1 || api.MinInterval != ""
+}
+
+// scheduleKey key used to store the schedule of an api
+func scheduleKey(cfg *load.Config, apiNo int) string {
+	api := cfg.APIs[apiNo]
+	apiName := api.Name
+	if apiName == "" {
+		apiName = api.EventType
+	}
+	if apiName == "" {
+		apiName = fmt.Sprintf("%d", apiNo)
+	}
+	return strings.Replace(fmt.Sprintf("flex-schedule-%s-%s", cfg.Name, apiName), " ", "_", -1)
+}
+
+// checkSchedule returns true if the api is due to run, if not the skip is recorded
+// and the data sets of the last run are returned when replay_on_skip is enabled
+func checkSchedule(cfg *load.Config, apiNo int, now time.Time) (bool, []interface{}) {
+	if load.Storer == nil {
+		return true, nil
+	}
+	api := cfg.APIs[apiNo]
+	key := scheduleKey(cfg, apiNo)
+
+	var schedule apiSchedule
+	_, err := load.Storer.Get(key, &schedule)
+	if err == persist.ErrNotFound {
+		return true, nil
+	} else if err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name": cfg.Name,
+			"api":  api.Name,
+		}).WithError(err).Warn("config: failed to read api schedule, running api")
+		return true, nil
+	}
+
+	due := true
+	if api.RunEvery > 1 && schedule.Skipped+1 < api.RunEvery {
+		due = false
+	}
+	if api.MinInterval != "" {
+		minInterval, err := time.ParseDuration(api.MinInterval)
+		if err != nil {
+			load.Logrus.WithFields(logrus.Fields{
+				"name":         cfg.Name,
+				"api":          api.Name,
+				"min_interval": api.MinInterval,
+			}).WithError(err).Error("config: invalid min_interval")
+		} else if now.Sub(time.Unix(0, schedule.LastRunMs*int64(time.Millisecond))) < minInterval {
+			due = false
+		}
+	}
+	if due {
+		return true, nil
+	}
+
+	schedule.Skipped++
+	load.Storer.Set(key, schedule)
+
+	load.Logrus.WithFields(logrus.Fields{
+		"name":    cfg.Name,
+		"api":     api.Name,
+		"skipped": schedule.Skipped,
+	}).Debug("config: api not due, skipping")
+
+	if !api.ReplayOnSkip || len(schedule.DataSets) == 0 {
+		return false, nil
+	}
+	var dataSets []interface{}
+	if err := json.Unmarshal(schedule.DataSets, &dataSets); err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name": cfg.Name,
+			"api":  api.Name,
+		}).WithError(err).Error("config: failed to replay api data")
+		return false, nil
+	}
+	return false, dataSets
+}
+
+// recordRun stores the time of the run, and the data sets when replay_on_skip is enabled
+func recordRun(cfg *load.Config, apiNo int, dataSets []interface{}, now time.Time) {
+	if load.Storer == nil {
+		return
+	}
+	api := cfg.APIs[apiNo]
+	schedule := apiSchedule{LastRunMs: now.UnixNano() / int64(time.Millisecond)}
+	if api.ReplayOnSkip {
+		// marshal now, as the data sets are modified while being processed
+		data, err := json.Marshal(dataSets)
+		if err != nil {
+			load.Logrus.WithFields(logrus.Fields{
+				"name": cfg.Name,
+				"api":  api.Name,
+			}).WithError(err).Error("config: failed to store api data for replay")
+		} else {
+			schedule.DataSets = data
+		}
+	}
+	load.Storer.Set(scheduleKey(cfg, apiNo), schedule)
+}
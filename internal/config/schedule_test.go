@@ -0,0 +1,86 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckScheduleRunEvery(t *testing.T) {
+	load.Storer = persist.NewInMemoryStore()
+	defer func() { load.Storer = nil }()
+
+	cfg := load.Config{Name: "schedule", APIs: []load.API{{Name: "slow", RunEvery: 3}}}
+	now := time.Now()
+
+	var runs []bool
+	for i := 0; i < 6; i++ {
+		due, _ := checkSchedule(&cfg, 0, now)
+		if due {
+			recordRun(&cfg, 0, nil, now)
+		}
+		runs = append(runs, due)
+	}
+	assert.Equal(t, []bool{true, false, false, true, false, false}, runs)
+}
+
+func TestCheckScheduleMinInterval(t *testing.T) {
+	load.Storer = persist.NewInMemoryStore()
+	defer func() { load.Storer = nil }()
+
+	cfg := load.Config{Name: "schedule", APIs: []load.API{{Name: "slow", MinInterval: "5m", ReplayOnSkip: true}}}
+	now := time.Now()
+
+	due, replay := checkSchedule(&cfg, 0, now)
+	require.True(t, due)
+	assert.Nil(t, replay)
+
+	dataSets := []interface{}{map[string]interface{}{"value": 1}}
+	recordRun(&cfg, 0, dataSets, now)
+	// data sets are modified during processing, the replay must not see this
+	dataSets[0].(map[string]interface{})["value"] = 2
+
+	due, replay = checkSchedule(&cfg, 0, now.Add(time.Minute))
+	require.False(t, due)
+	require.Len(t, replay, 1)
+	assert.Equal(t, float64(1), replay[0].(map[string]interface{})["value"])
+
+	due, _ = checkSchedule(&cfg, 0, now.Add(5*time.Minute))
+	assert.True(t, due)
+}
+
+func TestRunScheduled(t *testing.T) {
+	load.Refresh()
+	load.Storer = persist.NewInMemoryStore()
+	defer func() { load.Storer = nil }()
+
+	cfg := load.Config{
+		Name: "scheduleRun",
+		APIs: []load.API{
+			{Name: "fast", Commands: []load.Command{{Run: `echo "count:1"`, SplitBy: ":"}}},
+			{Name: "slow", RunEvery: 2, Commands: []load.Command{{Run: `echo "count:2"`, SplitBy: ":"}}},
+		},
+	}
+
+	Run(context.Background(), cfg)
+	assert.Equal(t, 1, load.StatusCounterRead("fastSample"))
+	assert.Equal(t, 1, load.StatusCounterRead("slowSample"))
+
+	Run(context.Background(), cfg)
+	assert.Equal(t, 2, load.StatusCounterRead("fastSample"))
+	assert.Equal(t, 1, load.StatusCounterRead("slowSample"))
+
+	Run(context.Background(), cfg)
+	assert.Equal(t, 3, load.StatusCounterRead("fastSample"))
+	assert.Equal(t, 2, load.StatusCounterRead("slowSample"))
+}
@@ -0,0 +1,340 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/itchyny/gojq"
+	"github.com/newrelic/nri-flex/internal/inputs"
+	"github.com/newrelic/nri-flex/internal/load"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var (
+	lookupRefRegex = regexp.MustCompile(`\${lookup:(.*?)}`)
+	varRefRegex    = regexp.MustCompile(`\${var:(.*?)}`)
+	secretRefRegex = regexp.MustCompile(`\${secret\.(.*?):.*?}`)
+)
+
+// v4IntegrationStrict used to strictly validate the flex config of v4 integration files,
+// other agent keys are accepted as is
+type v4IntegrationStrict struct {
+	Integrations []struct {
+		Name   string                 `yaml:"name"`
+		Config load.Config            `yaml:"config"`
+		Agent  map[string]interface{} `yaml:",inline"`
+	} `yaml:"integrations"`
+	Agent map[string]interface{} `yaml:",inline"`
+}
+
+// unmarshalYML unmarshal yml, strictly when validating so unknown keys are reported with their line
+func unmarshalYML(in []byte, out interface{}) error {
+	if load.Args.Validate {
+		return yaml.UnmarshalStrict(in, out)
+	}
+	return yaml.Unmarshal(in, out)
+}
+
+// ValidateConfig checks a loaded config for conflicting inputs and references to undeclared lookups, variables and secrets
+func ValidateConfig(cfg load.Config) []error {
+	var errors []error
+	file := path.Join(cfg.FilePath, cfg.FileName)
+
+	lookups := map[string]bool{}
+	for key := range cfg.LookupStore {
+		lookups[key] = true
+	}
+	variables := map[string]bool{}
+	for key := range cfg.VariableStore {
+		variables[key] = true
+	}
+	for _, api := range cfg.APIs {
+		for key := range api.StoreLookups {
+			lookups[key] = true
+		}
+		for key := range api.StoreVariables {
+			variables[key] = true
+		}
+	}
+
+	if cfg.Interval != "" {
+		if _, err := time.ParseDuration(cfg.Interval); err != nil {
+			errors = append(errors, fmt.Errorf("config: %s: invalid interval: %v", file, err))
+		}
+	}
+	if _, err := configTimeout(cfg); err != nil {
+		errors = append(errors, fmt.Errorf("config: %s: invalid timeout: %v", file, err))
+	}
+	for _, err := range validateRetry(cfg.Global.Retry) {
+		errors = append(errors, fmt.Errorf("config: %s: global: %v", file, err))
+	}
+	for _, err := range validateBreaker(cfg.Global.Breaker) {
+		errors = append(errors, fmt.Errorf("config: %s: global: %v", file, err))
+	}
+	for _, err := range validateOAuth2(cfg.Global.OAuth2) {
+		errors = append(errors, fmt.Errorf("config: %s: global: %v", file, err))
+	}
+	if !validAuthType(cfg.Global.AuthType) {
+		errors = append(errors, fmt.Errorf("config: %s: global: invalid auth_type: %s, expected one of %s", file, cfg.Global.AuthType, strings.Join(load.AuthTypes, ", ")))
+	}
+	for _, name := range cfg.DependsOn {
+		if name == cfg.Name {
+			errors = append(errors, fmt.Errorf("config: %s: depends_on references the config itself", file))
+		}
+	}
+
+	for i, api := range cfg.APIs {
+		apiName := api.Name
+		if apiName == "" {
+			apiName = api.EventType
+		}
+		if apiName == "" {
+			apiName = fmt.Sprintf("%d", i)
+		}
+
+		if !inputs.ValidResponseFormat(api.ResponseFormat) {
+			errors = append(errors, fmt.Errorf("config: %s: api %s: invalid response_format: %s, expected one of %s", file, apiName, api.ResponseFormat, strings.Join(load.ResponseFormats, ", ")))
+		}
+
+		var inputs []string
+		if api.URL != "" {
+			inputs = append(inputs, "url")
+		}
+		if len(api.Commands) > 0 {
+			inputs = append(inputs, "commands")
+		}
+		if api.File != "" {
+			inputs = append(inputs, "file")
+		}
+		if len(inputs) > 1 {
+			errors = append(errors, fmt.Errorf("config: %s: api %s: only one of url, commands and file can be set, found %s",
+				file, apiName, strings.Join(inputs, ", ")))
+		}
+
+		if api.MinInterval != "" {
+			if _, err := time.ParseDuration(api.MinInterval); err != nil {
+				errors = append(errors, fmt.Errorf("config: %s: api %s: invalid min_interval: %v", file, apiName, err))
+			}
+		}
+		for _, err := range validateRetry(api.Retry) {
+			errors = append(errors, fmt.Errorf("config: %s: api %s: %v", file, apiName, err))
+		}
+		for _, err := range validateBreaker(api.Breaker) {
+			errors = append(errors, fmt.Errorf("config: %s: api %s: %v", file, apiName, err))
+		}
+		for _, err := range validateOAuth2(api.OAuth2) {
+			errors = append(errors, fmt.Errorf("config: %s: api %s: %v", file, apiName, err))
+		}
+		if !validAuthType(api.AuthType) {
+			errors = append(errors, fmt.Errorf("config: %s: api %s: invalid auth_type: %s, expected one of %s", file, apiName, api.AuthType, strings.Join(load.AuthTypes, ", ")))
+		}
+		for _, err := range validateGraphQL(api) {
+			errors = append(errors, fmt.Errorf("config: %s: api %s: %v", file, apiName, err))
+		}
+		for _, err := range validateAWSSigner(api.AWSSigner) {
+			errors = append(errors, fmt.Errorf("config: %s: api %s: %v", file, apiName, err))
+		}
+		for _, err := range validateSignerAuth(cfg.Global, api) {
+			errors = append(errors, fmt.Errorf("config: %s: api %s: %v", file, apiName, err))
+		}
+		for _, err := range validatePagination(api.Pagination) {
+			errors = append(errors, fmt.Errorf("config: %s: api %s: %v", file, apiName, err))
+		}
+		if api.CacheTTL != "" {
+			if _, err := time.ParseDuration(api.CacheTTL); err != nil {
+				errors = append(errors, fmt.Errorf("config: %s: api %s: invalid cache_ttl: %v", file, apiName, err))
+			}
+		}
+
+		apiBytes, err := yaml.Marshal(api)
+		if err != nil {
+			errors = append(errors, fmt.Errorf("config: %s: api %s: %v", file, apiName, err))
+			continue
+		}
+		apiStr := string(apiBytes)
+		for _, ref := range uniqueRefs(lookupRefRegex, apiStr) {
+			if !lookups[ref] {
+				errors = append(errors, fmt.Errorf("config: %s: api %s: ${lookup:%s} is not stored by store_lookups or lookup_store", file, apiName, ref))
+			}
+		}
+		for _, ref := range uniqueRefs(varRefRegex, apiStr) {
+			if !variables[ref] {
+				errors = append(errors, fmt.Errorf("config: %s: api %s: ${var:%s} is not stored by store_variables or variable_store", file, apiName, ref))
+			}
+		}
+	}
+
+	cfgBytes, err := yaml.Marshal(cfg)
+	if err != nil {
+		return append(errors, fmt.Errorf("config: %s: %v", file, err))
+	}
+	for _, ref := range uniqueRefs(secretRefRegex, string(cfgBytes)) {
+		if _, ok := cfg.Secrets[ref]; !ok {
+			errors = append(errors, fmt.Errorf("config: %s: ${secret.%s:...} is not declared in secrets", file, ref))
+		}
+	}
+	return errors
+}
+
+// validateRetry checks the retry durations and jitter
+func validateRetry(retry load.Retry) []error {
+	var errors []error
+	if retry.Backoff != "" {
+		if _, err := time.ParseDuration(retry.Backoff); err != nil {
+			errors = append(errors, fmt.Errorf("invalid retry backoff: %v", err))
+		}
+	}
+	if retry.MaxBackoff != "" {
+		if _, err := time.ParseDuration(retry.MaxBackoff); err != nil {
+			errors = append(errors, fmt.Errorf("invalid retry max_backoff: %v", err))
+		}
+	}
+	if retry.Jitter < 0 || retry.Jitter > 1 {
+		errors = append(errors, fmt.Errorf("invalid retry jitter: %v is not between 0 and 1", retry.Jitter))
+	}
+	return errors
+}
+
+// validateBreaker checks the circuit breaker open_for duration and key
+func validateBreaker(breaker load.CircuitBreaker) []error {
+	var errors []error
+	if breaker.OpenFor != "" {
+		if _, err := time.ParseDuration(breaker.OpenFor); err != nil {
+			errors = append(errors, fmt.Errorf("invalid circuit_breaker open_for: %v", err))
+		}
+	}
+	if breaker.Key != "" && breaker.Key != "host" && breaker.Key != "api" {
+		errors = append(errors, fmt.Errorf("invalid circuit_breaker key: %s, expected host or api", breaker.Key))
+	}
+	return errors
+}
+
+// validateOAuth2 checks the token url is set together with the credentials, and the auth style
+func validateOAuth2(oauth2 load.OAuth2) []error {
+	var errors []error
+	if oauth2.TokenURL == "" {
+		if oauth2.ClientID != "" || oauth2.ClientSecret != "" || oauth2.RefreshToken != "" {
+			errors = append(errors, fmt.Errorf("invalid oauth2: token_url is required"))
+		}
+		return errors
+	}
+	if oauth2.ClientID == "" && oauth2.RefreshToken == "" {
+		errors = append(errors, fmt.Errorf("invalid oauth2: client_id or refresh_token is required"))
+	}
+	if oauth2.AuthStyle != "" && oauth2.AuthStyle != "header" && oauth2.AuthStyle != "params" {
+		errors = append(errors, fmt.Errorf("invalid oauth2 auth_style: %s, expected header or params", oauth2.AuthStyle))
+	}
+	return errors
+}
+
+// validateGraphQL checks the query is set together with the other graphql settings, and is sent to a url
+func validateGraphQL(api load.API) []error {
+	var errors []error
+	graphql := api.GraphQL
+	if graphql.Query == "" {
+		if len(graphql.Variables) > 0 || graphql.PageInfo != "" || graphql.CursorVariable != "" || graphql.MaxPages != 0 {
+			errors = append(errors, fmt.Errorf("invalid graphql: query is required"))
+		}
+		return errors
+	}
+	if api.URL == "" {
+		errors = append(errors, fmt.Errorf("invalid graphql: url is required"))
+	}
+	if api.Payload != "" {
+		errors = append(errors, fmt.Errorf("invalid graphql: payload can't be set with a graphql query"))
+	}
+	return errors
+}
+
+// validateAWSSigner checks the service is set together with the other settings, and the keys are set together
+func validateAWSSigner(signer load.AWSSigner) []error {
+	var errors []error
+	if signer.Service == "" {
+		if signer != (load.AWSSigner{}) {
+			errors = append(errors, fmt.Errorf("invalid aws_signer: service is required"))
+		}
+		return errors
+	}
+	if (signer.AccessKey == "") != (signer.SecretKey == "") {
+		errors = append(errors, fmt.Errorf("invalid aws_signer: access_key and secret_key are required together"))
+	}
+	return errors
+}
+
+// validateSignerAuth checks the aws_signer isn't combined with an auth that replaces its Authorization header,
+// digest and ntlm answer the challenge of the server and oauth2 replaces a rejected token after the request was signed
+func validateSignerAuth(global load.Global, api load.API) []error {
+	var errors []error
+	if api.AWSSigner.Service == "" {
+		return errors
+	}
+	authType := global.AuthType
+	if api.AuthType != "" {
+		authType = api.AuthType
+	}
+	if strings.EqualFold(authType, "digest") || strings.EqualFold(authType, "ntlm") {
+		errors = append(errors, fmt.Errorf("invalid aws_signer: can't be combined with auth_type %s, both set the Authorization header", strings.ToLower(authType)))
+	}
+	if api.OAuth2.TokenURL != "" || global.OAuth2.TokenURL != "" {
+		errors = append(errors, fmt.Errorf("invalid aws_signer: can't be combined with oauth2, both set the Authorization header"))
+	}
+	return errors
+}
+
+// validatePagination checks the jq expressions of the pagination parse, expressions with substitutions are checked once substituted
+func validatePagination(pagination load.Pagination) []error {
+	var errors []error
+	for _, path := range []struct{ name, expression string }{
+		{"next_cursor_path", pagination.NextCursorPath},
+		{"next_link_path", pagination.NextLinkPath},
+		{"page_next_path", pagination.PageNextPath},
+		{"page_limit_path", pagination.PageLimitPath},
+		{"max_pages_path", pagination.MaxPagesPath},
+		{"payload_path", pagination.PayloadPath},
+		{"total_path", pagination.TotalPath},
+	} {
+		if path.expression == "" || strings.Contains(path.expression, "${") {
+			continue
+		}
+		if _, err := gojq.Parse(path.expression); err != nil {
+			errors = append(errors, fmt.Errorf("invalid pagination %s: %v", path.name, err))
+		}
+	}
+	return errors
+}
+
+// validAuthType whether the http auth type is known, an empty auth type is basic auth
+func validAuthType(authType string) bool {
+	if authType == "" {
+		return true
+	}
+	for _, known := range load.AuthTypes {
+		if strings.EqualFold(authType, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueRefs returns the sorted unique first submatches of the regex
+func uniqueRefs(regex *regexp.Regexp, str string) []string {
+	found := map[string]bool{}
+	var refs []string
+	for _, match := range regex.FindAllStringSubmatch(str, -1) {
+		if !found[match[1]] {
+			found[match[1]] = true
+			refs = append(refs, match[1])
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
@@ -0,0 +1,127 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestReadYMLStrict(t *testing.T) {
+	yml := `
+name: strict
+apis:
+  - name: typo
+    event_typ: typoSample
+    commands:
+      - run: echo "a:1"
+`
+	load.Args.Validate = false
+	_, err := ReadYML(yml)
+	require.NoError(t, err)
+
+	load.Args.Validate = true
+	defer func() { load.Args.Validate = false }()
+	_, err = ReadYML(yml)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 5: field event_typ not found")
+}
+
+func TestReadV4Strict(t *testing.T) {
+	yml := `
+integrations:
+  - name: nri-flex
+    interval: 30s
+    config:
+      name: v4Strict
+      apis:
+        - name: typo
+          sample_filer:
+            - a: b
+`
+	load.Args.Validate = true
+	defer func() { load.Args.Validate = false }()
+
+	var configs []load.Config
+	err := LoadV4IntegrationConfig(yml, &configs, "v4.yml", "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 9: field sample_filer not found")
+}
+
+func TestValidateConfig(t *testing.T) {
+	yml := `
+name: references
+secrets:
+  mine:
+    kind: local
+    key: N3wR3lic!
+    data: abc
+apis:
+  - name: inputs
+    url: http://localhost
+    commands:
+      - run: echo "a:1"
+  - name: stores
+    commands:
+      - run: echo "a:1"
+    store_lookups:
+      stored: a
+    store_variables:
+      storedVar: a
+  - name: refs
+    url: http://localhost/${lookup:stored}/${lookup:missing}?v=${var:storedVar}&w=${var:missingVar}
+    headers:
+      ok: ${secret.mine:value}
+      missing: ${secret.other:value}
+`
+	cfg, err := ReadYML(yml)
+	require.NoError(t, err)
+
+	errors := ValidateConfig(cfg)
+	var messages []string
+	for _, err := range errors {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 4, messages)
+	assert.Contains(t, messages[0], "api inputs: only one of url, commands and file can be set, found url, commands")
+	assert.Contains(t, messages[1], "${lookup:missing}")
+	assert.Contains(t, messages[2], "${var:missingVar}")
+	assert.Contains(t, messages[3], "${secret.other:...}")
+}
+
+func TestValidateConfigSignerAuth(t *testing.T) {
+	yml := `
+name: signer
+global:
+  oauth2:
+    token_url: http://localhost/token
+    client_id: flex
+apis:
+  - name: digest
+    url: http://localhost
+    auth_type: digest
+    aws_signer:
+      service: execute-api
+  - name: unsigned
+    url: http://localhost
+    auth_type: ntlm
+`
+	cfg, err := ReadYML(yml)
+	require.NoError(t, err)
+
+	errors := ValidateConfig(cfg)
+	var messages []string
+	for _, err := range errors {
+		messages = append(messages, err.Error())
+	}
+	require.Len(t, messages, 2, messages)
+	assert.Contains(t, messages[0], "api digest: invalid aws_signer: can't be combined with auth_type digest")
+	assert.Contains(t, messages[1], "api digest: invalid aws_signer: can't be combined with oauth2")
+}
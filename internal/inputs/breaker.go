@@ -0,0 +1,203 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/parnurzeal/gorequest"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultBreakerOpenFor = time.Minute
+
+// breakers guards the circuit states in the storer, and tracks the circuits with a probe request in flight
+var breakers = struct {
+	sync.Mutex
+	probing map[string]bool
+}{probing: map[string]bool{}}
+
+// breakerState circuit state stored for circuit breakers
+type breakerState struct {
+	Failures int   `json:"failures"`
+	OpenedMs int64 `json:"openedMs"` // 0 while the circuit is closed
+}
+
+// circuitBreaker the circuit a request goes through, all methods can be called on a nil breaker when disabled
+type circuitBreaker struct {
+	key      string
+	failures int
+	openFor  time.Duration
+	config   string
+	api      string
+	probe    bool // the request is the probe of an open circuit
+}
+
+// newCircuitBreaker returns the circuit breaker of the request, nil when disabled or there is no storer
+func newCircuitBreaker(yml *load.Config, api load.API, reqURL string) *circuitBreaker {
+	settings := yml.Global.Breaker
+	if api.Breaker.Failures > 0 {
+		settings.Failures = api.Breaker.Failures
+	}
+	if api.Breaker.OpenFor != "" {
+		settings.OpenFor = api.Breaker.OpenFor
+	}
+	if api.Breaker.Key != "" {
+		settings.Key = api.Breaker.Key
+	}
+	if settings.Failures <= 0 || load.Storer == nil {
+		return nil
+	}
+
+	breaker := &circuitBreaker{
+		failures: settings.Failures,
+		openFor:  defaultBreakerOpenFor,
+		config:   yml.Name,
+		api:      api.Name,
+	}
+	if settings.OpenFor != "" {
+		openFor, err := time.ParseDuration(settings.OpenFor)
+		if err != nil {
+			load.Logrus.WithFields(logrus.Fields{
+				"name":     yml.Name,
+				"open_for": settings.OpenFor,
+			}).WithError(err).Errorf("http: invalid circuit breaker open_for, using %s", defaultBreakerOpenFor)
+		} else {
+			breaker.openFor = openFor
+		}
+	}
+
+	switch settings.Key {
+	case "api":
+		breaker.key = fmt.Sprintf("api-%s-%s", yml.Name, api.Name)
+	default:
+		host := requestHost(reqURL)
+		if host == "" {
+			host = reqURL
+		}
+		breaker.key = "host-" + host
+	}
+	return breaker
+}
+
+func (b *circuitBreaker) storeKey() string {
+	return strings.Replace("flex-breaker-"+b.key, " ", "_", -1)
+}
+
+func (b *circuitBreaker) read() breakerState {
+	var state breakerState
+	_, err := load.Storer.Get(b.storeKey(), &state)
+	if err != nil && err != persist.ErrNotFound {
+		load.Logrus.WithFields(logrus.Fields{
+			"circuit": b.key,
+		}).WithError(err).Warn("http: failed to read circuit breaker state, closing circuit")
+	}
+	return state
+}
+
+// allow checks if a request can go through the circuit, once the circuit has been open long enough
+// a single probe request is let through to check if the endpoint recovered
+func (b *circuitBreaker) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	state := b.read()
+	if state.OpenedMs == 0 {
+		return true
+	}
+	if now.Sub(time.Unix(0, state.OpenedMs*int64(time.Millisecond))) >= b.openFor && !breakers.probing[b.key] {
+		breakers.probing[b.key] = true
+		b.probe = true
+		load.Logrus.WithFields(logrus.Fields{
+			"name":    b.config,
+			"circuit": b.key,
+		}).Debug("http: circuit open, probing")
+		return true
+	}
+	load.StatusCounterIncrement("CircuitBreakerShortCircuits")
+	return false
+}
+
+// record records the outcome of a request that went through the circuit, opening or closing it,
+// a request cut off by the run or config timeout says nothing about the endpoint and only ends the probe
+func (b *circuitBreaker) record(failed bool, cutOff bool, now time.Time) {
+	if b == nil {
+		return
+	}
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	if b.probe {
+		b.probe = false
+		delete(breakers.probing, b.key)
+	}
+	if cutOff {
+		return
+	}
+	state := b.read()
+	switch {
+	case !failed && state.OpenedMs != 0:
+		b.stateChange("closed", state.Failures)
+		state = breakerState{}
+	case !failed:
+		state.Failures = 0
+	case state.OpenedMs != 0:
+		// the probe failed, stay open for another period
+		state.Failures++
+		state.OpenedMs = now.UnixNano() / int64(time.Millisecond)
+	default:
+		state.Failures++
+		if state.Failures >= b.failures {
+			state.OpenedMs = now.UnixNano() / int64(time.Millisecond)
+			b.stateChange("open", state.Failures)
+		}
+	}
+	load.Storer.Set(b.storeKey(), state)
+}
+
+// stateChange logs the state change and creates a flexCircuitBreakerSample for it
+func (b *circuitBreaker) stateChange(state string, failures int) {
+	load.Logrus.WithFields(logrus.Fields{
+		"name":     b.config,
+		"api":      b.api,
+		"circuit":  b.key,
+		"failures": failures,
+	}).Warnf("http: circuit %s", state)
+	if state == "open" {
+		load.StatusCounterIncrement("CircuitBreakerOpened")
+	}
+
+	load.EntityLock.RLock()
+	defer load.EntityLock.RUnlock()
+	if load.Entity == nil {
+		return
+	}
+	load.StatusCounterIncrement("EventCount")
+	breakerMetricSet := load.Entity.NewMetricSet("flexCircuitBreakerSample")
+	checkError(breakerMetricSet.SetMetric("circuit", b.key, metric.ATTRIBUTE))
+	checkError(breakerMetricSet.SetMetric("state", state, metric.ATTRIBUTE))
+	checkError(breakerMetricSet.SetMetric("failures", failures, metric.GAUGE))
+	checkError(breakerMetricSet.SetMetric("name", b.config, metric.ATTRIBUTE))
+	checkError(breakerMetricSet.SetMetric("api", b.api, metric.ATTRIBUTE))
+}
+
+// requestFailed checks if the endpoint is failing, client errors don't count as the endpoint responded
+func requestFailed(resp gorequest.Response, errs []error) bool {
+	if resp == nil {
+		return len(errs) > 0
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,165 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+// resetBreakers forgets the probes left in flight by previous tests
+func resetBreakers() {
+	breakers.Lock()
+	breakers.probing = map[string]bool{}
+	breakers.Unlock()
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	load.Refresh()
+	load.Storer = persist.NewInMemoryStore()
+	defer func() { load.Storer = nil }()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestCircuitBreaker", "nri-flex")
+
+	status := http.StatusServiceUnavailable
+	var count int
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		count++
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(status)
+		_, err := writer.Write([]byte(`{"status":"down"}`))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+
+	config := load.Config{
+		Name:   "breaker",
+		Global: load.Global{BaseURL: server.URL, Breaker: load.CircuitBreaker{Failures: 2, OpenFor: "1h"}},
+		APIs:   []load.API{{Name: "status", URL: "/status"}},
+	}
+	run := func() []interface{} {
+		var dataStore []interface{}
+		loop := true
+		reqURL := config.APIs[0].URL
+		RunHTTP(context.Background(), &dataStore, &loop, &config, config.APIs[0], &reqURL)
+		return dataStore
+	}
+
+	run()
+	run()
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 1, load.StatusCounterRead("CircuitBreakerOpened"))
+
+	// open, the request is not sent
+	dataStore := run()
+	assert.Equal(t, 2, count)
+	require.Len(t, dataStore, 1)
+	assert.Equal(t, "circuit breaker open", dataStore[0].(map[string]interface{})["error"])
+
+	// once open long enough a probe closes the circuit
+	breaker := newCircuitBreaker(&config, config.APIs[0], server.URL+"/status")
+	state := breaker.read()
+	state.OpenedMs -= int64(2 * time.Hour / time.Millisecond)
+	load.Storer.Set(breaker.storeKey(), state)
+	status = http.StatusOK
+	run()
+	run()
+	assert.Equal(t, 4, count)
+	assert.Equal(t, breakerState{}, breaker.read())
+
+	var states []interface{}
+	for _, metricSet := range load.Entity.Metrics {
+		if metricSet.Metrics["event_type"] == "flexCircuitBreakerSample" {
+			states = append(states, metricSet.Metrics["state"])
+		}
+	}
+	assert.Equal(t, []interface{}{"open", "closed"}, states)
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	load.Refresh()
+	resetBreakers()
+	load.Storer = persist.NewInMemoryStore()
+	defer func() { load.Storer = nil }()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestCircuitBreakerProbe", "nri-flex")
+
+	config := &load.Config{Name: "breaker"}
+	api := load.API{Name: "status", Breaker: load.CircuitBreaker{Failures: 1, OpenFor: "1m", Key: "api"}}
+	breaker := newCircuitBreaker(config, api, "http://localhost/status")
+	assert.Equal(t, "api-breaker-status", breaker.key)
+	assert.Nil(t, newCircuitBreaker(config, load.API{}, "http://localhost/status"))
+
+	now := time.Now()
+	require.True(t, breaker.allow(now))
+	breaker.record(true, false, now)
+	assert.False(t, breaker.allow(now))
+
+	// a single probe at a time
+	later := now.Add(2 * time.Minute)
+	assert.True(t, breaker.allow(later))
+	assert.False(t, breaker.allow(later))
+
+	// the probe failed, open for another period
+	breaker.record(true, false, later)
+	assert.False(t, breaker.allow(later.Add(time.Second)))
+	assert.True(t, breaker.allow(later.Add(2*time.Minute)))
+}
+
+func TestCircuitBreakerCutOffProbe(t *testing.T) {
+	load.Refresh()
+	resetBreakers()
+	load.Storer = persist.NewInMemoryStore()
+	defer func() { load.Storer = nil }()
+
+	config := &load.Config{Name: "breaker"}
+	api := load.API{Name: "status", Breaker: load.CircuitBreaker{Failures: 1, OpenFor: "1m", Key: "api"}}
+	now := time.Now()
+	breaker := newCircuitBreaker(config, api, "http://localhost/status")
+	require.True(t, breaker.allow(now))
+	breaker.record(true, false, now)
+
+	// a probe cut off by the timeout doesn't count, the next run probes again
+	later := now.Add(2 * time.Minute)
+	probe := newCircuitBreaker(config, api, "http://localhost/status")
+	require.True(t, probe.allow(later))
+	probe.record(false, true, later)
+	assert.NotZero(t, breaker.read().OpenedMs)
+
+	probe = newCircuitBreaker(config, api, "http://localhost/status")
+	require.True(t, probe.allow(later.Add(time.Second)))
+
+	// a request that isn't the probe doesn't end it
+	breaker.record(false, true, later)
+	assert.False(t, newCircuitBreaker(config, api, "http://localhost/status").allow(later.Add(time.Second)))
+}
+
+func TestCircuitBreakerNoEntity(t *testing.T) {
+	load.Refresh()
+	resetBreakers()
+	load.Storer = persist.NewInMemoryStore()
+	defer func() { load.Storer = nil }()
+	load.Entity = nil
+
+	// the circuit still opens without an entity to add the sample to
+	breaker := newCircuitBreaker(&load.Config{Name: "breaker"}, load.API{Name: "noEntity", Breaker: load.CircuitBreaker{Failures: 1}}, "http://localhost/noEntity")
+	now := time.Now()
+	require.True(t, breaker.allow(now))
+	breaker.record(true, false, now)
+	assert.False(t, breaker.allow(now))
+	assert.Equal(t, 1, load.StatusCounterRead("CircuitBreakerOpened"))
+	assert.Equal(t, 0, load.StatusCounterRead("EventCount"))
+}
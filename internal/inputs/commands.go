@@ -18,6 +18,7 @@ import (
 	xj "github.com/basgys/goxml2json"
 	"github.com/newrelic/nri-flex/internal/formatter"
 	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/outputs"
 	"github.com/sirupsen/logrus"
 )
 
@@ -32,8 +33,18 @@ func checkOS(os string) bool {
 	return false
 }
 
-// RunCommands executes the given commands to create one merged sampled
-func RunCommands(dataStore *[]interface{}, yml *load.Config, apiNo int) {
+// contextTimeout returns the timeout shortened to the deadline of the context, for clients that don't take a context
+func contextTimeout(ctx context.Context, timeout time.Duration) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); timeout <= 0 || remaining < timeout {
+			return remaining
+		}
+	}
+	return timeout
+}
+
+// RunCommands executes the given commands to create one merged sampled, running commands are killed once the context is done
+func RunCommands(ctx context.Context, dataStore *[]interface{}, yml *load.Config, apiNo int) {
 	startTime := makeTimestamp()
 	api := yml.APIs[apiNo]
 
@@ -45,29 +56,33 @@ func RunCommands(dataStore *[]interface{}, yml *load.Config, apiNo int) {
 	dataSample := map[string]interface{}{}
 	processType := ""
 	for _, command := range api.Commands {
+		if ctx.Err() != nil {
+			load.Logrus.WithFields(logrus.Fields{
+				"name": yml.Name,
+			}).WithError(ctx.Err()).Debug("commands: cancelled, skipping remaining commands")
+			break
+		}
 		if command.Run != "" && command.Dial == "" && checkOS(command.OS) {
-			commandRun(dataStore, yml, command, api, startTime, dataSample, processType)
+			commandRun(ctx, dataStore, yml, command, api, startTime, dataSample, processType)
 		} else if command.Cache != "" {
-			if yml.Datastore[command.Cache] != nil {
-				for _, cache := range yml.Datastore[command.Cache] {
-					switch sample := cache.(type) {
-					case map[string]interface{}:
-						if sample["http"] != nil {
-							load.Logrus.WithFields(logrus.Fields{
-								"cache": command.Cache,
-							}).Debug("command: processing http cache with command processor")
-
-							if command.SplitOutput != "" {
-								splitOutput(dataStore, sample["http"].(string), command, startTime)
-							} else {
-								processOutput(dataStore, sample["http"].(string), &dataSample, command, api, &processType)
-							}
+			for _, cache := range load.CacheRead(yml, command.Cache) {
+				switch sample := cache.(type) {
+				case map[string]interface{}:
+					if sample["http"] != nil {
+						load.Logrus.WithFields(logrus.Fields{
+							"cache": command.Cache,
+						}).Debug("command: processing http cache with command processor")
+
+						if command.SplitOutput != "" {
+							splitOutput(dataStore, sample["http"].(string), command, startTime)
+						} else {
+							processOutput(dataStore, sample["http"].(string), &dataSample, command, api, &processType)
 						}
 					}
 				}
 			}
 		} else if command.Dial != "" {
-			NetDialWithTimeout(dataStore, command, &dataSample, api, &processType)
+			NetDialWithTimeout(ctx, dataStore, yml, command, &dataSample, api, &processType)
 		} else if command.ContainerExec != "" {
 			// handle commands against containers
 			if yml.CustomAttributes != nil {
@@ -85,7 +100,7 @@ func RunCommands(dataStore *[]interface{}, yml *load.Config, apiNo int) {
 	}
 }
 
-func commandRun(dataStore *[]interface{}, yml *load.Config, command load.Command, api load.API, startTime int64, dataSample map[string]interface{}, processType string) {
+func commandRun(ctx context.Context, dataStore *[]interface{}, yml *load.Config, command load.Command, api load.API, startTime int64, dataSample map[string]interface{}, processType string) {
 	command.Run = envCommandCheck(command.Run)
 	runCommand := command.Run
 	if command.Output == load.Jmx {
@@ -101,11 +116,11 @@ func commandRun(dataStore *[]interface{}, yml *load.Config, command load.Command
 	}
 
 	// Create a new context and add a timeout to it
-	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	cmdCtx, cancel := context.WithTimeout(ctx, commandTimeout)
 	defer cancel() // The cancel should be deferred so resources are cleaned up
 
 	// Create the command with our context
-	cmd := buildCommand(ctx, api, command)
+	cmd := buildCommand(cmdCtx, api, command)
 
 	// https://golang.org/pkg/os/exec/#Cmd.StdinPipe
 	if load.Args.StdinPipe {
@@ -119,7 +134,17 @@ func commandRun(dataStore *[]interface{}, yml *load.Config, command load.Command
 		}
 	}
 
-	output, err := cmd.CombinedOutput()
+	var output []byte
+	var err error
+	if replaying() {
+		output, err = replayInput(yml, api, fixtureCommand, command.Run)
+	} else {
+		output, err = combinedOutput(ctx, cmd)
+		if recording() {
+			recordInput(yml, api, fixtureCommand, command.Run, output, err)
+		}
+	}
+	countBytes(yml, api, len(output))
 
 	// check if a assertion is defined and successfully passes before continuing, see function for detailed comments
 	if !checkAssertion(command.Assert, output) {
@@ -130,7 +155,7 @@ func commandRun(dataStore *[]interface{}, yml *load.Config, command load.Command
 		return
 	}
 
-	contextError := ctx.Err()
+	contextError := cmdCtx.Err()
 
 	if err != nil || contextError != nil {
 		contextErrorStr := ""
@@ -145,6 +170,17 @@ func commandRun(dataStore *[]interface{}, yml *load.Config, command load.Command
 			"suggestion":  "if you are handling this error case, ignore",
 		}).Debug("command: failed")
 
+		failure := err
+		switch {
+		case contextError != nil && err != nil:
+			failure = fmt.Errorf("%v: %v", contextError, err)
+		case contextError != nil:
+			failure = contextError
+		case len(output) > 0:
+			failure = fmt.Errorf("%v: %s", err, output)
+		}
+		outputs.ErrorSample(yml.Name, api.Name, "commands", failure)
+
 		if command.HideErrorExec {
 			errorSample := map[string]interface{}{
 				"error":         err,
@@ -175,6 +211,27 @@ func commandRun(dataStore *[]interface{}, yml *load.Config, command load.Command
 	}
 }
 
+// combinedOutput runs the command and stops waiting for it once the run is cancelled,
+// the shell is killed but children it started can keep its output open until they exit
+func combinedOutput(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := cmd.CombinedOutput()
+		done <- result{output, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.output, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 // checks if explicitedly enabled log
 func envCommandCheck(commandStr string) string {
 	if load.Args.AllowEnvCommands {
@@ -6,6 +6,7 @@
 package inputs
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -138,7 +139,7 @@ func TestCanRunMultipleCommands(t *testing.T) {
 
 	// when
 	dataStore := []interface{}{}
-	RunCommands(&dataStore, &configFile, 0)
+	RunCommands(context.Background(), &dataStore, &configFile, 0)
 
 	actual := dataStore[0].(map[string]interface{})
 	expected := dataStoreExpected[0].(map[string]interface{})
@@ -174,7 +175,7 @@ func TestDf(t *testing.T) {
 	}
 
 	dataStore := []interface{}{}
-	RunCommands(&dataStore, &config, 0)
+	RunCommands(context.Background(), &dataStore, &config, 0)
 
 	assert.Len(t, dataStore, 3)
 
@@ -210,7 +211,7 @@ func TestDf2(t *testing.T) {
 	}
 
 	dataStore := []interface{}{}
-	RunCommands(&dataStore, &config, 0)
+	RunCommands(context.Background(), &dataStore, &config, 0)
 
 	assert.Len(t, dataStore, 3)
 
@@ -314,10 +315,10 @@ func TestAssert(t *testing.T) {
 	}
 
 	dataStore := []interface{}{}
-	RunCommands(&dataStore, &config, 0)
-	RunCommands(&dataStore, &config, 1)
-	RunCommands(&dataStore, &config, 2)
-	RunCommands(&dataStore, &config, 3)
+	RunCommands(context.Background(), &dataStore, &config, 0)
+	RunCommands(context.Background(), &dataStore, &config, 1)
+	RunCommands(context.Background(), &dataStore, &config, 2)
+	RunCommands(context.Background(), &dataStore, &config, 3)
 
 	assert.Len(t, dataStore, 3)
 
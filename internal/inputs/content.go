@@ -0,0 +1,255 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/newrelic/nri-flex/internal/load"
+	"gopkg.in/yaml.v2"
+)
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// ValidResponseFormat whether the response_format is known, an empty format is detected from the response
+func ValidResponseFormat(format string) bool {
+	if format == "" {
+		return true
+	}
+	for _, known := range load.ResponseFormats {
+		if strings.EqualFold(format, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// responseFormat returns the response_format of the api, otherwise the format of the content type,
+// unless the body doesn't parse as it, and the format sniffed from the body when the content type is unknown
+func responseFormat(api load.API, contentType string, body []byte) string {
+	if api.ResponseFormat != "" {
+		return strings.ToLower(api.ResponseFormat)
+	}
+	declared := mediaTypeFormat(contentType)
+	if declared == "" {
+		return sniffFormat(body)
+	}
+	sniffed := sniffFormat(body)
+	// a body that doesn't parse as anything else is left to fail in the declared format
+	if declared == sniffed || sniffed == load.TypeText || parsesAs(declared, body) {
+		return declared
+	}
+	load.Logrus.Debugf("http: content type %v doesn't match the body, processing it as %v", contentType, sniffed)
+	return sniffed
+}
+
+// parsesAs checks if the body parses as the format, html only needs to be markup as its parser accepts anything
+func parsesAs(format string, body []byte) bool {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(body, utf8BOM))
+	switch format {
+	case load.TypeJSON:
+		return json.Valid(trimmed)
+	case load.TypeNDJSON:
+		_, err := ndjsonToJSON(trimmed)
+		return err == nil
+	case load.TypeXML:
+		return wellFormedXML(trimmed)
+	case load.TypeHTML:
+		return len(trimmed) > 0 && trimmed[0] == '<'
+	case load.TypeCSV:
+		_, err := csv.NewReader(bytes.NewReader(trimmed)).ReadAll()
+		return err == nil
+	case load.TypeYAML:
+		var value interface{}
+		if err := yaml.Unmarshal(trimmed, &value); err != nil {
+			return false
+		}
+		switch value.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			return true
+		}
+	}
+	return false
+}
+
+// wellFormedXML checks if the body is a well formed xml document
+func wellFormedXML(body []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	// the charset of the document doesn't matter to its structure
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	elements := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return elements > 0
+		}
+		if err != nil {
+			return false
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			elements++
+		}
+	}
+}
+
+// mediaTypeFormat returns the format of the content type, ignoring its parameters such as the charset,
+// structured syntax suffixes are used for vendor types eg. application/vnd.api+json
+func mediaTypeFormat(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch mediaType {
+	case "application/json", "text/json":
+		return load.TypeJSON
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines", "application/jsonlines", "application/json-seq":
+		return load.TypeNDJSON
+	case "application/xml", "text/xml":
+		return load.TypeXML
+	case "text/html", "application/xhtml+xml":
+		return load.TypeHTML
+	case "text/csv":
+		return load.TypeCSV
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return load.TypeYAML
+	}
+	switch {
+	case strings.HasSuffix(mediaType, "+json"):
+		return load.TypeJSON
+	case strings.HasSuffix(mediaType, "+xml"):
+		return load.TypeXML
+	case strings.HasSuffix(mediaType, "+yaml"):
+		return load.TypeYAML
+	}
+	return ""
+}
+
+// sniffFormat detects json, json lines, xml and html bodies, anything else is text
+func sniffFormat(body []byte) string {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(body, utf8BOM))
+	if len(trimmed) == 0 {
+		return load.TypeText
+	}
+	if json.Valid(trimmed) {
+		return load.TypeJSON
+	}
+	switch trimmed[0] {
+	case '{', '[', '\x1e':
+		if _, err := ndjsonToJSON(trimmed); err == nil {
+			return load.TypeNDJSON
+		}
+	case '<':
+		if strings.HasPrefix(http.DetectContentType(trimmed), "text/html") {
+			return load.TypeHTML
+		}
+		return load.TypeXML
+	}
+	return load.TypeText
+}
+
+// decodeBody decodes a gzip or deflate body, the transport only decodes the gzip bodies it asked for itself,
+// gzip bodies without a Content-Encoding such as .gz files are detected by their magic number
+func decodeBody(header http.Header, body []byte) ([]byte, error) {
+	var reader io.Reader
+	encoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding")))
+	switch {
+	case encoding == "gzip" || encoding == "x-gzip" || (encoding == "" && len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b):
+		gzipReader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return body, fmt.Errorf("http: failed to decode gzip body: %v", err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case encoding == "deflate":
+		// deflate should be zlib wrapped but some servers send raw deflate
+		zlibReader, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			reader = flate.NewReader(bytes.NewReader(body))
+		} else {
+			defer zlibReader.Close()
+			reader = zlibReader
+		}
+	default:
+		return body, nil
+	}
+	decoded, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return body, fmt.Errorf("http: failed to decode %s body: %v", encoding, err)
+	}
+	return decoded, nil
+}
+
+// ndjsonToJSON converts json lines to a json array of the lines, the record separators of json text sequences are ignored
+func ndjsonToJSON(body []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(bytes.Replace(body, []byte("\x1e"), []byte(" "), -1)))
+	lines := []json.RawMessage{}
+	for {
+		var line json.RawMessage
+		err := decoder.Decode(&line)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("http: failed to decode json line %d: %v", len(lines)+1, err)
+		}
+		lines = append(lines, line)
+	}
+	return json.Marshal(lines)
+}
+
+// yamlToJSON converts a yaml body to json, a body with several documents is converted to an array of the documents
+func yamlToJSON(body []byte) ([]byte, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(body))
+	var documents []interface{}
+	for {
+		var document interface{}
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("http: failed to decode yaml: %v", err)
+		}
+		documents = append(documents, stringKeys(document))
+	}
+	if len(documents) == 1 {
+		return json.Marshal(documents[0])
+	}
+	return json.Marshal(documents)
+}
+
+// stringKeys converts the maps decoded from yaml to maps with string keys so they can be encoded to json
+func stringKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = stringKeys(value)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = stringKeys(value)
+		}
+		return s
+	}
+	return value
+}
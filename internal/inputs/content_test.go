@@ -0,0 +1,193 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestMediaTypeFormat(t *testing.T) {
+	for contentType, format := range map[string]string{
+		"application/json":                 load.TypeJSON,
+		"application/json; charset=utf-8":  load.TypeJSON,
+		"application/vnd.api+json":         load.TypeJSON,
+		"application/problem+json":         load.TypeJSON,
+		"application/x-ndjson":             load.TypeNDJSON,
+		"application/jsonl":                load.TypeNDJSON,
+		"application/xml; charset=UTF-8":   load.TypeXML,
+		"application/atom+xml":             load.TypeXML,
+		"TEXT/XML":                         load.TypeXML,
+		"text/html; charset=iso-8859-1":    load.TypeHTML,
+		"text/csv; header=present":         load.TypeCSV,
+		"application/x-yaml":               load.TypeYAML,
+		"text/plain":                       "",
+		"application/octet-stream":         "",
+		"":                                 "",
+		"application/json; charset=\"utf8": "",
+	} {
+		assert.Equal(t, format, mediaTypeFormat(contentType), contentType)
+	}
+}
+
+func TestSniffFormat(t *testing.T) {
+	for body, format := range map[string]string{
+		`{"a":1}`:                                   load.TypeJSON,
+		"\xef\xbb\xbf [1,2]\n":                      load.TypeJSON,
+		`42`:                                        load.TypeJSON,
+		"{\"a\":1}\n{\"a\":2}\n":                    load.TypeNDJSON,
+		"\x1e{\"a\":1}\n\x1e{\"a\":2}\n":            load.TypeNDJSON,
+		`<?xml version="1.0"?><root>1</root>`:       load.TypeXML,
+		`<root><b>1</b></root>`:                     load.TypeXML,
+		`<!DOCTYPE html><html><body></body></html>`: load.TypeHTML,
+		`{"a":`:      load.TypeText,
+		"a: 1\nb: 2": load.TypeText,
+		"":           load.TypeText,
+	} {
+		assert.Equal(t, format, sniffFormat([]byte(body)), body)
+	}
+}
+
+func TestResponseFormat(t *testing.T) {
+	// the content type is used when the body matches it or can't be sniffed
+	assert.Equal(t, load.TypeJSON, responseFormat(load.API{}, "application/json", []byte(`{"a":1}`)))
+	assert.Equal(t, load.TypeJSON, responseFormat(load.API{}, "application/json", []byte(`{"a":`)))
+	assert.Equal(t, load.TypeYAML, responseFormat(load.API{}, "application/yaml", []byte("a: 1")))
+	assert.Equal(t, load.TypeNDJSON, responseFormat(load.API{}, "application/x-ndjson", []byte(`{"a":1}`)))
+	assert.Equal(t, load.TypeHTML, responseFormat(load.API{}, "text/html", []byte(`<?xml version="1.0"?><html></html>`)))
+	// the body is sniffed when the content type is unknown or doesn't match the body
+	assert.Equal(t, load.TypeJSON, responseFormat(load.API{}, "text/plain", []byte(`{"a":1}`)))
+	assert.Equal(t, load.TypeJSON, responseFormat(load.API{}, "text/html", []byte(`{"a":1}`)))
+	assert.Equal(t, load.TypeNDJSON, responseFormat(load.API{}, "application/json", []byte("{\"a\":1}\n{\"a\":2}")))
+	assert.Equal(t, load.TypeXML, responseFormat(load.API{}, "", []byte(`<status>1</status>`)))
+	// the content type wins when the body parses as it, whatever the body looks like
+	assert.Equal(t, load.TypeXML, responseFormat(load.API{}, "application/xml", []byte(`<!-- generated --><stats><up>1</up></stats>`)))
+	assert.Equal(t, load.TypeHTML, responseFormat(load.API{}, "application/xml", []byte(`<!DOCTYPE html><html><body><br></body></html>`)))
+	assert.Equal(t, load.TypeCSV, responseFormat(load.API{}, "text/csv", []byte("name,value\na,1")))
+	// response_format takes precedence
+	assert.Equal(t, load.TypeText, responseFormat(load.API{ResponseFormat: "TEXT"}, "application/json", []byte(`{"a":1}`)))
+	assert.Equal(t, load.TypeYAML, responseFormat(load.API{ResponseFormat: "yaml"}, "text/plain", []byte("a: 1")))
+
+	assert.True(t, ValidResponseFormat(""))
+	assert.True(t, ValidResponseFormat("NDJSON"))
+	assert.False(t, ValidResponseFormat("protobuf"))
+}
+
+func TestDecodeBody(t *testing.T) {
+	body := []byte(`{"a":1}`)
+	var gzipped, zlibbed, deflated bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, _ = gzipWriter.Write(body)
+	gzipWriter.Close()
+	zlibWriter := zlib.NewWriter(&zlibbed)
+	_, _ = zlibWriter.Write(body)
+	zlibWriter.Close()
+	flateWriter, _ := flate.NewWriter(&deflated, flate.DefaultCompression)
+	_, _ = flateWriter.Write(body)
+	flateWriter.Close()
+
+	for name, test := range map[string]struct {
+		encoding string
+		body     []byte
+	}{
+		"gzip":        {"gzip", gzipped.Bytes()},
+		"gzip magic":  {"", gzipped.Bytes()},
+		"zlib":        {"deflate", zlibbed.Bytes()},
+		"raw deflate": {"Deflate", deflated.Bytes()},
+		"identity":    {"", body},
+	} {
+		decoded, err := decodeBody(http.Header{"Content-Encoding": {test.encoding}}, test.body)
+		require.NoError(t, err, name)
+		assert.Equal(t, body, decoded, name)
+	}
+
+	_, err := decodeBody(http.Header{"Content-Encoding": {"gzip"}}, body)
+	assert.Error(t, err)
+}
+
+func TestYAMLToJSON(t *testing.T) {
+	converted, err := yamlToJSON([]byte("a: 1\nb:\n  c: [x, z]\n  1: one\n"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":1,"b":{"c":["x","z"],"1":"one"}}`, string(converted))
+
+	converted, err = yamlToJSON([]byte("a: 1\n---\na: 2\n"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"a":1},{"a":2}]`, string(converted))
+
+	_, err = yamlToJSON([]byte("a: [1"))
+	assert.Error(t, err)
+}
+
+func TestRunHTTPContentTypes(t *testing.T) {
+	load.Refresh()
+	responses := map[string]struct {
+		contentType string
+		encoding    string
+		body        string
+	}{
+		"/charset":  {"application/json; charset=utf-8", "", `{"status":"ok"}`},
+		"/vendor":   {"application/vnd.api+json", "", `{"status":"ok"}`},
+		"/ndjson":   {"application/x-ndjson", "", "{\"status\":\"ok\"}\n{\"status\":\"ok\"}\n"},
+		"/yaml":     {"application/yaml", "", "status: ok\n"},
+		"/xml":      {"application/xml; charset=utf-8", "", "<status>ok</status>"},
+		"/comment":  {"application/xml", "", "<!-- generated --><status>ok</status>"},
+		"/lying":    {"text/plain", "", `{"status":"ok"}`},
+		"/override": {"text/plain", "", "status: ok\n"},
+		"/gzip":     {"application/json", "gzip", ""},
+	}
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, _ = gzipWriter.Write([]byte(`{"status":"ok"}`))
+	gzipWriter.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		response := responses[request.URL.Path]
+		writer.Header().Set("Content-Type", response.contentType)
+		if response.encoding != "" {
+			writer.Header().Set("Content-Encoding", response.encoding)
+			_, _ = writer.Write(gzipped.Bytes())
+			return
+		}
+		_, _ = writer.Write([]byte(response.body))
+	}))
+	defer server.Close()
+
+	for path := range responses {
+		api := load.API{Name: path, URL: server.URL + path}
+		if path == "/override" {
+			api.ResponseFormat = load.TypeYAML
+		}
+		if path == "/gzip" {
+			// the transport only decodes the responses to its own Accept-Encoding
+			api.Headers = map[string]string{"Accept-Encoding": "gzip"}
+		}
+		config := load.Config{Name: "content", APIs: []load.API{api}}
+		var dataStore []interface{}
+		loop := true
+		reqURL := api.URL
+		RunHTTP(context.Background(), &dataStore, &loop, &config, api, &reqURL)
+
+		expected := 1
+		if path == "/ndjson" {
+			expected = 2
+		}
+		require.Len(t, dataStore, expected, path)
+		for _, sample := range dataStore {
+			assert.Equal(t, "ok", sample.(map[string]interface{})["status"], path)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -19,6 +20,7 @@ import (
 	"time"
 
 	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/outputs"
 	"github.com/sirupsen/logrus"
 
 	"github.com/newrelic/infra-integrations-sdk/data/metric"
@@ -32,8 +34,8 @@ import (
 	//
 )
 
-// ProcessQueries processes database queries
-func ProcessQueries(dataStore *[]interface{}, yml *load.Config, apiNo int) {
+// ProcessQueries processes database queries, running queries are cancelled once the context is done
+func ProcessQueries(ctx context.Context, dataStore *[]interface{}, yml *load.Config, apiNo int) {
 	api := yml.APIs[apiNo]
 
 	load.Logrus.WithFields(logrus.Fields{
@@ -41,6 +43,38 @@ func ProcessQueries(dataStore *[]interface{}, yml *load.Config, apiNo int) {
 		"database": api.Database,
 	}).Debug("database: process queries")
 
+	// recorded queries are replayed without connecting to the database
+	var db *sql.DB
+	if !replaying() {
+		var ok bool
+		if db, ok = connectDatabase(ctx, yml, api); !ok {
+			return
+		}
+	}
+
+	// execute queries async else do synchronously
+	if api.DBAsync {
+		var wg sync.WaitGroup
+		wg.Add(len(api.DBQueries))
+		for _, query := range api.DBQueries {
+			go func(query load.Command) {
+				defer wg.Done()
+				checkAndRunQuery(ctx, db, query, api, yml, dataStore)
+			}(query)
+		}
+		wg.Wait()
+	} else {
+		for _, query := range api.DBQueries {
+			if ctx.Err() != nil {
+				break
+			}
+			checkAndRunQuery(ctx, db, query, api, yml, dataStore)
+		}
+	}
+}
+
+// connectDatabase opens the database and checks the connection
+func connectDatabase(ctx context.Context, yml *load.Config, api load.API) (*sql.DB, bool) {
 	// sql.Open doesn't open the connection, use a generic Ping() to test the connection
 	db, err := sql.Open(setDatabaseDriver(api.Database, api.DBDriver, yml, api), api.DBConn)
 	if err != nil {
@@ -54,14 +88,15 @@ func ProcessQueries(dataStore *[]interface{}, yml *load.Config, apiNo int) {
 		if api.Logging.Open {
 			errorLogToInsights(err, api.Database, api.Name, "")
 		}
-		return
+		outputs.ErrorSample(yml.Name, api.Name, "database", fmt.Errorf("database: %s: unable to connect: %v", api.Database, err))
+		return nil, false
 	}
 
 	// wrapping dbPingWithTimeout out as db.Ping is not reliable currently
 	// https://stackoverflow.com/questions/41618428/golang-ping-succeed-the-second-time-even-if-database-is-down/41619206#41619206
 	var pingError error
 	if db != nil {
-		dbPingWithTimeout(db, &pingError)
+		dbPingWithTimeout(ctx, db, &pingError)
 	}
 
 	if pingError != nil {
@@ -74,28 +109,13 @@ func ProcessQueries(dataStore *[]interface{}, yml *load.Config, apiNo int) {
 		if api.Logging.Open {
 			errorLogToInsights(pingError, api.Database, api.Name, "")
 		}
-		return
-	}
-
-	// execute queries async else do synchronously
-	if api.DBAsync {
-		var wg sync.WaitGroup
-		wg.Add(len(api.DBQueries))
-		for _, query := range api.DBQueries {
-			go func(query load.Command) {
-				defer wg.Done()
-				checkAndRunQuery(db, query, api, yml, dataStore)
-			}(query)
-		}
-		wg.Wait()
-	} else {
-		for _, query := range api.DBQueries {
-			checkAndRunQuery(db, query, api, yml, dataStore)
-		}
+		outputs.ErrorSample(yml.Name, api.Name, "database", fmt.Errorf("database: %s: %v", api.Database, pingError))
+		return nil, false
 	}
+	return db, true
 }
 
-func checkAndRunQuery(db *sql.DB, query load.Command, api load.API, yml *load.Config, dataStore *[]interface{}) {
+func checkAndRunQuery(ctx context.Context, db *sql.DB, query load.Command, api load.API, yml *load.Config, dataStore *[]interface{}) {
 	if query.Name == "" {
 		load.Logrus.WithFields(logrus.Fields{"query": query.Run}).Error("database: query missing name")
 		return
@@ -104,21 +124,59 @@ func checkAndRunQuery(db *sql.DB, query load.Command, api load.API, yml *load.Co
 		load.Logrus.WithFields(logrus.Fields{"name": yml.Name, "database": api.Database}).Error("database: run parameter not defined")
 		return
 	}
-	runQuery(db, query, api, yml, dataStore)
+	runQuery(ctx, db, query, api, yml, dataStore)
 }
 
-func runQuery(db *sql.DB, query load.Command, api load.API, yml *load.Config, dataStore *[]interface{}) {
+func runQuery(ctx context.Context, db *sql.DB, query load.Command, api load.API, yml *load.Config, dataStore *[]interface{}) {
 	queryStartTime := load.TimestampMs()
-	rows, err := db.Query(query.Run)
+
+	var rows []map[string]interface{}
+	var err error
+	if replaying() {
+		rows, err = replayRows(yml, api, query)
+	} else {
+		rows, err = queryRows(ctx, db, query, api, yml)
+		if recording() {
+			recordRows(yml, api, query, rows, err)
+		}
+	}
+	if err != nil {
+		errorLogToInsights(err, api.Database, api.Name, query.Name)
+		outputs.ErrorSample(yml.Name, api.Name, "database", fmt.Errorf("database: %s: query %s failed: %v", api.Database, query.Name, err))
+		return
+	}
+
+	for i, row := range rows {
+		rowSet := map[string]interface{}{
+			"rowIdentifier": query.Name + "_" + strconv.Itoa(i+1),
+			"queryLabel":    query.Name,
+			"event_type":    query.Name,
+		}
+		// apply event type override if set (this is useful to set if needing to group multiples under one event type)
+		if query.EventType != "" {
+			rowSet["event_type"] = query.EventType
+		}
+		for col, value := range row {
+			rowSet[col] = value
+		}
+		queryEndTime := load.TimestampMs()
+		rowSet["flex.QueryStartMs"] = queryStartTime
+		rowSet["flex.QueryTimeMs"] = queryEndTime - queryStartTime
+		*dataStore = append(*dataStore, rowSet)
+		// load.StoreAppend(rowSet)
+	}
+}
+
+// queryRows runs the query and returns the column values of each row
+func queryRows(ctx context.Context, db *sql.DB, query load.Command, api load.API, yml *load.Config) ([]map[string]interface{}, error) {
+	rows, err := db.QueryContext(ctx, query.Run)
 	if err != nil {
 		load.Logrus.WithFields(logrus.Fields{
 			"query":    query.Run,
 			"name":     yml.Name,
 			"database": api.Database,
 		}).Error("database: query failed")
-
-		errorLogToInsights(err, api.Database, api.Name, query.Name)
-		return
+		return nil, err
 	}
 
 	load.Logrus.WithFields(logrus.Fields{
@@ -135,10 +193,7 @@ func runQuery(db *sql.DB, query load.Command, api load.API, yml *load.Config, da
 			"database":   api.Database,
 			"query":      query.Run,
 		}).Debug("database: column return failed")
-
-		errorLogToInsights(err, api.Database, api.Name, query.Name)
-
-		return
+		return nil, err
 	}
 
 	// Use interface{} type instead of original sql.RawBytes, parsing the value ourselves instead of using sql scan convert routine,
@@ -150,41 +205,31 @@ func runQuery(db *sql.DB, query load.Command, api load.API, yml *load.Config, da
 	}
 
 	// Fetch rows
-	rowNo := 1
+	var result []map[string]interface{}
+	size := 0
+	defer func() { countBytes(yml, api, size) }()
 	for rows.Next() {
-		rowSet := map[string]interface{}{
-			"rowIdentifier": query.Name + "_" + strconv.Itoa(rowNo),
-			"queryLabel":    query.Name,
-			"event_type":    query.Name,
-		}
-		// apply event type override if set (this is useful to set if needing to group multiples under one event type)
-		if query.EventType != "" {
-			rowSet["event_type"] = query.EventType
-		}
-
 		// get RawBytes
 		err = rows.Scan(scanArgs...)
 		if err != nil {
 			load.Logrus.WithFields(logrus.Fields{
 				"err": err,
 			}).Error("database: row scan failed")
-			return
+			return result, nil
 		}
+		row := map[string]interface{}{}
 		// Loop through each column
 		for i, col := range values {
 			// If value nil == null
 			if col == nil {
-				rowSet[cols[i]] = ""
+				row[cols[i]] = ""
 			} else {
-				rowSet[cols[i]] = asString(col)
+				value := asString(col)
+				size += len(value)
+				row[cols[i]] = value
 			}
 		}
-		queryEndTime := load.TimestampMs()
-		rowSet["flex.QueryStartMs"] = queryStartTime
-		rowSet["flex.QueryTimeMs"] = queryEndTime - queryStartTime
-		*dataStore = append(*dataStore, rowSet)
-		// load.StoreAppend(rowSet)
-		rowNo++
+		result = append(result, row)
 	}
 	err = rows.Err()
 	if err != nil {
@@ -195,6 +240,33 @@ func runQuery(db *sql.DB, query load.Command, api load.API, yml *load.Config, da
 			"query":      query.Run,
 		}).Debug("database: rows return failed")
 	}
+	return result, nil
+}
+
+// recordRows records the rows of the query as json
+func recordRows(yml *load.Config, api load.API, query load.Command, rows []map[string]interface{}, err error) {
+	body, marshalErr := json.Marshal(rows)
+	if marshalErr != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name":  yml.Name,
+			"query": query.Run,
+		}).WithError(marshalErr).Error("record: failed to marshal rows")
+		return
+	}
+	recordInput(yml, api, fixtureDatabase, query.Run, body, err)
+}
+
+// replayRows returns the recorded rows of the query
+func replayRows(yml *load.Config, api load.API, query load.Command) ([]map[string]interface{}, error) {
+	body, err := replayInput(yml, api, fixtureDatabase, query.Run)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, fmt.Errorf("replay: failed to unmarshal rows of query %s: %v", query.Name, err)
+	}
+	return rows, nil
 }
 
 // setDatabaseDriver returns driver if set, otherwise sets a default driver based on database
@@ -226,6 +298,8 @@ func setDatabaseDriver(database, driver string, yml *load.Config, api load.API)
 
 // errorLogToInsights log errors to insights, useful to debug
 func errorLogToInsights(err error, database, name, queryLabel string) {
+	load.EntityLock.RLock()
+	defer load.EntityLock.RUnlock()
 	errorMetricSet := load.Entity.NewMetricSet(database + "Error")
 
 	load.StatusCounterIncrement("EventCount")
@@ -241,9 +315,7 @@ func errorLogToInsights(err error, database, name, queryLabel string) {
 }
 
 // dbPingWithTimeout Database Ping() with Timeout
-func dbPingWithTimeout(db *sql.DB, pingError *error) {
-	ctx := context.Background()
-
+func dbPingWithTimeout(ctx context.Context, db *sql.DB, pingError *error) {
 	// Create a channel for signal handling
 	c := make(chan struct{})
 	// Define a cancellation after 1s in the context
@@ -252,7 +324,7 @@ func dbPingWithTimeout(db *sql.DB, pingError *error) {
 
 	// Run ping via a goroutine
 	go func() {
-		pingWrapper(db, c, pingError)
+		pingWrapper(ctx, db, c, pingError)
 	}()
 
 	// Listen for signals
@@ -264,8 +336,8 @@ func dbPingWithTimeout(db *sql.DB, pingError *error) {
 	}
 }
 
-func pingWrapper(db *sql.DB, c chan struct{}, pingError *error) {
-	*pingError = db.Ping()
+func pingWrapper(ctx context.Context, db *sql.DB, c chan struct{}, pingError *error) {
+	*pingError = db.PingContext(ctx)
 	c <- struct{}{}
 }
 
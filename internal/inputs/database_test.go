@@ -8,6 +8,7 @@
 package inputs
 
 import (
+	"context"
 	"runtime"
 	"testing"
 
@@ -124,9 +125,9 @@ func TestDatabase(t *testing.T) {
 	}
 
 	dataStore := []interface{}{}
-	ProcessQueries(&dataStore, &config, 0)
-	ProcessQueries(&dataStore, &config, 1)
-	ProcessQueries(&dataStore, &config, 2)
+	ProcessQueries(context.Background(), &dataStore, &config, 0)
+	ProcessQueries(context.Background(), &dataStore, &config, 1)
+	ProcessQueries(context.Background(), &dataStore, &config, 2)
 
 	assert.Lenf(t, dataStore, 4, "expected 4 samples, got %d", len(dataStore))
 
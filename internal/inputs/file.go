@@ -1,6 +1,7 @@
 package inputs
 
 import (
+	"context"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -13,10 +14,23 @@ import (
 )
 
 // ProcessFile read and process the file into data collection.
-func ProcessFile(dataStore *[]interface{}, cfg *load.Config, apiNo int) error {
+func ProcessFile(ctx context.Context, dataStore *[]interface{}, cfg *load.Config, apiNo int) error {
 	file := cfg.APIs[apiNo].File
+	if ctx.Err() != nil {
+		return fmt.Errorf("file input: cancelled before reading file: %v", ctx.Err())
+	}
 
-	b, err := ioutil.ReadFile(file)
+	var b []byte
+	var err error
+	if replaying() {
+		b, err = replayInput(cfg, cfg.APIs[apiNo], fixtureFile, file)
+	} else {
+		b, err = ioutil.ReadFile(file)
+		if recording() {
+			recordInput(cfg, cfg.APIs[apiNo], fixtureFile, file, b, err)
+		}
+	}
+	countBytes(cfg, cfg.APIs[apiNo], len(b))
 	if err != nil {
 		return fmt.Errorf("file input: failed to read file: %v", err)
 	}
@@ -0,0 +1,289 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/sirupsen/logrus"
+)
+
+// Fixture a recorded raw input, replayed in place of the input it was recorded from
+type Fixture struct {
+	Input   string            `json:"input"`             // http, command, file, db, scp or dial
+	Key     string            `json:"key"`               // url, command run, file path, query, host:remote_file or dial address
+	Status  int               `json:"status,omitempty"`  // http status code
+	Headers map[string]string `json:"headers,omitempty"` // http response headers
+	Body    string            `json:"body"`              // response body, command output, file content, query rows as json or dial output
+	Error   string            `json:"error,omitempty"`   // error returned by the input
+}
+
+// FixtureFile the fixtures of an api, stored as <fixtures dir>/<config name>/<api name>.json
+type FixtureFile struct {
+	Config   string    `json:"config"`
+	API      string    `json:"api"`
+	Fixtures []Fixture `json:"fixtures"`
+}
+
+const (
+	fixtureHTTP     = "http"
+	fixtureCommand  = "command"
+	fixtureFile     = "file"
+	fixtureDatabase = "db"
+	fixtureScp      = "scp"
+	fixtureDial     = "dial"
+)
+
+var fixtureNameRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// replay state of the fixtures being replayed, files are read once and repeated keys are replayed in order
+var replay = struct {
+	sync.Mutex
+	dir   string
+	files map[string]*FixtureFile
+	used  map[string]int
+}{}
+
+// record state of the fixtures being recorded, files are rewritten with every recorded input
+var record = struct {
+	sync.Mutex
+	dir   string
+	files map[string]*FixtureFile
+}{}
+
+// StartReplay replays the fixtures of the directory instead of running the inputs
+func StartReplay(dir string) {
+	replay.Lock()
+	defer replay.Unlock()
+	replay.dir = dir
+	replay.files = map[string]*FixtureFile{}
+	replay.used = map[string]int{}
+}
+
+// StopReplay stops replaying fixtures
+func StopReplay() {
+	replay.Lock()
+	defer replay.Unlock()
+	replay.dir = ""
+	replay.files = nil
+	replay.used = nil
+}
+
+func replaying() bool {
+	replay.Lock()
+	defer replay.Unlock()
+	return replay.files != nil
+}
+
+// FixturePath returns the fixture file of an api within the fixtures directory
+func FixturePath(dir string, cfg *load.Config, api load.API) string {
+	cfgName := cfg.Name
+	if cfgName == "" {
+		cfgName = strings.TrimSuffix(cfg.FileName, filepath.Ext(cfg.FileName))
+	}
+	apiName := api.Name
+	if apiName == "" {
+		apiName = api.EventType
+	}
+	return filepath.Join(dir, fixtureName(cfgName), fixtureName(apiName)+".json")
+}
+
+func fixtureName(name string) string {
+	name = fixtureNameRegex.ReplaceAllString(name, "_")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+// replayFixture returns the next fixture recorded for the input and key of the api
+func replayFixture(cfg *load.Config, api load.API, input, key string) (Fixture, error) {
+	replay.Lock()
+	defer replay.Unlock()
+
+	path := FixturePath(replay.dir, cfg, api)
+	file, ok := replay.files[path]
+	if !ok {
+		file = &FixtureFile{}
+		b, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(b, file)
+		}
+		if err != nil {
+			load.Logrus.WithFields(logrus.Fields{
+				"name": cfg.Name,
+				"file": path,
+			}).WithError(err).Error("replay: failed to read fixtures")
+		}
+		replay.files[path] = file
+	}
+
+	var matches []Fixture
+	for _, fixture := range file.Fixtures {
+		if fixture.Input == input && fixture.Key == key {
+			matches = append(matches, fixture)
+		}
+	}
+	if len(matches) == 0 {
+		return Fixture{}, fmt.Errorf("replay: no %s fixture for %s in %s", input, key, path)
+	}
+
+	// repeated requests of the same key replay the fixtures in order, then the last one
+	usedKey := path + "|" + input + "|" + key
+	i := replay.used[usedKey]
+	replay.used[usedKey]++
+	if i >= len(matches) {
+		i = len(matches) - 1
+	}
+	return matches[i], nil
+}
+
+// replayError returns the recorded input error
+func (f Fixture) replayError() error {
+	if f.Error == "" {
+		return nil
+	}
+	return errors.New(f.Error)
+}
+
+// replayHTTP returns the recorded response of the url instead of sending the request
+func replayHTTP(cfg *load.Config, api load.API, reqURL string) (*http.Response, []error) {
+	fixture, err := replayFixture(cfg, api, fixtureHTTP, reqURL)
+	if err != nil {
+		return nil, []error{err}
+	}
+	if err := fixture.replayError(); err != nil {
+		return nil, []error{err}
+	}
+
+	status := fixture.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(fixture.Body)),
+	}
+	for key, value := range fixture.Headers {
+		resp.Header.Set(key, value)
+	}
+	return resp, nil
+}
+
+// replayInput returns the recorded output of any other input instead of running it
+func replayInput(cfg *load.Config, api load.API, input, key string) ([]byte, error) {
+	fixture, err := replayFixture(cfg, api, input, key)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fixture.Body), fixture.replayError()
+}
+
+// StartRecord records the raw output of the inputs into fixtures of the directory, recorded fixtures are reset
+func StartRecord(dir string) {
+	record.Lock()
+	defer record.Unlock()
+	record.dir = dir
+	record.files = map[string]*FixtureFile{}
+}
+
+// StopRecord stops recording fixtures
+func StopRecord() {
+	record.Lock()
+	defer record.Unlock()
+	record.dir = ""
+	record.files = nil
+}
+
+func recording() bool {
+	record.Lock()
+	defer record.Unlock()
+	return record.files != nil
+}
+
+// recordFixture adds the fixture to the fixture file of the api
+func recordFixture(cfg *load.Config, api load.API, fixture Fixture) {
+	record.Lock()
+	defer record.Unlock()
+	if record.files == nil {
+		return
+	}
+
+	path := FixturePath(record.dir, cfg, api)
+	file, ok := record.files[path]
+	if !ok {
+		file = &FixtureFile{Config: cfg.Name, API: api.Name}
+		record.files[path] = file
+	}
+	file.Fixtures = append(file.Fixtures, fixture)
+
+	b, err := json.MarshalIndent(file, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0750)
+	}
+	if err == nil {
+		// recordings can contain credentials or tokens returned by the inputs
+		err = ioutil.WriteFile(path, b, 0600)
+	}
+	if err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name": cfg.Name,
+			"file": path,
+		}).WithError(err).Error("record: failed to write fixtures")
+	}
+}
+
+// recordInput records the output of an input
+func recordInput(cfg *load.Config, api load.API, input, key string, output []byte, err error) {
+	fixture := Fixture{Input: input, Key: key, Body: string(output)}
+	if err != nil {
+		fixture.Error = err.Error()
+	}
+	recordFixture(cfg, api, fixture)
+}
+
+// recordHTTP records the response of the url, the body is read and replaced so it can still be processed
+func recordHTTP(cfg *load.Config, api load.API, reqURL string, resp *http.Response, errs []error) {
+	fixture := Fixture{Input: fixtureHTTP, Key: reqURL}
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	fixture.Error = strings.Join(messages, "; ")
+
+	if resp != nil {
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			load.Logrus.WithFields(logrus.Fields{
+				"name": cfg.Name,
+				"url":  reqURL,
+			}).WithError(err).Error("record: failed to read response")
+		}
+
+		fixture.Status = resp.StatusCode
+		fixture.Body = string(body)
+		fixture.Headers = map[string]string{}
+		for key := range resp.Header {
+			fixture.Headers[key] = resp.Header.Get(key)
+		}
+	}
+	recordFixture(cfg, api, fixture)
+}
@@ -0,0 +1,114 @@
+package inputs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := &load.Config{Name: "replay test"}
+	api := load.API{Name: "pages"}
+	path := FixturePath(dir, cfg, api)
+	assert.Equal(t, filepath.Join(dir, "replay_test", "pages.json"), path)
+
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{
+  "fixtures": [
+    {"input": "http", "key": "http://localhost/page", "body": "first"},
+    {"input": "http", "key": "http://localhost/page", "status": 500, "body": "second"},
+    {"input": "command", "key": "false", "body": "failed", "error": "exit status 1"}
+  ]
+}`), 0644))
+
+	StartReplay(dir)
+	defer StopReplay()
+	assert.True(t, replaying())
+
+	resp, errors := replayHTTP(cfg, api, "http://localhost/page")
+	require.Empty(t, errors)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "first", string(body))
+	assert.Equal(t, 200, resp.StatusCode)
+
+	for i := 0; i < 2; i++ {
+		resp, errors = replayHTTP(cfg, api, "http://localhost/page")
+		require.Empty(t, errors)
+		assert.Equal(t, 500, resp.StatusCode)
+	}
+
+	_, errors = replayHTTP(cfg, api, "http://localhost/other")
+	require.Len(t, errors, 1)
+	assert.Contains(t, errors[0].Error(), "no http fixture for http://localhost/other")
+
+	output, err := replayInput(cfg, api, fixtureCommand, "false")
+	assert.Equal(t, "failed", string(output))
+	assert.EqualError(t, err, "exit status 1")
+
+	StopReplay()
+	assert.False(t, replaying())
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "record")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := &load.Config{
+		Name: "recordTest",
+		APIs: []load.API{
+			{
+				Name:     "commands",
+				Commands: []load.Command{{Run: "echo zHello:World", SplitBy: ":"}},
+			},
+			{
+				Name:      "db",
+				Database:  "postgres",
+				DBConn:    "user=postgres host=localhost",
+				DBQueries: []load.Command{{Name: "users", Run: "select name from users"}},
+			},
+		},
+	}
+
+	StartRecord(dir)
+	var recorded []interface{}
+	RunCommands(context.Background(), &recorded, cfg, 0)
+	recordRows(cfg, cfg.APIs[1], cfg.APIs[1].DBQueries[0], []map[string]interface{}{{"name": "a"}, {"name": "b"}}, nil)
+	StopRecord()
+	require.Len(t, recorded, 1)
+	assert.Equal(t, "World", recorded[0].(map[string]interface{})["zHello"])
+
+	b, err := ioutil.ReadFile(FixturePath(dir, cfg, cfg.APIs[0]))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"key": "echo zHello:World"`)
+
+	StartReplay(dir)
+	defer StopReplay()
+
+	// the replayed command output is processed as if the command ran
+	var replayed []interface{}
+	cfg.APIs[0].Commands = append(cfg.APIs[0].Commands, load.Command{Dial: "localhost:1"})
+	RunCommands(context.Background(), &replayed, cfg, 0)
+	require.Len(t, replayed, 2)
+	assert.Equal(t, "closed", replayed[0].(map[string]interface{})["portStatus"])
+	assert.Contains(t, replayed[0].(map[string]interface{})["err"], "no dial fixture for tcp://localhost:1")
+	assert.Equal(t, "World", replayed[1].(map[string]interface{})["zHello"])
+
+	// queries are replayed without connecting to the database
+	var rows []interface{}
+	ProcessQueries(context.Background(), &rows, cfg, 1)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "b", rows[1].(map[string]interface{})["name"])
+	assert.Equal(t, "users_2", rows[1].(map[string]interface{})["rowIdentifier"])
+}
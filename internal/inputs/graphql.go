@@ -0,0 +1,137 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/outputs"
+	"github.com/sirupsen/logrus"
+)
+
+// graphqlPager tracks the cursor of the pages of a graphql api
+type graphqlPager struct {
+	cursor string
+	pages  int
+}
+
+// payload returns the body of the request for the current page, the cursor variable is set after the first page
+func (p *graphqlPager) payload(graphql load.GraphQL) (string, error) {
+	variables := map[string]interface{}{}
+	for key, value := range graphql.Variables {
+		variables[key] = stringKeys(value)
+	}
+	if p.cursor != "" {
+		variables[graphqlCursorVariable(graphql)] = p.cursor
+	}
+	request := map[string]interface{}{"query": graphql.Query}
+	if len(variables) > 0 {
+		request["variables"] = variables
+	}
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("graphql: failed to encode request: %v", err)
+	}
+	return string(payload), nil
+}
+
+// next reports the errors of the response and returns whether there is a next page,
+// the endCursor of the page is sent with the next request
+func (p *graphqlPager) next(yml *load.Config, api load.API, body []byte) bool {
+	p.pages++
+	var response struct {
+		Data   interface{} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return false
+	}
+	if len(response.Errors) > 0 {
+		var messages []string
+		for _, graphqlError := range response.Errors {
+			messages = append(messages, graphqlError.Message)
+		}
+		err := fmt.Errorf("graphql: %s", strings.Join(messages, ", "))
+		load.Logrus.WithFields(logrus.Fields{
+			"name": yml.Name,
+			"api":  api.Name,
+		}).WithError(err).Error("graphql: query returned errors")
+		outputs.ErrorSample(yml.Name, api.Name, "graphql", err)
+	}
+
+	var pageInfo map[string]interface{}
+	if api.GraphQL.PageInfo != "" {
+		pageInfo, _ = graphqlPath(response.Data, api.GraphQL.PageInfo).(map[string]interface{})
+	} else {
+		pageInfo = graphqlFindPageInfo(response.Data)
+	}
+	hasNextPage, _ := pageInfo["hasNextPage"].(bool)
+	endCursor, _ := pageInfo["endCursor"].(string)
+	if !hasNextPage || endCursor == "" || endCursor == p.cursor {
+		return false
+	}
+	if api.GraphQL.MaxPages > 0 && p.pages >= api.GraphQL.MaxPages {
+		load.Logrus.WithFields(logrus.Fields{
+			"name": yml.Name,
+			"api":  api.Name,
+		}).Debugf("graphql: max pages reached %d", api.GraphQL.MaxPages)
+		return false
+	}
+	p.cursor = endCursor
+	return true
+}
+
+func graphqlCursorVariable(graphql load.GraphQL) string {
+	if graphql.CursorVariable != "" {
+		return graphql.CursorVariable
+	}
+	return "after"
+}
+
+// graphqlPath returns the value at the dot separated path
+func graphqlPath(value interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// graphqlFindPageInfo returns the closest object with a hasNextPage key, the keys of each object are walked in order
+// so the same pageInfo is found on every page
+func graphqlFindPageInfo(data interface{}) map[string]interface{} {
+	queue := []interface{}{data}
+	for len(queue) > 0 {
+		value := queue[0]
+		queue = queue[1:]
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if _, ok := v["hasNextPage"]; ok {
+				return v
+			}
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				queue = append(queue, v[key])
+			}
+		case []interface{}:
+			queue = append(queue, v...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+// graphqlServer serves the issues of a repository two at a time, with a relay connection
+type graphqlServer struct {
+	sync.Mutex
+	issues    []string
+	requests  []map[string]interface{}
+	withError bool
+}
+
+func (s *graphqlServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	var body struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables"`
+	}
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil || body.Query == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.requests = append(s.requests, body.Variables)
+
+	start := 0
+	for _, variable := range []string{"after", "cursor"} {
+		if cursor, ok := body.Variables[variable].(string); ok {
+			fmt.Sscanf(cursor, "cursor-%d", &start)
+		}
+	}
+	end := start + 2
+	if end > len(s.issues) {
+		end = len(s.issues)
+	}
+	var nodes []map[string]interface{}
+	for _, title := range s.issues[start:end] {
+		nodes = append(nodes, map[string]interface{}{"title": title})
+	}
+	response := map[string]interface{}{
+		"data": map[string]interface{}{
+			"repository": map[string]interface{}{
+				"issues": map[string]interface{}{
+					"nodes":    nodes,
+					"pageInfo": map[string]interface{}{"hasNextPage": end < len(s.issues), "endCursor": fmt.Sprintf("cursor-%d", end)},
+				},
+			},
+		},
+	}
+	if s.withError {
+		response["errors"] = []map[string]interface{}{{"message": "rate limited"}}
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(writer).Encode(response)
+}
+
+func runGraphQL(config *load.Config) []interface{} {
+	var dataStore []interface{}
+	loop := true
+	reqURL := config.APIs[0].URL
+	RunHTTP(context.Background(), &dataStore, &loop, config, config.APIs[0], &reqURL)
+	return dataStore
+}
+
+func TestRunHTTPGraphQL(t *testing.T) {
+	load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestRunHTTPGraphQL", "nri-flex")
+
+	graphql := &graphqlServer{issues: []string{"a", "b", "c", "d", "e"}}
+	server := httptest.NewServer(graphql)
+	defer server.Close()
+
+	config := &load.Config{
+		Name: "graphql",
+		APIs: []load.API{{
+			Name: "issues",
+			URL:  server.URL + "/graphql",
+			GraphQL: load.GraphQL{
+				Query:     "query($owner: String!, $after: String) { repository(owner: $owner) { issues(first: 2, after: $after) { nodes { title } pageInfo { hasNextPage endCursor } } } }",
+				Variables: map[string]interface{}{"owner": "newrelic", "labels": []interface{}{map[interface{}]interface{}{"name": "bug"}}},
+			},
+		}},
+	}
+
+	// each page is a sample
+	dataStore := runGraphQL(config)
+	require.Len(t, dataStore, 3)
+	require.Len(t, graphql.requests, 3)
+	assert.Equal(t, map[string]interface{}{"owner": "newrelic", "labels": []interface{}{map[string]interface{}{"name": "bug"}}}, graphql.requests[0])
+	assert.Equal(t, "cursor-2", graphql.requests[1]["after"])
+	assert.Equal(t, "cursor-4", graphql.requests[2]["after"])
+	assert.Equal(t, "newrelic", graphql.requests[2]["owner"])
+
+	// the pages are limited by max_pages, with the cursor in a custom variable and an explicit page_info
+	graphql.requests = nil
+	config.APIs[0].GraphQL.MaxPages = 2
+	config.APIs[0].GraphQL.PageInfo = "repository.issues.pageInfo"
+	config.APIs[0].GraphQL.CursorVariable = "cursor"
+	dataStore = runGraphQL(config)
+	require.Len(t, dataStore, 2)
+	assert.Equal(t, "cursor-2", graphql.requests[1]["cursor"])
+
+	// errors of the query are reported
+	graphql.withError = true
+	runGraphQL(config)
+	var errors []interface{}
+	for _, metricSet := range load.Entity.Metrics {
+		if metricSet.Metrics["input"] == "graphql" {
+			errors = append(errors, metricSet.Metrics["error"])
+		}
+	}
+	assert.Contains(t, errors, "graphql: rate limited")
+}
+
+func TestGraphQLFindPageInfo(t *testing.T) {
+	var data interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"viewer":{"login":"flex","repositories":{"nodes":[{"issues":{"pageInfo":{"hasNextPage":true}}}],"pageInfo":{"hasNextPage":false,"endCursor":"x"}}}}`), &data))
+	assert.Equal(t, map[string]interface{}{"hasNextPage": false, "endCursor": "x"}, graphqlFindPageInfo(data))
+	assert.Nil(t, graphqlFindPageInfo(map[string]interface{}{"a": []interface{}{1}}))
+	assert.Equal(t, "flex", graphqlPath(data, "viewer.login"))
+	assert.Nil(t, graphqlPath(data, "viewer.login.name"))
+}
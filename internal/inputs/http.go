@@ -7,6 +7,7 @@ package inputs
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -20,20 +21,36 @@ import (
 	"time"
 
 	xj "github.com/basgys/goxml2json"
-	"github.com/newrelic/nri-flex/internal/aliyun"
-	"github.com/newrelic/nri-flex/internal/huaweihws"
 	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/outputs"
 	"github.com/parnurzeal/gorequest"
 	"github.com/sirupsen/logrus"
 )
 
-// RunHTTP Executes HTTP Requests
+// gorequest copies its transport onto the client of every request unless the swap is disabled, which would drop
+// the timer of api.Timing. gorequest v0.2.15 has no per request setting for it, the swap is disabled once for the
+// process and RunHTTP sets the client transport of every request itself
+func init() {
+	gorequest.DisableTransportSwap = true
+}
+
+// RunHTTP Executes HTTP Requests, no further pages are requested once the context is done
 // nolint: gocyclo
 // cyclomatic complexity but easy to understand
-func RunHTTP(dataStore *[]interface{}, doLoop *bool, yml *load.Config, api load.API, reqURL *string) {
+func RunHTTP(ctx context.Context, dataStore *[]interface{}, doLoop *bool, yml *load.Config, api load.API, reqURL *string) {
 	load.Logrus.Debugf("%v - running http requests", yml.Name)
+	pager := &graphqlPager{}
+	unixSocket := api.UnixSocket
 	for *doLoop {
+		if ctx.Err() != nil {
+			load.Logrus.WithFields(logrus.Fields{
+				"name": yml.Name,
+				"url":  *reqURL,
+			}).WithError(ctx.Err()).Debug("http: cancelled, skipping remaining requests")
+			break
+		}
 		request := gorequest.New()
+		pageURL := *reqURL
 
 		if api.EscapeURL {
 			*reqURL = url.QueryEscape(*reqURL)
@@ -45,13 +62,35 @@ func RunHTTP(dataStore *[]interface{}, doLoop *bool, yml *load.Config, api load.
 			*reqURL += "/%2f"
 		}
 
-		handlePagination(reqURL, &api.Pagination, nil, nil, 200)
+		handlePagination(reqURL, &api.Pagination, nil, nil, nil, 200)
 		*reqURL = yml.Global.BaseURL + *reqURL
+		// the socket of a unix url is kept for the next pages, their links are sent to the same socket
+		if socket, socketURL, ok := unixSocketURL(*reqURL); ok {
+			unixSocket, *reqURL = socket, socketURL
+		} else if unixSocket != "" {
+			*reqURL = unixSocketRequestURL(*reqURL)
+		}
 		requrl := strings.ToLower(*reqURL)
 		if !strings.HasPrefix(requrl, "http://") && !strings.HasPrefix(requrl, "https://") {
 			*reqURL = "http://" + *reqURL
 		}
+		graphqlPayload := ""
+		if api.GraphQL.Query != "" {
+			payload, err := pager.payload(api.GraphQL)
+			if err != nil {
+				load.Logrus.WithFields(logrus.Fields{
+					"name": yml.Name,
+					"url":  *reqURL,
+				}).WithError(err).Error("http: failed to create graphql request")
+				outputs.ErrorSample(yml.Name, api.Name, "graphql", err)
+				break
+			}
+			graphqlPayload = payload
+		}
 		switch {
+		case graphqlPayload != "":
+			request = request.Post(*reqURL)
+			request = request.Send(graphqlPayload)
 		case api.Method == http.MethodPost && api.Payload != "":
 			request = request.Post(*reqURL)
 			request = request.Send(api.Payload)
@@ -62,10 +101,47 @@ func RunHTTP(dataStore *[]interface{}, doLoop *bool, yml *load.Config, api load.
 			request = request.Get(*reqURL)
 		}
 
-		request = setRequestOptions(request, *yml, api)
+		request = setRequestOptions(ctx, request, *yml, api)
+		if unixSocket != "" {
+			dialUnixSocket(request, unixSocket)
+		}
+		// the transport swap of gorequest is disabled, the client gets the transport of the request, timed when requested
+		timer := newHTTPTimer(api)
+		request.Client.Transport = timer.transport(request.Transport)
 		load.Logrus.Debugf("sending %v request to %v", request.Method, *reqURL)
-		resp, _, errors := request.End()
-		load.StatusCounterIncrement("HttpRequests")
+		var resp gorequest.Response
+		var errors []error
+		if replaying() {
+			resp, errors = replayHTTP(yml, api, *reqURL)
+			load.StatusCounterIncrement("HttpRequests")
+		} else {
+			// requests to unix sockets all go to localhost, their circuits and challenges are kept per socket
+			keyURL := *reqURL
+			if unixSocket != "" {
+				keyURL = unixSocketKeyURL(unixSocket, *reqURL)
+			}
+			breaker := newCircuitBreaker(yml, api, keyURL)
+			if !breaker.allow(time.Now()) {
+				load.Logrus.WithFields(logrus.Fields{
+					"name":    yml.Name,
+					"url":     *reqURL,
+					"circuit": breaker.key,
+				}).Debug("http: circuit open, skipping request")
+				*dataStore = append(*dataStore, map[string]interface{}{
+					"error":   "circuit breaker open",
+					"circuit": breaker.key,
+				})
+				*doLoop = false
+				break
+			}
+			resp, errors = endWithAuth(ctx, request, yml, api, *reqURL, keyURL)
+			resp, errors = retryUnauthorized(ctx, request, yml, api, *reqURL, resp, errors)
+			breaker.record(requestFailed(resp, errors), ctx.Err() != nil, time.Now())
+			if recording() {
+				recordHTTP(yml, api, *reqURL, resp, errors)
+			}
+		}
+		samples := len(*dataStore)
 		if resp != nil {
 			nextLink := ""
 			if resp.Header["Link"] != nil {
@@ -82,95 +158,103 @@ func RunHTTP(dataStore *[]interface{}, doLoop *bool, yml *load.Config, api load.
 			contentType := resp.Header.Get("Content-Type")
 
 			load.Logrus.Debugf("URL: %v Status: %v Code: %d", *reqURL, resp.Status, resp.StatusCode)
+			if resp.StatusCode >= http.StatusBadRequest {
+				outputs.ErrorSample(yml.Name, api.Name, "http", fmt.Errorf("http: %s returned %s", *reqURL, resp.Status))
+			}
+
+			body, err := ioutil.ReadAll(resp.Body)
+			if err == nil {
+				body, err = decodeBody(resp.Header, body)
+			}
+			format := ""
+			if err != nil {
+				load.Logrus.WithFields(logrus.Fields{
+					"err": err,
+				}).Errorf("http: URL %v failed to read resp.Body", *reqURL)
+				outputs.ErrorSample(yml.Name, api.Name, "http", fmt.Errorf("http: failed to read body: %v", err))
+			} else {
+				format = responseFormat(api, contentType, body)
+				if api.Debug {
+					load.Logrus.Debugf("HTTP Debug:\nURL: %v\nFormat: %v\nBody:\n%v\n", *reqURL, format, string(body))
+				}
+			}
+			pageOK := api.Pagination.OriginalURL == "" || (api.Pagination.OriginalURL != "" && resp.StatusCode >= 200 && resp.StatusCode <= 299)
 
 			switch {
 			case api.Prometheus.Enable:
-				Prometheus(dataStore, resp.Body, yml, &api)
-			case contentType == "application/json":
-				body, _ := ioutil.ReadAll(resp.Body)
-				addPage := handlePagination(nil, &api.Pagination, &nextLink, body, resp.StatusCode)
-				if api.Debug {
-					load.Logrus.Debugf("HTTP Debug:\nURL: %v\nBody:\n%v\n", *reqURL, string(body))
+				Prometheus(dataStore, bytes.NewReader(body), yml, &api)
+			case err != nil:
+				// the failure was reported above
+			case format == load.TypeJSON:
+				addPage := handlePagination(nil, &api.Pagination, &nextLink, body, resp.Header, resp.StatusCode)
+				if api.GraphQL.Query != "" {
+					// the next page is the same query with the cursor of this page
+					nextLink = ""
+					if pager.next(yml, api, body) {
+						nextLink = pageURL
+					}
 				}
 				// if not using pagination handle json for any response, if using pagination check the status code before storing
-				if api.Pagination.OriginalURL == "" || (api.Pagination.OriginalURL != "" && resp.StatusCode >= 200 && resp.StatusCode <= 299) && addPage {
-					handleJSON(dataStore, body, &resp, doLoop, reqURL, nextLink, api.ReturnHeaders)
+				if pageOK && addPage {
+					if err := handleJSON(dataStore, body, &resp, doLoop, reqURL, nextLink, api.ReturnHeaders); err != nil {
+						outputs.ErrorSample(yml.Name, api.Name, "http", err)
+					}
+				}
+			case format == load.TypeNDJSON || format == load.TypeYAML:
+				// converted to json, json lines are an array of samples
+				convert := ndjsonToJSON
+				if format == load.TypeYAML {
+					convert = yamlToJSON
+				}
+				jsonBody, err := convert(body)
+				if err != nil {
+					load.Logrus.WithError(err).Errorf("http: URL %v failed to convert %v to Json resp.Body", *reqURL, format)
+					outputs.ErrorSample(yml.Name, api.Name, "http", err)
+				} else if pageOK {
+					if err := handleJSON(dataStore, jsonBody, &resp, doLoop, reqURL, nextLink, api.ReturnHeaders); err != nil {
+						outputs.ErrorSample(yml.Name, api.Name, "http", err)
+					}
 				}
-			case contentType == "text/xml" || contentType == "application/xml":
-				jsonBody, err := xj.Convert(resp.Body)
+			case format == load.TypeXML:
+				jsonBody, err := xj.Convert(bytes.NewReader(body))
 				if err != nil {
 					load.Logrus.WithError(err).Errorf("http: URL %v failed to convert XML to Json resp.Body", *reqURL)
+					outputs.ErrorSample(yml.Name, api.Name, "http", fmt.Errorf("http: failed to convert XML to JSON: %v", err))
 				} else {
-					if api.Pagination.OriginalURL == "" || (api.Pagination.OriginalURL != "" && resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+					if pageOK {
 						handleJSON(dataStore, jsonBody.Bytes(), &resp, doLoop, reqURL, nextLink, api.ReturnHeaders)
 					}
 				}
-			case (contentType == "text/html" || contentType == "text/html; charset=utf-8") && api.ParseHTML:
-				body, _ := ioutil.ReadAll(resp.Body)
+			case format == load.TypeHTML && (api.ParseHTML || api.ResponseFormat != ""):
 				jsonBody, err := ParseToJSON(body)
 				if err != nil {
 					load.Logrus.WithError(err).Errorf("http: URL %v failed to convert XML to Json resp.Body", *reqURL)
+					outputs.ErrorSample(yml.Name, api.Name, "http", fmt.Errorf("http: failed to convert HTML to JSON: %v", err))
 				} else {
-					if api.Pagination.OriginalURL == "" || (api.Pagination.OriginalURL != "" && resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+					if pageOK {
 						handleJSON(dataStore, []byte(jsonBody), &resp, doLoop, reqURL, nextLink, api.ReturnHeaders)
 					}
 				}
-			case contentType == "text/csv":
-				body, _ := ioutil.ReadAll(resp.Body)
+			case format == load.TypeCSV:
 				stringBody := string(body)
 				err := processCsv(dataStore, "", "", &stringBody, api.SetHeader)
 				if err != nil {
 					load.Logrus.WithError(err).Errorf("http: URL %v failed to process text/csv body resp.Body", *reqURL)
+					outputs.ErrorSample(yml.Name, api.Name, "http", fmt.Errorf("http: failed to parse csv: %v", err))
 				}
 
 			default:
-				// some apis do not specify a content-type header, if not set attempt to detect if the payload is json
-				body, err := ioutil.ReadAll(resp.Body)
-				addPage := handlePagination(nil, &api.Pagination, &nextLink, body, resp.StatusCode)
-
-				if err != nil {
-					load.Logrus.WithFields(logrus.Fields{
-						"err": err,
-					}).Errorf("http: URL %v failed to read resp.Body", *reqURL)
-				} else {
-					strBody := string(body)
-					if api.Debug {
-						load.Logrus.Debugf("HTTP Debug:\nURL: %v\nBody:\n%v\n", *reqURL, strBody)
-					}
-					output, _ := detectCommandOutput(strBody, "")
-					switch output {
-					case load.TypeJSON:
-						// if not using pagination handle json for any response, if using pagination check the status code before storing
-						if api.Pagination.OriginalURL == "" || (api.Pagination.OriginalURL != "" && resp.StatusCode >= 200 && resp.StatusCode <= 299) && addPage {
-							handleJSON(dataStore, body, &resp, doLoop, reqURL, nextLink, api.ReturnHeaders)
-						}
-						// if it is XML, convert XML to JSON and process it
-					case load.TypeXML:
-						xmlBody := strings.NewReader(strBody)
-						jsonBody, err := xj.Convert(xmlBody)
-
-						if err != nil {
-							load.Logrus.WithFields(logrus.Fields{
-								"err": err,
-							}).Errorf("http: URL %v failed to convert XML to Json resp.Body", *reqURL)
-						} else {
-							if api.Pagination.OriginalURL == "" || (api.Pagination.OriginalURL != "" && resp.StatusCode >= 200 && resp.StatusCode <= 299) && addPage {
-								handleJSON(dataStore, jsonBody.Bytes(), &resp, doLoop, reqURL, nextLink, api.ReturnHeaders)
-							}
-						}
-					default:
-						load.Logrus.Debugf("%v - unsupported payload format: ContentType: %v", api.URL, contentType)
-						load.Logrus.Debugf("%v - storing unknown http output into datastore", api.URL)
+				// apis without a known content type, and whose body isn't json, xml or html, are stored as text
+				load.Logrus.Debugf("%v - unsupported payload format: ContentType: %v", api.URL, contentType)
+				load.Logrus.Debugf("%v - storing unknown http output into datastore", api.URL)
 
-						if yml.Datastore == nil {
-							yml.Datastore = map[string][]interface{}{}
-						}
-						yml.Datastore[api.URL] = []interface{}{
-							map[string]interface{}{
-								"http": strBody,
-							},
-						}
-					}
+				if yml.Datastore == nil {
+					yml.Datastore = map[string][]interface{}{}
+				}
+				yml.Datastore[api.URL] = []interface{}{
+					map[string]interface{}{
+						"http": string(body),
+					},
 				}
 			}
 
@@ -195,24 +279,76 @@ func RunHTTP(dataStore *[]interface{}, doLoop *bool, yml *load.Config, api load.
 				}
 			}
 
+			if len(errors) > 0 {
+				outputs.ErrorSample(yml.Name, api.Name, "http", errors[0])
+			}
 			*dataStore = append(*dataStore, httpErrorSample)
 			*doLoop = false
 		}
+		timer.addTo((*dataStore)[samples:])
+		timer.sample(yml, api, *reqURL, resp)
 	}
 }
 
+// countBytes adds the bytes received by the input to the stats of the api
+func countBytes(yml *load.Config, api load.API, n int) {
+	load.APIStatsUpdate(yml, api.Name, func(stats *load.APIStats) {
+		stats.Bytes += int64(n)
+	})
+}
+
+// httpTLSConfig the TLS config of the api, the api tls_config takes precedence over the global one,
+// its ca is added to the global ca. Shared by the requests and the oauth2 token client
+func httpTLSConfig(yml *load.Config, api load.API) *tls.Config {
+	rootCAs := x509.NewCertPool()
+	tlsConfig := loadTLSConfig(yml.Global.TLSConfig, rootCAs)
+	if api.TLSConfig.Enable {
+		tlsConfig = loadTLSConfig(api.TLSConfig, rootCAs)
+	}
+	return tlsConfig
+}
+
+func loadTLSConfig(settings load.TLSConfig, rootCAs *x509.CertPool) *tls.Config {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: settings.InsecureSkipVerify, // nolint: gosec
+		MinVersion:         settings.MinVersion,
+		MaxVersion:         settings.MaxVersion,
+	}
+
+	if settings.Ca != "" {
+		ca, err := ioutil.ReadFile(settings.Ca)
+		if err != nil {
+			load.Logrus.WithError(err).Error("http: failed to read ca")
+		} else {
+			rootCAs.AppendCertsFromPEM(ca)
+			tlsConfig.RootCAs = rootCAs
+		}
+	}
+
+	if settings.Key != "" && settings.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(settings.Cert, settings.Key)
+		if err != nil {
+			load.Logrus.WithError(err).Error("http: failed to load x509 keypair")
+		} else {
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+	return tlsConfig
+}
+
 // setRequestOptions
 // Sets global config for all APIs/Endpoints
 // However, nested configs that are defined will take precedence over global config
-func setRequestOptions(request *gorequest.SuperAgent, yml load.Config, api load.API) *gorequest.SuperAgent {
-	rootCAs := x509.NewCertPool()
+func setRequestOptions(ctx context.Context, request *gorequest.SuperAgent, yml load.Config, api load.API) *gorequest.SuperAgent {
 	if yml.Global.Timeout > 0 {
 		request = request.Timeout(time.Duration(yml.Global.Timeout) * time.Millisecond)
 	}
 	if yml.Global.Proxy != "" {
 		request = request.Proxy(yml.Global.Proxy)
 	}
-	if yml.Global.User != "" {
+	// digest and ntlm answer the challenge of the server when the request is sent
+	handshake := newHTTPAuth(&yml, api).handshake()
+	if yml.Global.User != "" && !handshake {
 		request = request.SetBasicAuth(yml.Global.User, yml.Global.Pass)
 	}
 	for h, v := range yml.Global.Headers {
@@ -224,117 +360,43 @@ func setRequestOptions(request *gorequest.SuperAgent, yml load.Config, api load.
 	if api.Proxy != "" {
 		request = request.Proxy(api.Proxy)
 	}
-	if api.User != "" {
+	if api.User != "" && !handshake {
 		request = request.SetBasicAuth(api.User, api.Pass)
 	}
 	for h, v := range api.Headers {
 		request = request.Set(h, v)
 	}
-
-	tmpGlobalTLSConfig := tls.Config{
-		InsecureSkipVerify: yml.Global.TLSConfig.InsecureSkipVerify,
-		MinVersion:         yml.Global.TLSConfig.MinVersion,
-		MaxVersion:         yml.Global.TLSConfig.MaxVersion,
-	}
-
-	if yml.Global.TLSConfig.Ca != "" {
-		ca, err := ioutil.ReadFile(yml.Global.TLSConfig.Ca)
-		if err != nil {
-			load.Logrus.WithError(err).Error("http: failed to read ca")
-		} else {
-			rootCAs.AppendCertsFromPEM(ca)
-			tmpGlobalTLSConfig.RootCAs = rootCAs
-		}
-	}
-
-	if yml.Global.TLSConfig.Key != "" && yml.Global.TLSConfig.Cert != "" {
-		cert, err := tls.LoadX509KeyPair(yml.Global.TLSConfig.Cert, yml.Global.TLSConfig.Key)
-		if err != nil {
-			load.Logrus.WithError(err).Error("http: failed to load x509 keypair")
-		} else {
-			tmpGlobalTLSConfig.Certificates = []tls.Certificate{cert}
+	if source := newOAuth2Source(&yml, api); source != nil && !replaying() {
+		if err := source.authorize(ctx, request, ""); err != nil {
+			load.Logrus.WithFields(logrus.Fields{
+				"name": yml.Name,
+			}).WithError(err).Error("http: failed to get oauth2 token")
+			outputs.ErrorSample(yml.Name, api.Name, "oauth2", err)
 		}
 	}
 
-	request = request.TLSClientConfig(&tmpGlobalTLSConfig)
-
-	if api.TLSConfig.Enable {
-		tmpAPITLSConfig := tls.Config{
-			InsecureSkipVerify: api.TLSConfig.InsecureSkipVerify,
-			MinVersion:         api.TLSConfig.MinVersion,
-			MaxVersion:         api.TLSConfig.MaxVersion,
-		}
-
-		if api.TLSConfig.Ca != "" {
-			ca, err := ioutil.ReadFile(api.TLSConfig.Ca)
-			if err != nil {
-				load.Logrus.WithError(err).Error("http: failed to read ca")
-			} else {
-				rootCAs.AppendCertsFromPEM(ca)
-				tmpAPITLSConfig.RootCAs = rootCAs
-			}
-		}
+	request = request.TLSClientConfig(httpTLSConfig(&yml, api))
 
-		if api.TLSConfig.Key != "" && api.TLSConfig.Cert != "" {
-			cert, err := tls.LoadX509KeyPair(api.TLSConfig.Cert, api.TLSConfig.Key)
-			if err != nil {
-				load.Logrus.WithError(err).Error("http: failed to load x509 keypair")
-			} else {
-				tmpAPITLSConfig.Certificates = []tls.Certificate{cert}
-			}
-		}
-
-		request = request.TLSClientConfig(&tmpAPITLSConfig)
+	if replaying() {
+		return request
 	}
-
-	if api.AliyunSigner.Key != "" && api.AliyunSigner.Secret != "" {
-		signer := aliyun.Signer{
-			Key:    api.AliyunSigner.Key,
-			Secret: api.AliyunSigner.Secret,
-		}
-		r, err := request.MakeRequest()
-		if err != nil {
-			load.Logrus.WithError(err).Error("http: signer failed to convert request for AliyunSigner.")
-		} else {
-			signerdURL, err := signer.Sign(r)
-			if err != nil {
-				load.Logrus.WithError(err).Error("http: signer failed to sign the request.")
-			} else {
-				request.Url = signerdURL
-			}
-		}
-	}
-
-	if api.HWSigner.Key != "" && api.HWSigner.Secret != "" {
-		signer := huaweihws.Signer{
-			Key:    api.HWSigner.Key,
-			Secret: api.HWSigner.Secret,
-		}
-		r, err := request.MakeRequest()
-		if err != nil {
-			load.Logrus.WithError(err).Error("http: signer failed to convert request for HWSigner.")
-		} else {
-			err := signer.Sign(r)
-			if err != nil {
-				load.Logrus.WithError(err).Error("http: signer failed to sign the request.")
-			} else {
-				request = request.Set(huaweihws.HeaderAuthorization, r.Header.Get(huaweihws.HeaderAuthorization))
-				request = request.Set(huaweihws.HeaderXDate, r.Header.Get(huaweihws.HeaderXDate))
-			}
-
-		}
+	if err := signRequest(request, api); err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name": yml.Name,
+		}).WithError(err).Error("http: failed to sign the request")
+		outputs.ErrorSample(yml.Name, api.Name, "signer", err)
 	}
 	return request
 }
 
-// handleJSON Process JSON Payload
-func handleJSON(sample *[]interface{}, body []byte, resp *gorequest.Response, doLoop *bool, url *string, nextLink string, includeHeaders bool) {
+// handleJSON Process JSON Payload, returns the error when the body isn't valid json
+func handleJSON(sample *[]interface{}, body []byte, resp *gorequest.Response, doLoop *bool, url *string, nextLink string, includeHeaders bool) error {
 	var b interface{}
 	err := json.Unmarshal(body, &b)
 
 	if err != nil {
 		load.Logrus.WithError(err).Error("http: failed to unmarshal json")
-		return
+		return fmt.Errorf("http: failed to unmarshal json: %v", err)
 	}
 
 	var cb responseBody
@@ -362,9 +424,10 @@ func handleJSON(sample *[]interface{}, body []byte, resp *gorequest.Response, do
 	}
 
 	*sample = append(*sample, ds.build()...)
+	return nil
 }
 
-func handlePagination(url *string, Pagination *load.Pagination, nextLink *string, body []byte, code int) bool {
+func handlePagination(url *string, Pagination *load.Pagination, nextLink *string, body []byte, header http.Header, code int) bool {
 	if url != nil && strings.Contains(*url, "${page}") && (code >= 200 && code <= 299) {
 		(*Pagination).OriginalURL = *url
 		(*Pagination).NoPages = 1
@@ -376,7 +439,7 @@ func handlePagination(url *string, Pagination *load.Pagination, nextLink *string
 		*url = strings.Replace(*url, "${limit}", fmt.Sprintf("%d", Pagination.PageLimit), -1)
 		load.Logrus.Debugf("URL: %v begin pagination handling", *url)
 	} else if Pagination.OriginalURL != "" && nextLink != nil && (code >= 200 && code <= 299) {
-		if Pagination.MaxPages == 0 && Pagination.PageLimitKey == "" && Pagination.PayloadKey == "" {
+		if Pagination.MaxPages == 0 && Pagination.PageLimitKey == "" && Pagination.PayloadKey == "" && !usesPaginationPaths(Pagination) {
 			link := ""
 			if url != nil {
 				link = *url
@@ -463,6 +526,39 @@ func handlePagination(url *string, Pagination *load.Pagination, nextLink *string
 				}
 			}
 
+			total := -1
+			if usesPaginationPaths(Pagination) {
+				page, err := paginationPaths(Pagination, body, header)
+				if err != nil {
+					load.Logrus.WithFields(logrus.Fields{
+						"err": err,
+					}).Error("http: pagination failed")
+					*nextLink = ""
+					return true
+				}
+				// the last page has no cursor or link, or an empty payload
+				if page.empty || (Pagination.MaxPages > 0 && Pagination.NoPages >= Pagination.MaxPages) ||
+					(Pagination.NextCursorPath != "" && (page.cursor == "" || page.cursor == Pagination.CursorMarker)) ||
+					(Pagination.NextLinkPath != "" && page.link == "") {
+					load.Logrus.Debugf("URL: %v last page, max pages %d, payload empty %v", *nextLink, Pagination.MaxPages, page.empty)
+					*nextLink = ""
+					return !page.empty
+				}
+				if page.hasNext {
+					Pagination.PageMarker = page.pageNext
+					customPageMarker = true
+				}
+				if page.cursor != "" {
+					nextCursor = page.cursor
+					Pagination.CursorMarker = page.cursor
+				}
+				if page.link != "" {
+					manualNextLink = page.link
+				}
+				total = page.total
+				Pagination.NoPages++
+			}
+
 			if (Pagination.PageMarker >= Pagination.MaxPages && Pagination.PayloadKey == "" && payloadKeyFound) || (Pagination.PayloadKey != "" && payloadKeyFound && payloadEmpty) {
 				load.Logrus.Debugf("URL: %v max pages reached %d or payload empty %v", *nextLink, Pagination.MaxPages, payloadEmpty)
 				*nextLink = ""
@@ -474,6 +570,11 @@ func handlePagination(url *string, Pagination *load.Pagination, nextLink *string
 					(*Pagination).PageMarker = (*Pagination).PageMarker + (*Pagination).Increment
 					page = fmt.Sprintf("%d", (*Pagination).PageMarker)
 				}
+				if total >= 0 && Pagination.PageMarker >= total {
+					load.Logrus.Debugf("URL: %v total reached %d", *nextLink, total)
+					*nextLink = ""
+					return true
+				}
 				if nextCursor != "" {
 					page = nextCursor
 				}
@@ -6,7 +6,9 @@
 package inputs
 
 import (
+	"context"
 	"fmt"
+	"github.com/newrelic/infra-integrations-sdk/integration"
 	"github.com/parnurzeal/gorequest"
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
@@ -225,7 +227,7 @@ func TestRunHttp(t *testing.T) {
 			tc.config.Global.BaseURL = ts.URL
 
 			var dataStore []interface{}
-			RunHTTP(&dataStore, &doLoop, &tc.config, tc.config.APIs[0], &tc.config.APIs[0].URL)
+			RunHTTP(context.Background(), &dataStore, &doLoop, &tc.config, tc.config.APIs[0], &tc.config.APIs[0].URL)
 			assertElementsMatch(t, dataStore, tc.expected)
 		})
 	}
@@ -269,7 +271,7 @@ func TestRunHttp_withPagination(t *testing.T) {
 
 	config.Global.BaseURL = httpHandler.URL
 
-	RunHTTP(&dataStore, &loop, &config, config.APIs[0], &config.APIs[0].URL)
+	RunHTTP(context.Background(), &dataStore, &loop, &config, config.APIs[0], &config.APIs[0].URL)
 
 	assert.Equal(t, expectedDataQuantity, len(dataStore))
 }
@@ -342,3 +344,28 @@ func (h *mockHttpHandler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		load.Logrus.WithError(err).Error("http: failed to write")
 	}
 }
+
+func TestRunHTTPErrorSample(t *testing.T) {
+	load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestRunHTTPErrorSample", "nri-flex")
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, err := writer.Write([]byte(`{"error":"unauthorized"}`))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+
+	config := load.Config{Name: "errors", APIs: []load.API{{Name: "status", URL: server.URL + "/?token=abc"}}}
+	var dataStore []interface{}
+	loop := true
+	RunHTTP(context.Background(), &dataStore, &loop, &config, config.APIs[0], &config.APIs[0].URL)
+
+	require.Len(t, load.Entity.Metrics, 1)
+	metrics := load.Entity.Metrics[0].Metrics
+	assert.Equal(t, "flexErrorSample", metrics["event_type"])
+	assert.Equal(t, "auth", metrics["errorClass"])
+	assert.Equal(t, fmt.Sprintf("http: %s/?token=<redacted> returned 401 Unauthorized", server.URL), metrics["error"])
+}
@@ -0,0 +1,478 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5" // nolint: gosec
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/parnurzeal/gorequest"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/md4" // nolint: staticcheck
+)
+
+// Auth types of http requests
+const (
+	authTypeBasic  = "basic"
+	authTypeDigest = "digest"
+	authTypeNTLM   = "ntlm"
+)
+
+// httpAuth the user and pass of an api and how they authenticate its requests
+type httpAuth struct {
+	authType string
+	user     string
+	pass     string
+}
+
+// newHTTPAuth returns the auth of the api, user and pass of the api override the global ones
+func newHTTPAuth(yml *load.Config, api load.API) httpAuth {
+	auth := httpAuth{authType: strings.ToLower(yml.Global.AuthType), user: yml.Global.User, pass: yml.Global.Pass}
+	if api.AuthType != "" {
+		auth.authType = strings.ToLower(api.AuthType)
+	}
+	if api.User != "" {
+		auth.user, auth.pass = api.User, api.Pass
+	}
+	if auth.authType == "" {
+		auth.authType = authTypeBasic
+	}
+	return auth
+}
+
+// handshake whether the auth needs a challenge from the server, basic auth is set by setRequestOptions
+func (a httpAuth) handshake() bool {
+	return a.user != "" && (a.authType == authTypeDigest || a.authType == authTypeNTLM)
+}
+
+// endWithAuth sends the request, answering the digest or ntlm challenge of the server when the api uses them,
+// the challenges are kept per host of the key url
+func endWithAuth(ctx context.Context, request *gorequest.SuperAgent, yml *load.Config, api load.API, reqURL string, keyURL string) (gorequest.Response, []error) {
+	auth := newHTTPAuth(yml, api)
+	if !auth.handshake() {
+		return endWithRetries(ctx, request, yml, api, reqURL)
+	}
+
+	switch auth.authType {
+	case authTypeDigest:
+		return endWithDigest(ctx, request, yml, api, reqURL, keyURL, auth)
+	default:
+		return endWithNTLM(ctx, request, yml, api, reqURL, auth)
+	}
+}
+
+// authChallenge returns the challenge of the scheme sent by the server in a 401 response, false if there is none
+func authChallenge(resp gorequest.Response, scheme string) (string, bool) {
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		return "", false
+	}
+	for _, value := range resp.Header["Www-Authenticate"] {
+		if strings.EqualFold(value, scheme) {
+			return "", true
+		}
+		if len(value) > len(scheme) && strings.EqualFold(value[:len(scheme)+1], scheme+" ") {
+			return strings.TrimSpace(value[len(scheme)+1:]), true
+		}
+	}
+	return "", false
+}
+
+// digestChallenges last digest challenge of each host and user, reused for the next requests
+// such as pages and lookups so they don't each need a challenge
+var digestChallenges = struct {
+	sync.Mutex
+	challenges map[string]*digestChallenge
+}{challenges: map[string]*digestChallenge{}}
+
+// digestChallenge a digest challenge sent by the server
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string // auth when offered by the server, empty for the original rfc 2069 digest
+	count     int    // requests sent with the nonce
+}
+
+func endWithDigest(ctx context.Context, request *gorequest.SuperAgent, yml *load.Config, api load.API, reqURL string, keyURL string, auth httpAuth) (gorequest.Response, []error) {
+	key := requestHost(keyURL) + "|" + auth.user
+	digestChallenges.Lock()
+	cached := digestChallenges.challenges[key]
+	var authorization string
+	if cached != nil {
+		authorization = cached.authorize(request.Method, reqURL, auth.user, auth.pass)
+	}
+	digestChallenges.Unlock()
+	if authorization != "" {
+		request.Set("Authorization", authorization)
+	}
+
+	resp, errs := endWithRetries(ctx, request, yml, api, reqURL)
+	params, ok := authChallenge(resp, "Digest")
+	if !ok || ctx.Err() != nil {
+		return resp, errs
+	}
+	challenge, err := parseDigestChallenge(params)
+	if err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name": yml.Name,
+			"url":  reqURL,
+		}).WithError(err).Error("http: invalid digest challenge")
+		return resp, errs
+	}
+	if authorization != "" && !strings.EqualFold(challenge.params["stale"], "true") && challenge.nonce == cached.nonce {
+		// the server rejected the credentials themselves
+		return resp, errs
+	}
+
+	digestChallenges.Lock()
+	digestChallenges.challenges[key] = &challenge.digestChallenge
+	authorization = challenge.authorize(request.Method, reqURL, auth.user, auth.pass)
+	digestChallenges.Unlock()
+	load.Logrus.WithFields(logrus.Fields{
+		"name":  yml.Name,
+		"url":   reqURL,
+		"realm": challenge.realm,
+	}).Debug("http: answering digest challenge")
+	request.Set("Authorization", authorization)
+	return endWithRetries(ctx, request, yml, api, reqURL)
+}
+
+// parsedDigestChallenge a digest challenge and all of its parameters
+type parsedDigestChallenge struct {
+	digestChallenge
+	params map[string]string
+}
+
+func parseDigestChallenge(challenge string) (parsedDigestChallenge, error) {
+	params := parseAuthParams(challenge)
+	parsed := parsedDigestChallenge{
+		digestChallenge: digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+		},
+		params: params,
+	}
+	if parsed.nonce == "" {
+		return parsed, fmt.Errorf("http: digest challenge without a nonce")
+	}
+	switch strings.ToUpper(parsed.algorithm) {
+	case "", "MD5", "MD5-SESS", "SHA-256", "SHA-256-SESS":
+	default:
+		return parsed, fmt.Errorf("http: unsupported digest algorithm %s", parsed.algorithm)
+	}
+	if qop, ok := params["qop"]; ok {
+		for _, offered := range strings.Split(qop, ",") {
+			if strings.TrimSpace(offered) == "auth" {
+				parsed.qop = "auth"
+			}
+		}
+		if parsed.qop == "" {
+			return parsed, fmt.Errorf("http: unsupported digest qop %s", qop)
+		}
+	}
+	return parsed, nil
+}
+
+// parseAuthParams parses the comma separated key=value and key="value" parameters of a challenge
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for s != "" {
+		s = strings.TrimLeft(s, " \t,")
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		var value strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i < len(s) {
+				i++ // closing quote
+			}
+			s = s[i:]
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(strings.TrimSpace(s[:end]))
+			s = s[end:]
+		}
+		params[key] = value.String()
+	}
+	return params
+}
+
+// authorize returns the authorization header answering the challenge, the caller holds the digestChallenges lock
+func (c *digestChallenge) authorize(method, reqURL, user, pass string) string {
+	c.count++
+	cnonce := make([]byte, 8)
+	_, _ = rand.Read(cnonce)
+	return c.authorization(method, requestURI(reqURL), user, pass, hex.EncodeToString(cnonce))
+}
+
+func (c *digestChallenge) authorization(method, uri, user, pass, cnonce string) string {
+	algorithm := strings.ToUpper(c.algorithm)
+	var h func() hash.Hash = md5.New
+	if strings.HasPrefix(algorithm, "SHA-256") {
+		h = sha256.New
+	}
+	digest := func(s string) string {
+		hash := h()
+		hash.Write([]byte(s))
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+
+	nc := fmt.Sprintf("%08x", c.count)
+	ha1 := digest(user + ":" + c.realm + ":" + pass)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = digest(ha1 + ":" + c.nonce + ":" + cnonce)
+	}
+	ha2 := digest(method + ":" + uri)
+	response := digest(ha1 + ":" + c.nonce + ":" + ha2)
+	if c.qop != "" {
+		response = digest(ha1 + ":" + c.nonce + ":" + nc + ":" + cnonce + ":" + c.qop + ":" + ha2)
+	}
+
+	authorization := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`, quote(user), quote(c.realm), quote(c.nonce), quote(uri), response)
+	if c.algorithm != "" {
+		authorization += ", algorithm=" + c.algorithm
+	}
+	if c.opaque != "" {
+		authorization += fmt.Sprintf(`, opaque="%s"`, quote(c.opaque))
+	}
+	if c.qop != "" {
+		authorization += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, c.qop, nc, cnonce)
+	}
+	return authorization
+}
+
+func quote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// requestURI returns the path and query of the url, as sent in the request line
+func requestURI(reqURL string) string {
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return reqURL
+	}
+	return u.RequestURI()
+}
+
+func requestHost(reqURL string) string {
+	if socket, _, ok := unixSocketURL(reqURL); ok {
+		return "unix:" + socket
+	}
+	u, err := url.Parse(reqURL)
+	if err != nil {
+		return reqURL
+	}
+	return u.Host
+}
+
+// NTLM message flags
+const (
+	ntlmNegotiateUnicode         = 0x00000001
+	ntlmRequestTarget            = 0x00000004
+	ntlmNegotiateNTLM            = 0x00000200
+	ntlmNegotiateAlwaysSign      = 0x00008000
+	ntlmNegotiateExtendedSession = 0x00080000
+	ntlmNegotiateTargetInfo      = 0x00800000
+	ntlmNegotiate128             = 0x20000000
+	ntlmNegotiate56              = 0x80000000
+
+	ntlmNegotiateFlags = ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM | ntlmNegotiateAlwaysSign |
+		ntlmNegotiateExtendedSession | ntlmNegotiateTargetInfo | ntlmNegotiate128 | ntlmNegotiate56
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// endWithNTLM sends the negotiate message, then answers the challenge of the server with NTLMv2 on the same connection
+func endWithNTLM(ctx context.Context, request *gorequest.SuperAgent, yml *load.Config, api load.API, reqURL string, auth httpAuth) (gorequest.Response, []error) {
+	// ntlm authenticates the connection, so the challenge has to be answered on the connection it was sent on
+	request.Transport.DisableKeepAlives = false
+	defer request.Transport.CloseIdleConnections()
+
+	request.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString(ntlmNegotiate()))
+	resp, errs := endWithRetries(ctx, request, yml, api, reqURL)
+	params, ok := authChallenge(resp, "NTLM")
+	if !ok || params == "" || ctx.Err() != nil {
+		return resp, errs
+	}
+	challenge, err := base64.StdEncoding.DecodeString(params)
+	if err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name": yml.Name,
+			"url":  reqURL,
+		}).WithError(err).Error("http: invalid ntlm challenge")
+		return resp, errs
+	}
+
+	domain, user := auth.user, auth.user
+	if i := strings.IndexAny(auth.user, `\/`); i >= 0 {
+		domain, user = auth.user[:i], auth.user[i+1:]
+	} else {
+		domain = ""
+	}
+	clientChallenge := make([]byte, 8)
+	_, _ = rand.Read(clientChallenge)
+	authenticate, err := ntlmAuthenticate(challenge, domain, user, auth.pass, clientChallenge, time.Now())
+	if err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name": yml.Name,
+			"url":  reqURL,
+		}).WithError(err).Error("http: invalid ntlm challenge")
+		return resp, errs
+	}
+	load.Logrus.WithFields(logrus.Fields{
+		"name": yml.Name,
+		"url":  reqURL,
+	}).Debug("http: answering ntlm challenge")
+	request.Set("Authorization", "NTLM "+base64.StdEncoding.EncodeToString(authenticate))
+	return endWithRetries(ctx, request, yml, api, reqURL)
+}
+
+// ntlmNegotiate returns the negotiate message, without domain and workstation
+func ntlmNegotiate() []byte {
+	message := make([]byte, 32)
+	copy(message, ntlmSignature)
+	binary.LittleEndian.PutUint32(message[8:], 1)
+	binary.LittleEndian.PutUint32(message[12:], ntlmNegotiateFlags)
+	return message
+}
+
+// ntlmAuthenticate returns the authenticate message answering the challenge message with NTLMv2
+func ntlmAuthenticate(challenge []byte, domain, user, pass string, clientChallenge []byte, now time.Time) ([]byte, error) {
+	if len(challenge) < 32 || string(challenge[:8]) != string(ntlmSignature) || binary.LittleEndian.Uint32(challenge[8:]) != 2 {
+		return nil, fmt.Errorf("http: not an ntlm challenge message")
+	}
+	flags := binary.LittleEndian.Uint32(challenge[20:])
+	serverChallenge := challenge[24:32]
+	var targetInfo []byte
+	if len(challenge) >= 48 {
+		length := int(binary.LittleEndian.Uint16(challenge[40:]))
+		offset := int(binary.LittleEndian.Uint32(challenge[44:]))
+		if offset+length > len(challenge) {
+			return nil, fmt.Errorf("http: invalid ntlm target info")
+		}
+		targetInfo = challenge[offset : offset+length]
+	}
+
+	timestamp, hasTimestamp := ntlmTimestamp(targetInfo)
+	if !hasTimestamp {
+		timestamp = make([]byte, 8)
+		// windows file time, 100ns intervals since 1601
+		binary.LittleEndian.PutUint64(timestamp, uint64(now.UnixNano()/100+116444736000000000))
+	}
+
+	ntowf := ntowfv2(domain, user, pass)
+	ntResponse := ntlmv2Response(ntowf, serverChallenge, clientChallenge, timestamp, targetInfo)
+	lmResponse := make([]byte, 24)
+	if !hasTimestamp {
+		lmResponse = append(hmacMD5(ntowf, serverChallenge, clientChallenge), clientChallenge...)
+	}
+
+	encode := func(s string) []byte {
+		if flags&ntlmNegotiateUnicode != 0 {
+			return utf16le(s)
+		}
+		return []byte(s)
+	}
+	payloads := [][]byte{lmResponse, ntResponse, encode(domain), encode(user), encode(""), nil}
+	message := make([]byte, 64)
+	copy(message, ntlmSignature)
+	binary.LittleEndian.PutUint32(message[8:], 3)
+	offset := len(message)
+	for i, payload := range payloads {
+		field := 12 + i*8
+		binary.LittleEndian.PutUint16(message[field:], uint16(len(payload)))
+		binary.LittleEndian.PutUint16(message[field+2:], uint16(len(payload)))
+		binary.LittleEndian.PutUint32(message[field+4:], uint32(offset))
+		offset += len(payload)
+	}
+	binary.LittleEndian.PutUint32(message[60:], flags&ntlmNegotiateFlags)
+	for _, payload := range payloads {
+		message = append(message, payload...)
+	}
+	return message, nil
+}
+
+// ntlmTimestamp returns the server timestamp of the target info, false if it isn't set
+func ntlmTimestamp(targetInfo []byte) ([]byte, bool) {
+	for len(targetInfo) >= 4 {
+		id := binary.LittleEndian.Uint16(targetInfo)
+		length := int(binary.LittleEndian.Uint16(targetInfo[2:]))
+		if id == 0 || 4+length > len(targetInfo) {
+			break
+		}
+		if id == 7 && length == 8 {
+			return targetInfo[4:12], true
+		}
+		targetInfo = targetInfo[4+length:]
+	}
+	return nil, false
+}
+
+// ntowfv2 the NTLMv2 hash of the password
+func ntowfv2(domain, user, pass string) []byte {
+	h := md4.New()
+	h.Write(utf16le(pass))
+	return hmacMD5(h.Sum(nil), utf16le(strings.ToUpper(user)+domain))
+}
+
+// ntlmv2Response the NTLMv2 response, the proof followed by the client blob it was computed on
+func ntlmv2Response(ntowf, serverChallenge, clientChallenge, timestamp, targetInfo []byte) []byte {
+	blob := []byte{1, 1, 0, 0, 0, 0, 0, 0}
+	blob = append(blob, timestamp...)
+	blob = append(blob, clientChallenge...)
+	blob = append(blob, 0, 0, 0, 0)
+	blob = append(blob, targetInfo...)
+	blob = append(blob, 0, 0, 0, 0)
+	return append(hmacMD5(ntowf, serverChallenge, blob), blob...)
+}
+
+func hmacMD5(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(md5.New, key)
+	for _, d := range data {
+		mac.Write(d)
+	}
+	return mac.Sum(nil)
+}
+
+func utf16le(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(encoded))
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(b[2*i:], r)
+	}
+	return b
+}
@@ -0,0 +1,236 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestDigestAuthorization(t *testing.T) {
+	// rfc 2617 section 3.5
+	challenge, err := parseDigestChallenge(`realm="testrealm@host.com", qop="auth,auth-int", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", opaque="5ccc069c403ebaf9f0171e9517f40e41"`)
+	require.NoError(t, err)
+	challenge.count = 1
+	assert.Equal(t, `Digest username="Mufasa", realm="testrealm@host.com", nonce="dcd98b7102dd2f0e8b11d0f600bfb0c093", uri="/dir/index.html", `+
+		`response="6629fae49393a05397450978507c4ef1", opaque="5ccc069c403ebaf9f0171e9517f40e41", qop=auth, nc=00000001, cnonce="0a4f113b"`,
+		challenge.authorization("GET", "/dir/index.html", "Mufasa", "Circle Of Life", "0a4f113b"))
+
+	// rfc 7616 section 3.9.1
+	for algorithm, response := range map[string]string{
+		"MD5":     "8ca523f5e9506fed4657c9700eebdbec",
+		"SHA-256": "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+	} {
+		challenge, err := parseDigestChallenge(`realm="http-auth@example.org", qop="auth, auth-int", algorithm=` + algorithm +
+			`, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`)
+		require.NoError(t, err)
+		challenge.count = 1
+		authorization := challenge.authorization("GET", "/dir/index.html", "Mufasa", "Circle of Life", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ")
+		assert.Contains(t, authorization, `response="`+response+`"`, algorithm)
+		assert.Contains(t, authorization, "algorithm="+algorithm, algorithm)
+	}
+
+	_, err = parseDigestChallenge(`realm="x", nonce="y", qop="auth-int"`)
+	assert.Error(t, err)
+	_, err = parseDigestChallenge(`realm="x", nonce="y", algorithm=SHA-512-256`)
+	assert.Error(t, err)
+	_, err = parseDigestChallenge(`realm="x"`)
+	assert.Error(t, err)
+}
+
+func TestParseAuthParams(t *testing.T) {
+	assert.Equal(t, map[string]string{
+		"realm":     `a "quoted", realm`,
+		"nonce":     "abc",
+		"algorithm": "MD5",
+		"stale":     "TRUE",
+	}, parseAuthParams(`realm="a \"quoted\", realm", nonce=abc,algorithm=MD5 , stale=TRUE`))
+}
+
+// digestServer checks the digest authorization of the requests, the nonce changes when stale is set
+type digestServer struct {
+	sync.Mutex
+	nonce      string
+	challenges int
+	requests   int
+}
+
+func (s *digestServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.requests++
+	params := parseAuthParams(strings.TrimPrefix(request.Header.Get("Authorization"), "Digest "))
+	count, _ := strconv.ParseInt(params["nc"], 16, 64)
+	expected := (&digestChallenge{realm: "flex", nonce: s.nonce, qop: "auth", count: int(count)}).
+		authorization(request.Method, request.URL.RequestURI(), "flex", "s3cret", params["cnonce"])
+	if params["nonce"] != s.nonce || params["response"] != parseAuthParams(strings.TrimPrefix(expected, "Digest "))["response"] {
+		s.challenges++
+		writer.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="flex", qop="auth", nonce="%s", stale=%v`, s.nonce, params["nonce"] != "" && params["nonce"] != s.nonce))
+		writer.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	_, _ = writer.Write([]byte(`{"status":"ok"}`))
+}
+
+func TestRunHTTPDigest(t *testing.T) {
+	load.Refresh()
+	digest := &digestServer{nonce: "first"}
+	server := httptest.NewServer(digest)
+	defer server.Close()
+
+	config := load.Config{
+		Name:   "digest",
+		Global: load.Global{User: "flex", Pass: "s3cret", AuthType: "digest"},
+		APIs:   []load.API{{Name: "status", URL: server.URL + "/status?format=json"}},
+	}
+	run := func() []interface{} {
+		var dataStore []interface{}
+		loop := true
+		reqURL := config.APIs[0].URL
+		RunHTTP(context.Background(), &dataStore, &loop, &config, config.APIs[0], &reqURL)
+		return dataStore
+	}
+
+	dataStore := run()
+	require.Len(t, dataStore, 1)
+	assert.Equal(t, "ok", dataStore[0].(map[string]interface{})["status"])
+	assert.Equal(t, 2, digest.requests)
+
+	// the next requests to the host reuse the challenge
+	run()
+	assert.Equal(t, 3, digest.requests)
+	assert.Equal(t, 1, digest.challenges)
+
+	// a new nonce is answered once
+	digest.Lock()
+	digest.nonce = "second"
+	digest.Unlock()
+	dataStore = run()
+	require.Len(t, dataStore, 1)
+	assert.Equal(t, "ok", dataStore[0].(map[string]interface{})["status"])
+	assert.Equal(t, 5, digest.requests)
+
+	// wrong credentials are not retried
+	config.Global.Pass = "wrong"
+	assert.Empty(t, run())
+	assert.Equal(t, 6, digest.requests)
+}
+
+func TestNTLMv2(t *testing.T) {
+	// ms-nlmp section 4.2.4
+	ntowf := ntowfv2("Domain", "User", "Password")
+	assert.Equal(t, "0c868a403bfd7a93a3001ef22ef02e3f", hex.EncodeToString(ntowf))
+
+	serverChallenge, _ := hex.DecodeString("0123456789abcdef")
+	clientChallenge := bytes.Repeat([]byte{0xaa}, 8)
+	targetInfo := ntlmTargetInfo(map[uint16]string{2: "Domain", 1: "Server"})
+	response := ntlmv2Response(ntowf, serverChallenge, clientChallenge, make([]byte, 8), targetInfo)
+	assert.Equal(t, "68cd0ab851e51c96aabc927bebef6a1c", hex.EncodeToString(response[:16]))
+}
+
+// ntlmTargetInfo av pairs in the order of their ids, descending, ending with the eol pair
+func ntlmTargetInfo(pairs map[uint16]string) []byte {
+	var info []byte
+	for id := uint16(7); id > 0; id-- {
+		value, ok := pairs[id]
+		if !ok {
+			continue
+		}
+		encoded := utf16le(value)
+		pair := make([]byte, 4)
+		binary.LittleEndian.PutUint16(pair, id)
+		binary.LittleEndian.PutUint16(pair[2:], uint16(len(encoded)))
+		info = append(append(info, pair...), encoded...)
+	}
+	return append(info, 0, 0, 0, 0)
+}
+
+// ntlmServer runs the ntlm handshake and checks the NTLMv2 response was sent on the challenged connection
+type ntlmServer struct {
+	sync.Mutex
+	challenged map[string]bool
+	users      []string
+}
+
+func (s *ntlmServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	serverChallenge := []byte("8bytes!!")
+	message, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(request.Header.Get("Authorization"), "NTLM "))
+	switch {
+	case len(message) >= 12 && binary.LittleEndian.Uint32(message[8:]) == 1:
+		targetInfo := ntlmTargetInfo(map[uint16]string{2: "FLEX"})
+		challenge := make([]byte, 48)
+		copy(challenge, ntlmSignature)
+		binary.LittleEndian.PutUint32(challenge[8:], 2)
+		binary.LittleEndian.PutUint32(challenge[20:], ntlmNegotiateUnicode|ntlmNegotiateNTLM|ntlmNegotiateTargetInfo)
+		copy(challenge[24:], serverChallenge)
+		binary.LittleEndian.PutUint16(challenge[40:], uint16(len(targetInfo)))
+		binary.LittleEndian.PutUint16(challenge[42:], uint16(len(targetInfo)))
+		binary.LittleEndian.PutUint32(challenge[44:], 48)
+		challenge = append(challenge, targetInfo...)
+		s.challenged[request.RemoteAddr] = true
+		writer.Header().Set("WWW-Authenticate", "NTLM "+base64.StdEncoding.EncodeToString(challenge))
+		writer.WriteHeader(http.StatusUnauthorized)
+		return
+	case len(message) >= 64 && binary.LittleEndian.Uint32(message[8:]) == 3 && s.challenged[request.RemoteAddr]:
+		field := func(i int) []byte {
+			length := binary.LittleEndian.Uint16(message[12+i*8:])
+			offset := binary.LittleEndian.Uint32(message[16+i*8:])
+			return message[offset : offset+uint32(length)]
+		}
+		ntResponse := field(1)
+		blob := ntResponse[16:]
+		proof := hmacMD5(ntowfv2("FLEX", "flex", "s3cret"), serverChallenge, blob)
+		if bytes.Equal(proof, ntResponse[:16]) && bytes.Equal(field(2), utf16le("FLEX")) {
+			s.users = append(s.users, string(field(3)))
+			writer.Header().Set("Content-Type", "application/json")
+			_, _ = writer.Write([]byte(`{"status":"ok"}`))
+			return
+		}
+	}
+	writer.Header().Set("WWW-Authenticate", "NTLM")
+	writer.WriteHeader(http.StatusUnauthorized)
+}
+
+func TestRunHTTPNTLM(t *testing.T) {
+	load.Refresh()
+	ntlm := &ntlmServer{challenged: map[string]bool{}}
+	server := httptest.NewServer(ntlm)
+	defer server.Close()
+
+	config := load.Config{
+		Name: "ntlm",
+		APIs: []load.API{{Name: "status", URL: server.URL + "/status", User: `FLEX\flex`, Pass: "s3cret", AuthType: "ntlm"}},
+	}
+	var dataStore []interface{}
+	loop := true
+	RunHTTP(context.Background(), &dataStore, &loop, &config, config.APIs[0], &config.APIs[0].URL)
+	require.Len(t, dataStore, 1)
+	assert.Equal(t, "ok", dataStore[0].(map[string]interface{})["status"])
+	assert.Equal(t, []string{string(utf16le("flex"))}, ntlm.users)
+	assert.Equal(t, 2, load.StatusCounterRead("HttpRequests"))
+
+	_, err := ntlmAuthenticate([]byte("not a challenge"), "", "flex", "s3cret", make([]byte, 8), time.Now())
+	assert.Error(t, err)
+}
@@ -0,0 +1,214 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/outputs"
+	"github.com/parnurzeal/gorequest"
+)
+
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// httpTimer traces the last request sent through its transport, all methods can be called on a nil timer when disabled
+type httpTimer struct {
+	sync.Mutex
+	base  http.RoundTripper
+	now   func() time.Time
+	trace httpTrace
+}
+
+// httpTrace the times of the steps of a request, zero for the steps it skipped
+type httpTrace struct {
+	sent                      bool
+	start, firstByte, end     time.Time
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	size                      int64
+	protocol, tlsVersion      string
+}
+
+// newHTTPTimer returns the timer of the requests of the api, nil unless timing is set
+func newHTTPTimer(api load.API) *httpTimer {
+	if !api.Timing {
+		return nil
+	}
+	return &httpTimer{now: time.Now}
+}
+
+// transport returns the transport to send the request with, the base transport wrapped by the timer
+func (t *httpTimer) transport(base *http.Transport) http.RoundTripper {
+	if t == nil {
+		return base
+	}
+	t.base = base
+	return t
+}
+
+// RoundTrip sends the request with a trace of its steps, the trace of a retry or of an authentication handshake
+// replaces the trace of the previous attempt
+func (t *httpTimer) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.Lock()
+	t.trace = httpTrace{sent: true, start: t.now()}
+	t.Unlock()
+
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.mark(&t.trace.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.mark(&t.trace.dnsDone) },
+		ConnectStart:         func(string, string) { t.mark(&t.trace.connectStart) },
+		ConnectDone:          func(string, string, error) { t.mark(&t.trace.connectDone) },
+		TLSHandshakeStart:    func() { t.mark(&t.trace.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.mark(&t.trace.tlsDone) },
+		GotFirstResponseByte: func() { t.mark(&t.trace.firstByte) },
+	}
+	resp, err := t.base.RoundTrip(r.WithContext(httptrace.WithClientTrace(r.Context(), trace)))
+	if err != nil {
+		t.mark(&t.trace.end)
+		return resp, err
+	}
+
+	t.Lock()
+	t.trace.protocol = resp.Proto
+	if resp.TLS != nil {
+		t.trace.tlsVersion = tlsVersions[resp.TLS.Version]
+		if t.trace.tlsVersion == "" {
+			t.trace.tlsVersion = fmt.Sprintf("0x%04x", resp.TLS.Version)
+		}
+	}
+	t.Unlock()
+	resp.Body = &timedBody{ReadCloser: resp.Body, timer: t}
+	return resp, nil
+}
+
+// mark sets the time of a step of the request, the first time only as the dialer can try several addresses
+func (t *httpTimer) mark(step *time.Time) {
+	t.Lock()
+	defer t.Unlock()
+	if step.IsZero() {
+		*step = t.now()
+	}
+}
+
+// attributes returns the timings of the request in milliseconds, with its size and protocol,
+// the steps skipped by a reused connection or a plain http request are left out
+func (t *httpTimer) attributes() map[string]interface{} {
+	if t == nil {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	trace := t.trace
+	if !trace.sent {
+		return nil
+	}
+	attributes := map[string]interface{}{}
+	steps := []struct {
+		name       string
+		start, end time.Time
+	}{
+		{"api.timing.dnsMs", trace.dnsStart, trace.dnsDone},
+		{"api.timing.connectMs", trace.connectStart, trace.connectDone},
+		{"api.timing.tlsHandshakeMs", trace.tlsStart, trace.tlsDone},
+		{"api.timing.firstByteMs", trace.start, trace.firstByte},
+		{"api.timing.totalMs", trace.start, trace.end},
+	}
+	for _, step := range steps {
+		if !step.start.IsZero() && !step.end.IsZero() {
+			attributes[step.name] = float64(step.end.Sub(step.start)) / float64(time.Millisecond)
+		}
+	}
+	if trace.protocol != "" {
+		attributes["api.responseSize"] = trace.size
+		attributes["api.protocol"] = trace.protocol
+	}
+	if trace.tlsVersion != "" {
+		attributes["api.tlsVersion"] = trace.tlsVersion
+	}
+	return attributes
+}
+
+// addTo sets the attributes of the request on the samples
+func (t *httpTimer) addTo(samples []interface{}) {
+	attributes := t.attributes()
+	if len(attributes) == 0 {
+		return
+	}
+	for _, sample := range samples {
+		if s, ok := sample.(map[string]interface{}); ok {
+			for key, value := range attributes {
+				s[key] = value
+			}
+		}
+	}
+}
+
+// sample creates a flexHttpTimingSample with the timings of the request, so requests whose response creates
+// no samples, such as a 204 or a body stored as text, are timed too
+func (t *httpTimer) sample(yml *load.Config, api load.API, reqURL string, resp gorequest.Response) {
+	attributes := t.attributes()
+	if len(attributes) == 0 {
+		return
+	}
+	load.EntityLock.RLock()
+	defer load.EntityLock.RUnlock()
+	if load.Entity == nil {
+		return
+	}
+	load.StatusCounterIncrement("EventCount")
+	load.StatusCounterIncrement("flexHttpTimingSample")
+
+	timingMetricSet := load.Entity.NewMetricSet("flexHttpTimingSample")
+	checkError(timingMetricSet.SetMetric("name", yml.Name, metric.ATTRIBUTE))
+	checkError(timingMetricSet.SetMetric("api", api.Name, metric.ATTRIBUTE))
+	checkError(timingMetricSet.SetMetric("url", outputs.RedactError(reqURL), metric.ATTRIBUTE))
+	if resp != nil {
+		checkError(timingMetricSet.SetMetric("api.StatusCode", resp.StatusCode, metric.GAUGE))
+	}
+	for key, value := range attributes {
+		sourceType := metric.GAUGE
+		if _, ok := value.(string); ok {
+			sourceType = metric.ATTRIBUTE
+		}
+		checkError(timingMetricSet.SetMetric(key, value, sourceType))
+	}
+}
+
+// timedBody counts the bytes of the response, the request ends once its body is read
+type timedBody struct {
+	io.ReadCloser
+	timer *httpTimer
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.timer.Lock()
+	b.timer.trace.size += int64(n)
+	b.timer.Unlock()
+	if err != nil {
+		b.timer.mark(&b.timer.trace.end)
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	b.timer.mark(&b.timer.trace.end)
+	return b.ReadCloser.Close()
+}
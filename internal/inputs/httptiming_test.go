@@ -0,0 +1,111 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func runTimedHTTP(api load.API) []interface{} {
+	config := load.Config{Name: "timing", APIs: []load.API{api}}
+	var dataStore []interface{}
+	loop := true
+	reqURL := api.URL
+	RunHTTP(context.Background(), &dataStore, &loop, &config, api, &reqURL)
+	return dataStore
+}
+
+func TestRunHTTPTiming(t *testing.T) {
+	load.Refresh()
+	body := `[{"status":"ok"},{"status":"degraded"}]`
+	server := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	// the host is resolved, connected to and handshaked with, each sample of the response has the timings
+	api := load.API{
+		Name:      "timed",
+		URL:       strings.Replace(server.URL, "127.0.0.1", "localhost", 1),
+		Timing:    true,
+		TLSConfig: load.TLSConfig{Enable: true, InsecureSkipVerify: true},
+	}
+	dataStore := runTimedHTTP(api)
+	require.Len(t, dataStore, 2)
+	for _, sample := range dataStore {
+		s := sample.(map[string]interface{})
+		for _, key := range []string{"api.timing.dnsMs", "api.timing.connectMs", "api.timing.tlsHandshakeMs", "api.timing.firstByteMs", "api.timing.totalMs"} {
+			require.Contains(t, s, key)
+			assert.True(t, s[key].(float64) >= 0, key)
+		}
+		assert.True(t, s["api.timing.totalMs"].(float64) >= s["api.timing.firstByteMs"].(float64))
+		assert.Equal(t, int64(len(body)), s["api.responseSize"])
+		assert.Equal(t, "HTTP/1.1", s["api.protocol"])
+		assert.Contains(t, s["api.tlsVersion"], "TLS 1.")
+	}
+
+	// timing is opt-in
+	api.Timing = false
+	dataStore = runTimedHTTP(api)
+	require.Len(t, dataStore, 2)
+	assert.NotContains(t, dataStore[0], "api.timing.totalMs")
+
+	// a failed request has the timings of the steps it went through
+	server.Close()
+	api.URL = server.URL
+	api.Timing = true
+	dataStore = runTimedHTTP(api)
+	require.Len(t, dataStore, 1)
+	s := dataStore[0].(map[string]interface{})
+	assert.Contains(t, s, "error")
+	assert.Contains(t, s, "api.timing.connectMs")
+	assert.Contains(t, s, "api.timing.totalMs")
+	assert.NotContains(t, s, "api.timing.dnsMs")
+	assert.NotContains(t, s, "api.protocol")
+}
+
+func TestRunHTTPTimingSample(t *testing.T) {
+	load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestRunHTTPTimingSample", "nri-flex")
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// a response without samples is still timed
+	dataStore := runTimedHTTP(load.API{Name: "empty", URL: server.URL, Timing: true})
+	assert.Empty(t, dataStore)
+	require.Equal(t, 1, load.StatusCounterRead("flexHttpTimingSample"))
+
+	var timings []map[string]interface{}
+	for _, metricSet := range load.Entity.Metrics {
+		if metricSet.Metrics["event_type"] == "flexHttpTimingSample" {
+			timings = append(timings, metricSet.Metrics)
+		}
+	}
+	require.Len(t, timings, 1)
+	assert.Equal(t, "timing", timings[0]["name"])
+	assert.Equal(t, "empty", timings[0]["api"])
+	assert.Equal(t, float64(http.StatusNoContent), timings[0]["api.StatusCode"])
+	assert.Contains(t, timings[0], "api.timing.totalMs")
+	assert.Equal(t, "HTTP/1.1", timings[0]["api.protocol"])
+
+	// untimed requests don't create one
+	runTimedHTTP(load.API{Name: "untimed", URL: server.URL})
+	assert.Equal(t, 1, load.StatusCounterRead("flexHttpTimingSample"))
+}
@@ -14,12 +14,11 @@ import (
 	"time"
 
 	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/outputs"
 )
 
 // NetDialWithTimeout performs network dial without timeout
-func NetDialWithTimeout(dataStore *[]interface{}, command load.Command, dataSample *map[string]interface{}, api load.API, processType *string) {
-
-	ctx := context.Background()
+func NetDialWithTimeout(ctx context.Context, dataStore *[]interface{}, yml *load.Config, command load.Command, dataSample *map[string]interface{}, api load.API, processType *string) {
 	// Create a channel for signal handling
 	c := make(chan struct{})
 	// Define a cancellation after default dial timeout in the context
@@ -40,11 +39,23 @@ func NetDialWithTimeout(dataStore *[]interface{}, command load.Command, dataSamp
 		netw = command.Network
 	}
 
+	key := netw + "://" + addr
+	if command.Run != "" {
+		key += " " + command.Run
+	}
+	if replaying() {
+		data, err := replayInput(yml, api, fixtureDial, key)
+		countBytes(yml, api, len(data))
+		processDial(dataStore, command, dataSample, api, processType, netw, string(data), err)
+		return
+	}
+
 	var dialError error
 	var data string
 	// Run dial via a goroutine
 	load.Logrus.Debugf("commands: dialling %v : %v", addr, netw)
-	dialConn, err := net.DialTimeout(netw, addr, time.Duration(timeout)*time.Millisecond)
+	dialer := net.Dialer{Timeout: time.Duration(timeout) * time.Millisecond}
+	dialConn, err := dialer.DialContext(ctx, netw, addr)
 	if err == nil {
 		defer dialConn.Close()
 	}
@@ -71,29 +82,41 @@ func NetDialWithTimeout(dataStore *[]interface{}, command load.Command, dataSamp
 	}(dialConn, err)
 
 	// Listen for signals
+	var dialErr error
 	select {
 	case <-ctx.Done():
 		if command.Run == "" {
-			*dataStore = append(*dataStore, map[string]interface{}{"portStatus": "closed", "addr": command.Dial, "netw": netw, "err": ctx.Err().Error()})
-			// load.StoreAppend(map[string]interface{}{"portStatus": "closed", "addr": command.Dial, "netw": netw, "err": ctx.Err().Error()})
-		} else if command.Run != "" && data != "" {
-			processOutput(dataStore, data, dataSample, command, api, processType)
+			dialErr = ctx.Err()
 		}
 		if data == "" {
 			load.Logrus.Error("commands: dial " + ctx.Err().Error())
+			outputs.ErrorSample(yml.Name, api.Name, "dial", fmt.Errorf("dial %s: %v", command.Dial, ctx.Err()))
 		} else {
 			load.Logrus.Debug("commands: dial " + ctx.Err().Error())
 		}
 	case <-c:
-		if command.Run == "" && dialError == nil {
-			*dataStore = append(*dataStore, map[string]interface{}{"portStatus": "open", "addr": command.Dial, "netw": netw})
-			// load.StoreAppend(map[string]interface{}{"portStatus": "open", "addr": command.Dial, "netw": netw})
-		} else if command.Run == "" && dialError != nil {
-			*dataStore = append(*dataStore, map[string]interface{}{"portStatus": "closed", "addr": command.Dial, "netw": netw, "err": dialError.Error()})
-			// load.StoreAppend(map[string]interface{}{"portStatus": "closed", "addr": command.Dial, "netw": netw, "err": dialError.Error()})
-		} else if command.Run != "" && dialError == nil && data != "" {
-			processOutput(dataStore, data, dataSample, command, api, processType)
+		dialErr = dialError
+		if dialErr != nil {
+			outputs.ErrorSample(yml.Name, api.Name, "dial", fmt.Errorf("dial %s: %v", command.Dial, dialErr))
 		}
 		load.Logrus.Debugf("commands: finished dial %v : %v", command.Dial, netw)
 	}
+
+	if recording() {
+		recordInput(yml, api, fixtureDial, key, []byte(data), dialErr)
+	}
+	countBytes(yml, api, len(data))
+	processDial(dataStore, command, dataSample, api, processType, netw, data, dialErr)
+}
+
+// processDial stores the port status, or processes the output when a command was sent
+func processDial(dataStore *[]interface{}, command load.Command, dataSample *map[string]interface{}, api load.API, processType *string, netw string, data string, err error) {
+	switch {
+	case command.Run == "" && err == nil:
+		*dataStore = append(*dataStore, map[string]interface{}{"portStatus": "open", "addr": command.Dial, "netw": netw})
+	case command.Run == "":
+		*dataStore = append(*dataStore, map[string]interface{}{"portStatus": "closed", "addr": command.Dial, "netw": netw, "err": err.Error()})
+	case data != "":
+		processOutput(dataStore, data, dataSample, command, api, processType)
+	}
 }
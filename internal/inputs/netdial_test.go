@@ -6,6 +6,7 @@
 package inputs
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -47,7 +48,7 @@ func TestNetDial(t *testing.T) {
 	dataStore := []interface{}{}
 	dataSample := map[string]interface{}{}
 	processType := ""
-	NetDialWithTimeout(&dataStore, config.APIs[0].Commands[0], &dataSample, config.APIs[0], &processType)
+	NetDialWithTimeout(context.Background(), &dataStore, &config, config.APIs[0].Commands[0], &dataSample, config.APIs[0], &processType)
 
 	if len(expectedDatastore) != len(dataStore) {
 		t.Errorf("Incorrect number of samples generated expected: %d, got: %d", len(expectedDatastore), len(dataStore))
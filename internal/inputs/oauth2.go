@@ -0,0 +1,279 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/outputs"
+	"github.com/parnurzeal/gorequest"
+	"github.com/sirupsen/logrus"
+)
+
+// oauth2ExpirySkew tokens are refreshed this long before they expire so they don't expire in flight
+const oauth2ExpirySkew = 30 * time.Second
+
+// oauth2Tokens tokens fetched by this process keyed by token source, with a lock per source
+// so concurrent requests wait for a single token request
+var oauth2Tokens = struct {
+	sync.Mutex
+	tokens map[string]oauth2Token
+	locks  map[string]*sync.Mutex
+}{tokens: map[string]oauth2Token{}, locks: map[string]*sync.Mutex{}}
+
+// oauth2Token token cached in memory and in the storer
+type oauth2Token struct {
+	AccessToken  string `json:"accessToken"`
+	TokenType    string `json:"tokenType"`
+	RefreshToken string `json:"refreshToken,omitempty"` // rotated refresh token returned by the token endpoint
+	ExpiresMs    int64  `json:"expiresMs"`              // 0 when the token endpoint didn't set an expiry
+}
+
+// valid whether the token can still be used at the time
+func (t oauth2Token) valid(now time.Time) bool {
+	return t.AccessToken != "" && (t.ExpiresMs == 0 || now.Add(oauth2ExpirySkew).UnixNano()/int64(time.Millisecond) < t.ExpiresMs)
+}
+
+// oauth2Source fetches the tokens of an api
+type oauth2Source struct {
+	settings load.OAuth2
+	key      string
+	client   *http.Client
+}
+
+// newOAuth2Source returns the token source of the api, nil when oauth2 isn't configured
+func newOAuth2Source(yml *load.Config, api load.API) *oauth2Source {
+	settings := yml.Global.OAuth2
+	proxy := yml.Global.Proxy
+	if api.OAuth2.TokenURL != "" {
+		settings = api.OAuth2
+	}
+	if settings.TokenURL == "" {
+		return nil
+	}
+	if api.Proxy != "" {
+		proxy = api.Proxy
+	}
+
+	// the token endpoint is reached with the same TLS config as the api
+	transport := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: httpTLSConfig(yml, api),
+	}
+	if proxy != "" {
+		if proxyURL, err := url.Parse(proxy); err == nil {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s|%s|%s|%s|%s", settings.TokenURL, settings.ClientID, strings.Join(settings.Scopes, " "), settings.Audience, settings.RefreshToken)
+	return &oauth2Source{
+		settings: settings,
+		key:      fmt.Sprintf("flex-oauth2-%x", h.Sum64()),
+		client:   &http.Client{Transport: transport, Timeout: load.DefaultTimeout},
+	}
+}
+
+// authorize sets the bearer token on the request, a stale token rejected by the endpoint is replaced by a new one
+func (s *oauth2Source) authorize(ctx context.Context, request *gorequest.SuperAgent, stale string) error {
+	token, err := s.token(ctx, stale)
+	if err != nil {
+		return err
+	}
+	tokenType := token.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	request.Set("Authorization", tokenType+" "+token.AccessToken)
+	return nil
+}
+
+// retryUnauthorized fetches a new token when the endpoint rejected the request with a 401, and sends the request again,
+// the token may have been revoked or expired earlier than the token endpoint said
+func retryUnauthorized(ctx context.Context, request *gorequest.SuperAgent, yml *load.Config, api load.API, reqURL string, resp gorequest.Response, errs []error) (gorequest.Response, []error) {
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized || ctx.Err() != nil {
+		return resp, errs
+	}
+	source := newOAuth2Source(yml, api)
+	if source == nil {
+		return resp, errs
+	}
+	stale := request.Header["Authorization"]
+	if stale == "" {
+		// no token could be fetched for the request, the failure was already reported
+		return resp, errs
+	}
+	if i := strings.Index(stale, " "); i >= 0 {
+		stale = stale[i+1:]
+	}
+	if err := source.authorize(ctx, request, stale); err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name": yml.Name,
+			"url":  reqURL,
+		}).WithError(err).Error("http: failed to refresh oauth2 token")
+		outputs.ErrorSample(yml.Name, api.Name, "oauth2", err)
+		return resp, errs
+	}
+	load.Logrus.WithFields(logrus.Fields{
+		"name": yml.Name,
+		"url":  reqURL,
+	}).Debug("http: oauth2 token rejected, retrying with a new token")
+	return endWithRetries(ctx, request, yml, api, reqURL)
+}
+
+// token returns a valid token, fetching a new one when none is cached or the cached one is the stale token
+func (s *oauth2Source) token(ctx context.Context, stale string) (oauth2Token, error) {
+	oauth2Tokens.Lock()
+	lock, ok := oauth2Tokens.locks[s.key]
+	if !ok {
+		lock = &sync.Mutex{}
+		oauth2Tokens.locks[s.key] = lock
+	}
+	oauth2Tokens.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	cached := s.cached()
+	if cached.valid(time.Now()) && cached.AccessToken != stale {
+		return cached, nil
+	}
+
+	refreshToken := s.settings.RefreshToken
+	if cached.RefreshToken != "" {
+		refreshToken = cached.RefreshToken
+	}
+	token, err := s.fetch(ctx, refreshToken)
+	if err != nil && refreshToken != s.settings.RefreshToken {
+		// the rotated refresh token may have been revoked, fall back to the configured one
+		token, err = s.fetch(ctx, s.settings.RefreshToken)
+	}
+	if err != nil {
+		return oauth2Token{}, err
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = cached.RefreshToken
+	}
+	s.store(token)
+	return token, nil
+}
+
+// cached returns the token cached in memory, or in the storer by a previous run
+func (s *oauth2Source) cached() oauth2Token {
+	oauth2Tokens.Lock()
+	token, ok := oauth2Tokens.tokens[s.key]
+	oauth2Tokens.Unlock()
+	if ok || load.Storer == nil {
+		return token
+	}
+	if _, err := load.Storer.Get(s.key, &token); err != nil {
+		return oauth2Token{}
+	}
+	return token
+}
+
+func (s *oauth2Source) store(token oauth2Token) {
+	oauth2Tokens.Lock()
+	oauth2Tokens.tokens[s.key] = token
+	oauth2Tokens.Unlock()
+	if load.Storer != nil {
+		load.Storer.Set(s.key, token)
+	}
+}
+
+// fetch requests a token from the token endpoint with the client_credentials grant,
+// or the refresh_token grant when a refresh token is set
+func (s *oauth2Source) fetch(ctx context.Context, refreshToken string) (oauth2Token, error) {
+	form := url.Values{}
+	if refreshToken != "" {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", refreshToken)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	if len(s.settings.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.settings.Scopes, " "))
+	}
+	if s.settings.Audience != "" {
+		form.Set("audience", s.settings.Audience)
+	}
+	if s.settings.AuthStyle == "params" {
+		form.Set("client_id", s.settings.ClientID)
+		if s.settings.ClientSecret != "" {
+			form.Set("client_secret", s.settings.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.settings.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return oauth2Token{}, fmt.Errorf("oauth2: failed to create token request: %v", err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.settings.AuthStyle != "params" && s.settings.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(s.settings.ClientID), url.QueryEscape(s.settings.ClientSecret))
+	}
+
+	load.Logrus.WithFields(logrus.Fields{
+		"token_url":  s.settings.TokenURL,
+		"grant_type": form.Get("grant_type"),
+	}).Debug("oauth2: requesting token")
+	load.StatusCounterIncrement("OAuth2TokenRequests")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return oauth2Token{}, fmt.Errorf("oauth2: token request to %s failed: %v", s.settings.TokenURL, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return oauth2Token{}, fmt.Errorf("oauth2: failed to read token response: %v", err)
+	}
+
+	var tokenResponse struct {
+		AccessToken      string      `json:"access_token"`
+		TokenType        string      `json:"token_type"`
+		ExpiresIn        json.Number `json:"expires_in"`
+		RefreshToken     string      `json:"refresh_token"`
+		Error            string      `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil && resp.StatusCode < http.StatusBadRequest {
+		return oauth2Token{}, fmt.Errorf("oauth2: failed to parse token response: %v", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		detail := tokenResponse.Error
+		if tokenResponse.ErrorDescription != "" {
+			detail += ": " + tokenResponse.ErrorDescription
+		}
+		return oauth2Token{}, fmt.Errorf("oauth2: token endpoint %s returned %s %s", s.settings.TokenURL, resp.Status, detail)
+	}
+	if tokenResponse.AccessToken == "" {
+		return oauth2Token{}, fmt.Errorf("oauth2: token endpoint %s returned no access_token", s.settings.TokenURL)
+	}
+
+	token := oauth2Token{
+		AccessToken:  tokenResponse.AccessToken,
+		TokenType:    tokenResponse.TokenType,
+		RefreshToken: tokenResponse.RefreshToken,
+	}
+	if expiresIn, err := tokenResponse.ExpiresIn.Int64(); err == nil && expiresIn > 0 {
+		token.ExpiresMs = time.Now().Add(time.Duration(expiresIn)*time.Second).UnixNano() / int64(time.Millisecond)
+	}
+	return token, nil
+}
@@ -0,0 +1,218 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+// oauth2Server issues numbered tokens and serves the api only with the latest token
+type oauth2Server struct {
+	sync.Mutex
+	issued int
+	forms  []map[string]string
+	auths  []string
+}
+
+func (s *oauth2Server) token(writer http.ResponseWriter, request *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	if err := request.ParseForm(); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	form := map[string]string{}
+	for key := range request.PostForm {
+		form[key] = request.PostForm.Get(key)
+	}
+	s.forms = append(s.forms, form)
+	s.auths = append(s.auths, request.Header.Get("Authorization"))
+	if form["grant_type"] == "refresh_token" && form["refresh_token"] == "revoked" {
+		writer.WriteHeader(http.StatusBadRequest)
+		_, _ = writer.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+	s.issued++
+	writer.Header().Set("Content-Type", "application/json")
+	_, _ = fmt.Fprintf(writer, `{"access_token":"token-%d","token_type":"bearer","expires_in":3600}`, s.issued)
+}
+
+func (s *oauth2Server) api(writer http.ResponseWriter, request *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	writer.Header().Set("Content-Type", "application/json")
+	if request.Header.Get("Authorization") != fmt.Sprintf("Bearer token-%d", s.issued) {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = writer.Write([]byte(`{"error":"unauthorized"}`))
+		return
+	}
+	_, _ = writer.Write([]byte(`{"status":"ok"}`))
+}
+
+func newOAuth2TestServer() (*oauth2Server, *httptest.Server) {
+	oauth := &oauth2Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", oauth.token)
+	mux.HandleFunc("/api", oauth.api)
+	return oauth, httptest.NewServer(mux)
+}
+
+func runOAuth2HTTP(config *load.Config) []interface{} {
+	var dataStore []interface{}
+	loop := true
+	reqURL := config.APIs[0].URL
+	RunHTTP(context.Background(), &dataStore, &loop, config, config.APIs[0], &reqURL)
+	return dataStore
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	load.Refresh()
+	load.Storer = persist.NewInMemoryStore()
+	defer func() { load.Storer = nil }()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestOAuth2ClientCredentials", "nri-flex")
+
+	oauth, server := newOAuth2TestServer()
+	defer server.Close()
+	config := &load.Config{
+		Name: "oauth2",
+		Global: load.Global{OAuth2: load.OAuth2{
+			TokenURL:     server.URL + "/token",
+			ClientID:     "flex",
+			ClientSecret: "s3cret",
+			Scopes:       []string{"read", "write"},
+			Audience:     "https://api.example.com",
+		}},
+		APIs: []load.API{{Name: "status", URL: server.URL + "/api"}},
+	}
+
+	dataStore := runOAuth2HTTP(config)
+	require.Len(t, dataStore, 1)
+	assert.Equal(t, "ok", dataStore[0].(map[string]interface{})["status"])
+	require.Len(t, oauth.forms, 1)
+	assert.Equal(t, map[string]string{"grant_type": "client_credentials", "scope": "read write", "audience": "https://api.example.com"}, oauth.forms[0])
+	user, pass, ok := (&http.Request{Header: http.Header{"Authorization": {oauth.auths[0]}}}).BasicAuth()
+	require.True(t, ok)
+	assert.Equal(t, "flex", user)
+	assert.Equal(t, "s3cret", pass)
+
+	// the cached token is reused
+	runOAuth2HTTP(config)
+	assert.Len(t, oauth.forms, 1)
+
+	// a token rejected by the api is replaced once
+	oauth.Lock()
+	oauth.issued++
+	oauth.Unlock()
+	dataStore = runOAuth2HTTP(config)
+	require.Len(t, dataStore, 1)
+	assert.Equal(t, "ok", dataStore[0].(map[string]interface{})["status"])
+	assert.Len(t, oauth.forms, 2)
+	assert.Equal(t, 0, load.StatusCounterRead("flexErrorSample"))
+
+	// the token is also kept in the storer for the next run
+	oauth2Tokens.Lock()
+	oauth2Tokens.tokens = map[string]oauth2Token{}
+	oauth2Tokens.Unlock()
+	runOAuth2HTTP(config)
+	assert.Len(t, oauth.forms, 2)
+}
+
+func TestOAuth2RefreshToken(t *testing.T) {
+	load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestOAuth2RefreshToken", "nri-flex")
+
+	oauth, server := newOAuth2TestServer()
+	defer server.Close()
+	config := &load.Config{
+		Name: "oauth2",
+		APIs: []load.API{{
+			Name: "status",
+			URL:  server.URL + "/api",
+			OAuth2: load.OAuth2{
+				TokenURL:     server.URL + "/token",
+				ClientID:     "flex",
+				RefreshToken: "refresh-me",
+				AuthStyle:    "params",
+			},
+		}},
+	}
+	dataStore := runOAuth2HTTP(config)
+	require.Len(t, dataStore, 1)
+	assert.Equal(t, "ok", dataStore[0].(map[string]interface{})["status"])
+	require.Len(t, oauth.forms, 1)
+	assert.Equal(t, map[string]string{"grant_type": "refresh_token", "refresh_token": "refresh-me", "client_id": "flex"}, oauth.forms[0])
+	assert.Equal(t, "", oauth.auths[0])
+
+	// a failed token request is reported, the request is still sent and fails on its own
+	config.APIs[0].OAuth2.RefreshToken = "revoked"
+	runOAuth2HTTP(config)
+	var inputs []string
+	for _, metricSet := range load.Entity.Metrics {
+		inputs = append(inputs, fmt.Sprint(metricSet.Metrics["input"]))
+		if metricSet.Metrics["input"] == "oauth2" {
+			assert.Contains(t, metricSet.Metrics["error"], "returned 400 Bad Request invalid_grant")
+		}
+	}
+	assert.Contains(t, inputs, "oauth2")
+	assert.Contains(t, inputs, "http")
+}
+
+func TestOAuth2TLSConfig(t *testing.T) {
+	load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestOAuth2TLSConfig", "nri-flex")
+
+	oauth := &oauth2Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", oauth.token)
+	mux.HandleFunc("/api", oauth.api)
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "oauth2-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ca := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+
+	// the token endpoint is verified with the ca of the api
+	config := &load.Config{
+		Name: "oauth2",
+		APIs: []load.API{{
+			Name:      "status",
+			URL:       server.URL + "/api",
+			TLSConfig: load.TLSConfig{Enable: true, Ca: ca},
+			OAuth2: load.OAuth2{
+				TokenURL:     server.URL + "/token",
+				ClientID:     "flex",
+				ClientSecret: "tls",
+			},
+		}},
+	}
+	dataStore := runOAuth2HTTP(config)
+	require.Len(t, dataStore, 1)
+	assert.Equal(t, "ok", dataStore[0].(map[string]interface{})["status"])
+	assert.Len(t, oauth.forms, 1)
+	assert.Equal(t, 0, load.StatusCounterRead("flexErrorSample"))
+}
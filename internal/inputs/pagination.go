@@ -0,0 +1,156 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/itchyny/gojq"
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+// paginationPage the attributes of a page found by the jq expressions of the pagination
+type paginationPage struct {
+	cursor   string
+	link     string
+	pageNext int
+	hasNext  bool // whether page_next_path found the next page
+	empty    bool // whether the payload_path of the page is empty
+	total    int  // total_path of the page, -1 when unknown
+}
+
+// usesPaginationPaths whether the pagination has any jq expression
+func usesPaginationPaths(p *load.Pagination) bool {
+	return p.NextCursorPath != "" || p.NextLinkPath != "" || p.PageNextPath != "" || p.PageLimitPath != "" ||
+		p.MaxPagesPath != "" || p.PayloadPath != "" || p.TotalPath != ""
+}
+
+// paginationPaths evaluates the jq expressions of the pagination against the parsed body,
+// the response headers are available as $headers, keyed by their canonical name
+func paginationPaths(p *load.Pagination, body []byte, header http.Header) (paginationPage, error) {
+	page := paginationPage{total: -1}
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return page, fmt.Errorf("http: pagination failed to parse body: %v", err)
+	}
+	headers := map[string]interface{}{}
+	for key, values := range header {
+		if len(values) > 0 {
+			headers[http.CanonicalHeaderKey(key)] = values[0]
+		}
+	}
+
+	ints := []struct {
+		expression string
+		set        func(int)
+	}{
+		{p.PageLimitPath, func(n int) { p.PageLimit = n }},
+		{p.MaxPagesPath, func(n int) { p.MaxPages = n }},
+		{p.PageNextPath, func(n int) { page.pageNext, page.hasNext = n, true }},
+		{p.TotalPath, func(n int) { page.total = n }},
+	}
+	for _, field := range ints {
+		if field.expression == "" {
+			continue
+		}
+		value, err := paginationPath(field.expression, data, headers)
+		if err != nil {
+			return page, err
+		}
+		if n, ok := paginationInt(value); ok {
+			field.set(n)
+		}
+	}
+
+	if p.NextCursorPath != "" {
+		value, err := paginationPath(p.NextCursorPath, data, headers)
+		if err != nil {
+			return page, err
+		}
+		if value != nil && value != false {
+			page.cursor = url.QueryEscape(paginationString(value))
+		}
+	}
+	if p.NextLinkPath != "" {
+		value, err := paginationPath(p.NextLinkPath, data, headers)
+		if err != nil {
+			return page, err
+		}
+		if link, ok := value.(string); ok && link != "" {
+			page.link = p.NextLinkHost + link
+		}
+	}
+	if p.PayloadPath != "" {
+		value, err := paginationPath(p.PayloadPath, data, headers)
+		if err != nil {
+			return page, err
+		}
+		page.empty = paginationEmpty(value)
+	}
+	return page, nil
+}
+
+// paginationPath returns the first result of the jq expression, nil when there is none
+func paginationPath(expression string, data interface{}, headers map[string]interface{}) (interface{}, error) {
+	query, err := gojq.Parse(expression)
+	if err != nil {
+		return nil, fmt.Errorf("http: pagination failed to parse %q: %v", expression, err)
+	}
+	code, err := gojq.Compile(query, gojq.WithVariables([]string{"$headers"}))
+	if err != nil {
+		return nil, fmt.Errorf("http: pagination failed to compile %q: %v", expression, err)
+	}
+	value, ok := code.Run(data, headers).Next()
+	if !ok {
+		return nil, nil
+	}
+	if err, ok := value.(error); ok {
+		return nil, fmt.Errorf("http: pagination failed to evaluate %q: %v", expression, err)
+	}
+	return value, nil
+}
+
+func paginationInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case float64:
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func paginationString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// paginationEmpty whether the payload of a page is missing or has no items
+func paginationEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	case string:
+		return v == ""
+	}
+	return false
+}
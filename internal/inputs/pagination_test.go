@@ -0,0 +1,135 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+// pagedServer serves the items two at a time as pretty printed json, by offset or by cursor
+type pagedServer struct {
+	sync.Mutex
+	items    []string
+	requests []string
+}
+
+func (s *pagedServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.requests = append(s.requests, request.URL.RawQuery)
+	start, _ := strconv.Atoi(request.URL.Query().Get("offset"))
+	if cursor := request.URL.Query().Get("cursor"); cursor != "" {
+		start, _ = strconv.Atoi(strings.TrimPrefix(cursor, "cursor="))
+	}
+	end := start + 2
+	if end > len(s.items) {
+		end = len(s.items)
+	}
+	items := []string{}
+	if start < end {
+		items = s.items[start:end]
+	}
+	var next interface{}
+	if end < len(s.items) {
+		next = "cursor=" + strconv.Itoa(end)
+		writer.Header().Set("X-Next-Cursor", next.(string))
+	}
+	body, _ := json.MarshalIndent(map[string]interface{}{
+		"data":  map[string]interface{}{"items": items},
+		"meta":  map[string]interface{}{"paging": map[string]interface{}{"next": next}},
+		"total": len(s.items),
+	}, "", "  ")
+	writer.Header().Set("Content-Type", "application/json")
+	_, _ = writer.Write(body)
+}
+
+func TestRunHTTPPaginationPaths(t *testing.T) {
+	load.Refresh()
+	paged := &pagedServer{items: []string{"a", "b", "c", "d", "e"}}
+	server := httptest.NewServer(paged)
+	defer server.Close()
+
+	for name, test := range map[string]struct {
+		url        string
+		pagination load.Pagination
+		requests   []string
+		pages      int
+	}{
+		"cursor in the body": {
+			url:        server.URL + "/items?cursor=${page}",
+			pagination: load.Pagination{NextCursorPath: ".meta.paging.next"},
+			requests:   []string{"cursor=0", "cursor=cursor%3D2", "cursor=cursor%3D4"},
+			pages:      3,
+		},
+		"cursor in a header": {
+			url:        server.URL + "/items?cursor=${page}",
+			pagination: load.Pagination{NextCursorPath: `$headers["X-Next-Cursor"]`},
+			requests:   []string{"cursor=0", "cursor=cursor%3D2", "cursor=cursor%3D4"},
+			pages:      3,
+		},
+		"offset until the total": {
+			url:        server.URL + "/items?offset=${page}&limit=${limit}",
+			pagination: load.Pagination{PageLimit: 2, Increment: 2, TotalPath: ".total"},
+			requests:   []string{"limit=2&offset=0", "limit=2&offset=2", "limit=2&offset=4"},
+			pages:      3,
+		},
+		"offset until an empty page": {
+			url:        server.URL + "/items?offset=${page}&limit=${limit}",
+			pagination: load.Pagination{PageLimit: 2, Increment: 2, PayloadPath: ".data.items"},
+			requests:   []string{"limit=2&offset=0", "limit=2&offset=2", "limit=2&offset=4", "limit=2&offset=6"},
+			pages:      3,
+		},
+		"offset until max pages": {
+			url:        server.URL + "/items?offset=${page}&limit=${limit}",
+			pagination: load.Pagination{PageLimit: 2, Increment: 2, MaxPages: 2, PayloadPath: ".data.items"},
+			requests:   []string{"limit=2&offset=0", "limit=2&offset=2"},
+			pages:      2,
+		},
+	} {
+		paged.requests = nil
+		api := load.API{Name: "items", URL: test.url, Pagination: test.pagination}
+		config := load.Config{Name: "pagination", APIs: []load.API{api}}
+		var dataStore []interface{}
+		loop := true
+		reqURL := api.URL
+		RunHTTP(context.Background(), &dataStore, &loop, &config, api, &reqURL)
+
+		assert.Equal(t, test.requests, paged.requests, name)
+		require.Len(t, dataStore, test.pages, name)
+	}
+}
+
+func TestPaginationPaths(t *testing.T) {
+	pagination := &load.Pagination{PageLimitPath: ".paging.limit", MaxPagesPath: `.paging.pages | tonumber`, PageNextPath: ".paging.next", NextLinkPath: ".links[0].href", NextLinkHost: "http://localhost"}
+	page, err := paginationPaths(pagination, []byte(`{"paging":{"limit":50,"pages":"4","next":3},"links":[{"href":"/next"}]}`), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 50, pagination.PageLimit)
+	assert.Equal(t, 4, pagination.MaxPages)
+	assert.Equal(t, paginationPage{pageNext: 3, hasNext: true, link: "http://localhost/next", total: -1}, page)
+
+	_, err = paginationPaths(&load.Pagination{TotalPath: ".total |"}, []byte(`{}`), nil)
+	assert.Error(t, err)
+	_, err = paginationPaths(&load.Pagination{TotalPath: ".total"}, []byte(`not json`), nil)
+	assert.Error(t, err)
+
+	for value, empty := range map[string]bool{`null`: true, `[]`: true, `{}`: true, `""`: true, `[1]`: false, `0`: false} {
+		var v interface{}
+		require.NoError(t, json.Unmarshal([]byte(value), &v))
+		assert.Equal(t, empty, paginationEmpty(v), value)
+	}
+}
@@ -8,6 +8,7 @@
 package inputs
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -71,7 +72,7 @@ func TestPrometheusRedis(t *testing.T) {
 
 	doLoop := true
 	dataStore := []interface{}{}
-	RunHTTP(&dataStore, &doLoop, &config, config.APIs[0], &config.APIs[0].URL)
+	RunHTTP(context.Background(), &dataStore, &doLoop, &config, config.APIs[0], &config.APIs[0].URL)
 
 	if len(expectedDatastore) != len(dataStore) {
 		t.Errorf("Incorrect number of samples generated expected: %d, got: %d", len(expectedDatastore), len(dataStore))
@@ -142,7 +143,7 @@ func TestPrometheusNginx(t *testing.T) {
 
 	doLoop := true
 	dataStore := []interface{}{}
-	RunHTTP(&dataStore, &doLoop, &config, config.APIs[0], &config.APIs[0].URL)
+	RunHTTP(context.Background(), &dataStore, &doLoop, &config, config.APIs[0], &config.APIs[0].URL)
 
 	if len(expectedDatastore) != len(dataStore) {
 		t.Errorf("Incorrect number of samples generated expected: %d, got: %d", len(expectedDatastore), len(dataStore))
@@ -206,7 +207,7 @@ func TestPrometheusNginx2(t *testing.T) {
 
 	doLoop := true
 	dataStore := []interface{}{}
-	RunHTTP(&dataStore, &doLoop, &config, config.APIs[0], &config.APIs[0].URL)
+	RunHTTP(context.Background(), &dataStore, &doLoop, &config, config.APIs[0], &config.APIs[0].URL)
 
 	if len(expectedDatastore) != len(dataStore) {
 		t.Errorf("Incorrect number of samples generated expected: %d, got: %d", len(expectedDatastore), len(dataStore))
@@ -269,7 +270,7 @@ func TestPrometheusNginx3(t *testing.T) {
 
 	doLoop := true
 	dataStore := []interface{}{}
-	RunHTTP(&dataStore, &doLoop, &config, config.APIs[0], &config.APIs[0].URL)
+	RunHTTP(context.Background(), &dataStore, &doLoop, &config, config.APIs[0], &config.APIs[0].URL)
 
 	if len(expectedDatastore) != len(dataStore) {
 		t.Errorf("Incorrect number of samples generated expected: %d, got: %d", len(expectedDatastore), len(dataStore))
@@ -0,0 +1,182 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/parnurzeal/gorequest"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRetryBackoff    = time.Second
+	defaultRetryMaxBackoff = 30 * time.Second
+)
+
+var defaultRetryStatusCodes = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// httpRetry retry settings of an api, set api settings take precedence over the global ones
+type httpRetry struct {
+	retries     int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	jitter      float64
+	statusCodes []int
+}
+
+func newHTTPRetry(yml *load.Config, api load.API) httpRetry {
+	settings := yml.Global.Retry
+	if api.Retry.Retries != nil {
+		settings.Retries = api.Retry.Retries
+	}
+	if api.Retry.Backoff != "" {
+		settings.Backoff = api.Retry.Backoff
+	}
+	if api.Retry.MaxBackoff != "" {
+		settings.MaxBackoff = api.Retry.MaxBackoff
+	}
+	if api.Retry.Jitter > 0 {
+		settings.Jitter = api.Retry.Jitter
+	}
+	if len(api.Retry.StatusCodes) > 0 {
+		settings.StatusCodes = api.Retry.StatusCodes
+	}
+
+	retry := httpRetry{
+		backoff:     retryDuration(yml, "backoff", settings.Backoff, defaultRetryBackoff),
+		maxBackoff:  retryDuration(yml, "max_backoff", settings.MaxBackoff, defaultRetryMaxBackoff),
+		jitter:      settings.Jitter,
+		statusCodes: settings.StatusCodes,
+	}
+	if settings.Retries != nil {
+		retry.retries = *settings.Retries
+	}
+	if len(retry.statusCodes) == 0 {
+		retry.statusCodes = defaultRetryStatusCodes
+	}
+	return retry
+}
+
+func retryDuration(yml *load.Config, setting string, value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		load.Logrus.WithFields(logrus.Fields{
+			"name":  yml.Name,
+			setting: value,
+		}).WithError(err).Errorf("http: invalid retry %s, using %s", setting, fallback)
+		return fallback
+	}
+	return duration
+}
+
+// retryable checks if the attempt failed with a connection error, a timeout or a retryable status code
+func (r httpRetry) retryable(resp gorequest.Response, errs []error) bool {
+	if resp == nil {
+		return len(errs) > 0
+	}
+	for _, code := range r.statusCodes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the delay before the retry following the attempt, attempts counting from 0,
+// false when the server asks to retry later than the max backoff
+func (r httpRetry) delay(attempt int, resp gorequest.Response) (time.Duration, bool) {
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return retryAfter, retryAfter <= r.maxBackoff
+		}
+	}
+	delay := r.backoff
+	for i := 0; i < attempt && delay < r.maxBackoff; i++ {
+		delay *= 2
+	}
+	if r.jitter > 0 {
+		delay += time.Duration(float64(delay) * r.jitter * (2*rand.Float64() - 1))
+	}
+	if delay > r.maxBackoff {
+		delay = r.maxBackoff
+	}
+	return delay, true
+}
+
+// parseRetryAfter parses a Retry-After header, either in seconds or as an http date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// endWithRetries sends the request, retrying failed attempts with an exponential backoff until the retries run out
+// or the context is done, each attempt is bounded by the request timeout and the context deadline
+func endWithRetries(ctx context.Context, request *gorequest.SuperAgent, yml *load.Config, api load.API, reqURL string) (gorequest.Response, []error) {
+	retry := newHTTPRetry(yml, api)
+	timeout := request.Client.Timeout
+	for attempt := 0; ; attempt++ {
+		// gorequest doesn't take a context, so bound the whole request by its deadline
+		request.Client.Timeout = contextTimeout(ctx, timeout)
+		request.Errors = nil
+		resp, body, errs := request.End()
+		load.StatusCounterIncrement("HttpRequests")
+		countBytes(yml, api, len(body))
+
+		if attempt >= retry.retries || ctx.Err() != nil || !retry.retryable(resp, errs) {
+			return resp, errs
+		}
+		delay, ok := retry.delay(attempt, resp)
+		if !ok {
+			load.Logrus.WithFields(logrus.Fields{
+				"name":        yml.Name,
+				"url":         reqURL,
+				"retry_after": delay.String(),
+			}).Debug("http: retry after exceeds max_backoff, not retrying")
+			return resp, errs
+		}
+
+		fields := logrus.Fields{
+			"name":    yml.Name,
+			"url":     reqURL,
+			"attempt": attempt + 1,
+			"delay":   delay.String(),
+		}
+		if resp != nil {
+			fields["status"] = resp.StatusCode
+		}
+		if len(errs) > 0 {
+			fields["errors"] = errs
+		}
+		load.Logrus.WithFields(fields).Debug("http: request failed, retrying")
+
+		select {
+		case <-ctx.Done():
+			return resp, errs
+		case <-time.After(delay):
+		}
+		load.StatusCounterIncrement("HttpRetries")
+	}
+}
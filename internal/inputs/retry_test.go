@@ -0,0 +1,138 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestRunHTTPRetries(t *testing.T) {
+	load.Refresh()
+
+	var count int
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		count++
+		switch count {
+		case 1:
+			writer.WriteHeader(http.StatusBadGateway)
+		case 2:
+			writer.Header().Set("Retry-After", "0")
+			writer.WriteHeader(http.StatusTooManyRequests)
+		default:
+			writer.Header().Set("Content-Type", "application/json")
+			_, err := writer.Write([]byte(`{"status":"up"}`))
+			require.NoError(t, err)
+		}
+	}))
+	defer server.Close()
+
+	config := load.Config{
+		Name:   "retries",
+		Global: load.Global{BaseURL: server.URL, Retry: load.Retry{Retries: retries(1), Backoff: "1ms"}},
+		APIs:   []load.API{{Name: "status", URL: "/", Retry: load.Retry{Retries: retries(3)}}},
+	}
+	var dataStore []interface{}
+	loop := true
+	RunHTTP(context.Background(), &dataStore, &loop, &config, config.APIs[0], &config.APIs[0].URL)
+
+	require.Len(t, dataStore, 1)
+	assert.Equal(t, "up", dataStore[0].(map[string]interface{})["status"])
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 2, load.StatusCounterRead("HttpRetries"))
+	assert.Equal(t, 3, load.StatusCounterRead("HttpRequests"))
+}
+
+func TestRunHTTPRetriesExhausted(t *testing.T) {
+	load.Refresh()
+
+	var count int
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		count++
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(http.StatusNotFound)
+		_, err := writer.Write([]byte(`{"error":"not found"}`))
+		require.NoError(t, err)
+	}))
+	defer server.Close()
+
+	config := load.Config{
+		Name: "retries",
+		APIs: []load.API{{Name: "status", URL: server.URL, Retry: load.Retry{Retries: retries(2), Backoff: "1ms", StatusCodes: []int{404}}}},
+	}
+	var dataStore []interface{}
+	loop := true
+	RunHTTP(context.Background(), &dataStore, &loop, &config, config.APIs[0], &config.APIs[0].URL)
+
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 2, load.StatusCounterRead("HttpRetries"))
+}
+
+func retries(n int) *int {
+	return &n
+}
+
+func TestNewHTTPRetry(t *testing.T) {
+	yml := &load.Config{Global: load.Global{Retry: load.Retry{Retries: retries(3), Backoff: "2s"}}}
+
+	// unset api settings fall back to the global ones
+	retry := newHTTPRetry(yml, load.API{})
+	assert.Equal(t, 3, retry.retries)
+	assert.Equal(t, 2*time.Second, retry.backoff)
+
+	// an api can turn off the global retries
+	retry = newHTTPRetry(yml, load.API{Retry: load.Retry{Retries: retries(0)}})
+	assert.Equal(t, 0, retry.retries)
+	assert.Equal(t, 2*time.Second, retry.backoff)
+
+	assert.Equal(t, 0, newHTTPRetry(&load.Config{}, load.API{}).retries)
+}
+
+func TestHTTPRetryDelay(t *testing.T) {
+	retry := newHTTPRetry(&load.Config{}, load.API{Retry: load.Retry{Retries: retries(5), Backoff: "100ms", MaxBackoff: "1s"}})
+	var delays []time.Duration
+	for attempt := 0; attempt < 5; attempt++ {
+		delay, ok := retry.delay(attempt, nil)
+		require.True(t, ok)
+		delays = append(delays, delay)
+	}
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}, delays)
+
+	retry.jitter = 0.5
+	for attempt := 0; attempt < 20; attempt++ {
+		delay, _ := retry.delay(0, nil)
+		assert.True(t, delay >= 50*time.Millisecond && delay <= 150*time.Millisecond, delay)
+	}
+
+	resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": []string{"5"}}}
+	delay, ok := retry.delay(0, resp)
+	assert.Equal(t, 5*time.Second, delay)
+	assert.False(t, ok)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	delay, ok := parseRetryAfter("120", now)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, delay)
+
+	delay, ok = parseRetryAfter("Wed, 01 Jan 2020 12:00:30 GMT", now)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, delay)
+
+	_, ok = parseRetryAfter("soon", now)
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("", now)
+	assert.False(t, ok)
+}
@@ -6,6 +6,7 @@
 package inputs
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -19,30 +20,67 @@ import (
 	"golang.org/x/crypto/ssh"
 )
 
-// RunScpWithTimeout performs scp with timeout to gather data from a remote file.
-func RunScpWithTimeout(dataStore *[]interface{}, cfg *load.Config, api load.API) error {
+// RunScpWithTimeout performs scp with timeout to gather data from a remote file, the transfer is aborted once the context is done.
+func RunScpWithTimeout(ctx context.Context, dataStore *[]interface{}, cfg *load.Config, api load.API) error {
 	load.Logrus.Debugf("%v - running scp requests", cfg.Name)
-	remoteFile := api.Scp.RemoteFile
 
-	client, err := getSSHConnection(cfg, api)
+	var fileContent []byte
+	var err error
+	key := api.Scp.Host + ":" + api.Scp.RemoteFile
+	if replaying() {
+		fileContent, err = replayInput(cfg, api, fixtureScp, key)
+	} else {
+		fileContent, err = readRemoteFile(ctx, cfg, api)
+		if recording() {
+			recordInput(cfg, api, fixtureScp, key, fileContent, err)
+		}
+	}
+	countBytes(cfg, api, len(fileContent))
 	if err != nil {
 		return err
 	}
 
-	srcFile, err := client.Open(remoteFile)
+	return handleScpJSON(dataStore, fileContent)
+}
+
+func readRemoteFile(ctx context.Context, cfg *load.Config, api load.API) ([]byte, error) {
+	remoteFile := api.Scp.RemoteFile
+
+	client, err := getSSHConnection(ctx, cfg, api)
 	if err != nil {
-		return fmt.Errorf("ssh: failed to open source file: %s, error: %v", remoteFile, err)
+		return nil, err
 	}
+	defer client.Close()
 
-	fileContent, err := ioutil.ReadAll(srcFile)
-	if err != nil {
-		return fmt.Errorf("ssh: failed to read file: %s, error: %v", remoteFile, err)
+	type result struct {
+		content []byte
+		err     error
 	}
+	done := make(chan result, 1)
+	go func() {
+		srcFile, err := client.Open(remoteFile)
+		if err != nil {
+			done <- result{err: fmt.Errorf("ssh: failed to open source file: %s, error: %v", remoteFile, err)}
+			return
+		}
+		fileContent, err := ioutil.ReadAll(srcFile)
+		if err != nil {
+			done <- result{err: fmt.Errorf("ssh: failed to read file: %s, error: %v", remoteFile, err)}
+			return
+		}
+		done <- result{content: fileContent}
+	}()
 
-	return handleScpJSON(dataStore, fileContent)
+	// closing the client on return aborts the transfer when the context is done first
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("ssh: cancelled reading file: %s, error: %v", remoteFile, ctx.Err())
+	case r := <-done:
+		return r.content, r.err
+	}
 }
 
-func getSSHConnection(yml *load.Config, api load.API) (*sftp.Client, error) {
+func getSSHConnection(ctx context.Context, yml *load.Config, api load.API) (*sftp.Client, error) {
 	var user string
 	var timeout time.Duration
 
@@ -62,6 +100,7 @@ func getSSHConnection(yml *load.Config, api load.API) (*sftp.Client, error) {
 	} else {
 		timeout = load.DefaultPingTimeout
 	}
+	timeout = contextTimeout(ctx, timeout)
 
 	authMethod, err := getAuthMethod(yml, api)
 	if err != nil {
@@ -6,6 +6,7 @@
 package inputs
 
 import (
+	"context"
 	"testing"
 
 	"github.com/newrelic/nri-flex/internal/load"
@@ -68,7 +69,7 @@ func TestGetSSHConnection(t *testing.T) {
 		},
 	}
 
-	_, err := getSSHConnection(&config, config.APIs[0])
+	_, err := getSSHConnection(context.Background(), &config, config.APIs[0])
 	expectedErr := "ssh: failed to connect to sftp host: 8.8.8.8, with user newrelic, error: dial tcp 8.8.8.8:22: i/o timeout"
 	if err != nil {
 		if err.Error() != expectedErr {
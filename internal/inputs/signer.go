@@ -0,0 +1,98 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/newrelic/nri-flex/internal/aliyun"
+	"github.com/newrelic/nri-flex/internal/awssigner"
+	"github.com/newrelic/nri-flex/internal/huaweihws"
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/parnurzeal/gorequest"
+)
+
+// requestSigner signs a request in place, by setting its headers or its query
+type requestSigner interface {
+	Sign(r *http.Request) error
+}
+
+// signerProviders builds the signer of each provider, nil when the provider isn't configured on the api,
+// a new provider is added here
+var signerProviders = []struct {
+	name string
+	new  func(api load.API) (requestSigner, error)
+}{
+	{"aliyun", func(api load.API) (requestSigner, error) {
+		if api.AliyunSigner.Key == "" || api.AliyunSigner.Secret == "" {
+			return nil, nil
+		}
+		return &aliyunSigner{aliyun.Signer{Key: api.AliyunSigner.Key, Secret: api.AliyunSigner.Secret}}, nil
+	}},
+	{"huaweihws", func(api load.API) (requestSigner, error) {
+		if api.HWSigner.Key == "" || api.HWSigner.Secret == "" {
+			return nil, nil
+		}
+		return &huaweihws.Signer{Key: api.HWSigner.Key, Secret: api.HWSigner.Secret}, nil
+	}},
+	{"aws", func(api load.API) (requestSigner, error) {
+		if api.AWSSigner.Service == "" {
+			return nil, nil
+		}
+		return awssigner.NewSigner(api.AWSSigner)
+	}},
+}
+
+// aliyunSigner the aliyun signer returns the signed url instead of setting it on the request
+type aliyunSigner struct {
+	aliyun.Signer
+}
+
+func (s *aliyunSigner) Sign(r *http.Request) error {
+	signedURL, err := s.Signer.Sign(r)
+	if err != nil {
+		return err
+	}
+	r.URL, err = url.Parse(signedURL)
+	return err
+}
+
+// signRequest signs the request with the signers configured on the api, the headers and url they set are copied
+// to the request, so signing must be the last change to the request before it is sent
+func signRequest(request *gorequest.SuperAgent, api load.API) error {
+	for _, provider := range signerProviders {
+		signer, err := provider.new(api)
+		if err != nil {
+			return fmt.Errorf("http: %s signer: %v", provider.name, err)
+		}
+		if signer == nil {
+			continue
+		}
+		r, err := request.MakeRequest()
+		if err != nil {
+			return fmt.Errorf("http: %s signer failed to convert request: %v", provider.name, err)
+		}
+		unsignedURL := r.URL.String()
+		unsigned := http.Header{}
+		for key, values := range r.Header {
+			unsigned[key] = values
+		}
+		if err := signer.Sign(r); err != nil {
+			return fmt.Errorf("http: %s signer failed to sign the request: %v", provider.name, err)
+		}
+		if signedURL := r.URL.String(); signedURL != unsignedURL {
+			request.Url = signedURL
+		}
+		for key := range r.Header {
+			if value := r.Header.Get(key); value != unsigned.Get(key) {
+				request.Set(key, value)
+			}
+		}
+	}
+	return nil
+}
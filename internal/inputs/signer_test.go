@@ -0,0 +1,97 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/parnurzeal/gorequest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+// awsSignatureHandler signs the received request again with the signed headers and compares the signatures
+func awsSignatureHandler(t *testing.T) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		authorization := request.Header.Get("Authorization")
+		signedHeaders := authorization[strings.Index(authorization, "SignedHeaders=")+len("SignedHeaders="):]
+		signedHeaders = signedHeaders[:strings.Index(signedHeaders, ",")]
+		body, _ := ioutil.ReadAll(request.Body)
+
+		expected, _ := http.NewRequest(request.Method, "http://"+request.Host+request.URL.RequestURI(), strings.NewReader(string(body)))
+		for _, key := range strings.Split(signedHeaders, ";") {
+			if key != "host" {
+				expected.Header.Set(key, request.Header.Get(key))
+			}
+		}
+		signTime, _ := time.Parse("20060102T150405Z", request.Header.Get("X-Amz-Date"))
+		signer := v4.NewSigner(credentials.NewStaticCredentials("AKID", "SECRET", "TOKEN"))
+		_, err := signer.Sign(expected, strings.NewReader(string(body)), "es", "eu-west-1", signTime)
+		require.NoError(t, err)
+
+		if authorization != expected.Header.Get("Authorization") || request.Header.Get("X-Amz-Security-Token") != "TOKEN" {
+			writer.WriteHeader(http.StatusForbidden)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(`{"status":"ok"}`))
+	}
+}
+
+func TestRunHTTPAWSSigner(t *testing.T) {
+	load.Refresh()
+	server := httptest.NewServer(awsSignatureHandler(t))
+	defer server.Close()
+
+	signer := load.AWSSigner{Service: "es", Region: "eu-west-1", AccessKey: "AKID", SecretKey: "SECRET", SessionToken: "TOKEN"}
+	config := load.Config{
+		Name: "aws",
+		APIs: []load.API{
+			{Name: "get", URL: server.URL + "/_cluster/health?level=indices&pretty", AWSSigner: signer, Headers: map[string]string{"X-Custom": "a  b"}},
+			{Name: "post", URL: server.URL + "/_search", Method: http.MethodPost, Payload: `{"size":0}`, AWSSigner: signer},
+		},
+	}
+	for _, api := range config.APIs {
+		var dataStore []interface{}
+		loop := true
+		reqURL := api.URL
+		RunHTTP(context.Background(), &dataStore, &loop, &config, api, &reqURL)
+		require.Len(t, dataStore, 1, api.Name)
+		assert.Equal(t, "ok", dataStore[0].(map[string]interface{})["status"], api.Name)
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	// aliyun signs the query
+	request := gorequest.New().Get("http://ecs.aliyuncs.com/?Action=DescribeRegions")
+	require.NoError(t, signRequest(request, load.API{AliyunSigner: load.AliyunSigner{Key: "key", Secret: "secret"}}))
+	assert.Contains(t, request.Url, "Action=DescribeRegions")
+	assert.Contains(t, request.Url, "AccessKeyId=key")
+	assert.Contains(t, request.Url, "Signature=")
+
+	// huawei signs the headers
+	request = gorequest.New().Get("http://apig.example.com/v1/status")
+	require.NoError(t, signRequest(request, load.API{HWSigner: load.HWSigner{Key: "key", Secret: "secret"}}))
+	assert.Equal(t, "http://apig.example.com/v1/status", request.Url)
+	assert.True(t, strings.HasPrefix(request.Header["Authorization"], "SDK-HMAC-SHA256 Access=key"))
+	assert.NotEmpty(t, request.Header["X-Sdk-Date"])
+
+	// apis without a signer are left as they are
+	request = gorequest.New().Get("http://example.com/?b=1&a=2")
+	require.NoError(t, signRequest(request, load.API{}))
+	assert.Equal(t, "http://example.com/?b=1&a=2", request.Url)
+	assert.Empty(t, request.Header)
+}
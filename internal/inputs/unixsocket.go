@@ -0,0 +1,64 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+// unixSocketHost host of the requests sent to a unix socket, the servers listening on a socket ignore it
+const unixSocketHost = "http://localhost"
+
+// unixSocketURL splits a unix:///path/to.sock:/request/path url into the socket and the url of the request
+func unixSocketURL(rawURL string) (string, string, bool) {
+	if !strings.HasPrefix(strings.ToLower(rawURL), "unix://") {
+		return "", rawURL, false
+	}
+	socket, path := rawURL[len("unix://"):], ""
+	if i := strings.Index(socket, ":"); i >= 0 {
+		socket, path = socket[:i], socket[i+1:]
+	}
+	return socket, unixSocketRequestURL(path), true
+}
+
+// unixSocketRequestURL returns the url of a request path sent to a socket, next links can already be a full url
+func unixSocketRequestURL(path string) string {
+	lower := strings.ToLower(path)
+	switch {
+	case strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://"):
+		return path
+	case strings.HasPrefix(path, "/"):
+		return unixSocketHost + path
+	}
+	return unixSocketHost + "/" + path
+}
+
+// unixSocketKeyURL returns the unix url of a request sent to the socket, so the state kept per host such as circuits
+// and digest challenges is kept per socket instead of for the localhost host all sockets share
+func unixSocketKeyURL(socket string, reqURL string) string {
+	path := "/"
+	if u, err := url.Parse(reqURL); err == nil {
+		path = u.RequestURI()
+	}
+	return "unix://" + socket + ":" + path
+}
+
+// dialUnixSocket connects the request to the socket instead of the host of its url, keeping the timeout of the request
+func dialUnixSocket(request *gorequest.SuperAgent, socket string) {
+	dial := request.Transport.Dial
+	if dial == nil {
+		dial = net.Dial
+	}
+	request.Transport.Proxy = nil
+	request.Transport.DialContext = nil
+	request.Transport.Dial = func(_, _ string) (net.Conn, error) {
+		return dial("unix", socket)
+	}
+}
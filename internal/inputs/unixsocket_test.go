@@ -0,0 +1,103 @@
+// +build linux darwin
+
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package inputs
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestUnixSocketURL(t *testing.T) {
+	for rawURL, expected := range map[string][]string{
+		"unix:///var/run/docker.sock:/containers/json?all=1": {"/var/run/docker.sock", "http://localhost/containers/json?all=1"},
+		"UNIX:///run/php-fpm.sock:status":                    {"/run/php-fpm.sock", "http://localhost/status"},
+		"unix:///run/envoy.sock":                             {"/run/envoy.sock", "http://localhost/"},
+	} {
+		socket, socketURL, ok := unixSocketURL(rawURL)
+		assert.True(t, ok, rawURL)
+		assert.Equal(t, expected, []string{socket, socketURL}, rawURL)
+	}
+	_, socketURL, ok := unixSocketURL("http://localhost/status")
+	assert.False(t, ok)
+	assert.Equal(t, "http://localhost/status", socketURL)
+	assert.Equal(t, "http://localhost/next", unixSocketRequestURL("http://localhost/next"))
+
+	// the requests of each socket are keyed on the socket, not on localhost
+	keyURL := unixSocketKeyURL("/run/a.sock", "http://localhost/status?full=1")
+	assert.Equal(t, "unix:///run/a.sock:/status?full=1", keyURL)
+	assert.Equal(t, "unix:/run/a.sock", requestHost(keyURL))
+	assert.Equal(t, "localhost:8080", requestHost("http://localhost:8080/status"))
+
+	config := &load.Config{Name: "sockets"}
+	api := load.API{Name: "status", Breaker: load.CircuitBreaker{Failures: 1}}
+	load.Storer = persist.NewInMemoryStore()
+	defer func() { load.Storer = nil }()
+	assert.Equal(t, "host-unix:/run/a.sock", newCircuitBreaker(config, api, keyURL).key)
+	assert.Equal(t, "host-unix:/run/b.sock", newCircuitBreaker(config, api, unixSocketKeyURL("/run/b.sock", "http://localhost/status")).key)
+}
+
+func TestRunHTTPUnixSocket(t *testing.T) {
+	load.Refresh()
+	dir, err := ioutil.TempDir("", "flex-socket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	var requests []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		requests = append(requests, request.URL.RequestURI())
+		writer.Header().Set("Content-Type", "application/json")
+		if request.URL.Path == "/containers/json" && request.URL.Query().Get("page") == "" {
+			writer.Header().Set("Link", `</containers/json?page=2>; rel="next"`)
+		}
+		_, _ = writer.Write([]byte(`{"status":"ok"}`))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	for _, test := range []struct {
+		api      load.API
+		requests []string
+	}{
+		{
+			// the next link of the page is sent to the same socket
+			api:      load.API{Name: "containers", URL: "unix://" + socket + ":/containers/json"},
+			requests: []string{"/containers/json", "/containers/json?page=2"},
+		},
+		{
+			api:      load.API{Name: "info", URL: "/info", UnixSocket: socket, Timeout: 1000},
+			requests: []string{"/info"},
+		},
+	} {
+		requests = nil
+		config := load.Config{Name: "socket", APIs: []load.API{test.api}}
+		var dataStore []interface{}
+		loop := true
+		reqURL := test.api.URL
+		RunHTTP(context.Background(), &dataStore, &loop, &config, test.api, &reqURL)
+
+		assert.Equal(t, test.requests, requests, test.api.Name)
+		require.Len(t, dataStore, len(test.requests), test.api.Name)
+		assert.Equal(t, "ok", dataStore[0].(map[string]interface{})["status"], test.api.Name)
+	}
+}
@@ -1,6 +1,8 @@
 package load
 
 import (
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
@@ -16,11 +18,20 @@ var FlexStatusCounter = struct {
 	M map[string]int
 }{M: make(map[string]int)}
 
-// StatusCounterIncrement increment the status counter for a particular key
+// FlexStatusTotals status counters since Flex started, unlike FlexStatusCounter they are never reset by a run
+var FlexStatusTotals = struct {
+	sync.RWMutex
+	M map[string]int
+}{M: make(map[string]int)}
+
+// StatusCounterIncrement increment the status counter and its total for a particular key
 func StatusCounterIncrement(key string) {
 	FlexStatusCounter.Lock()
 	FlexStatusCounter.M[key]++
 	FlexStatusCounter.Unlock()
+	FlexStatusTotals.Lock()
+	FlexStatusTotals.M[key]++
+	FlexStatusTotals.Unlock()
 }
 
 // StatusCounterRead the status counter for a particular key
@@ -31,14 +42,241 @@ func StatusCounterRead(key string) int {
 	return value
 }
 
+// StatusCounterSnapshot copy of all status counters
+func StatusCounterSnapshot() map[string]int {
+	FlexStatusCounter.RLock()
+	snapshot := make(map[string]int, len(FlexStatusCounter.M))
+	for key, value := range FlexStatusCounter.M {
+		snapshot[key] = value
+	}
+	FlexStatusCounter.RUnlock()
+	return snapshot
+}
+
+// StatusCounterReset reset the status counters, returns the counters since the previous reset
+func StatusCounterReset() map[string]int {
+	FlexStatusCounter.Lock()
+	counters := FlexStatusCounter.M
+	FlexStatusCounter.M = map[string]int{"EventCount": 0, "EventDropCount": 0, "ConfigsProcessed": 0}
+	FlexStatusCounter.Unlock()
+	return counters
+}
+
+// StatusTotalsSnapshot copy of all status counters since Flex started
+func StatusTotalsSnapshot() map[string]int {
+	FlexStatusTotals.RLock()
+	snapshot := make(map[string]int, len(FlexStatusTotals.M))
+	for key, value := range FlexStatusTotals.M {
+		snapshot[key] = value
+	}
+	FlexStatusTotals.RUnlock()
+	return snapshot
+}
+
+// ConfigStatus last run status of a config
+type ConfigStatus struct {
+	Name       string `json:"name"`
+	File       string `json:"file"`
+	Runs       int    `json:"runs"`
+	LastRunMs  int64  `json:"lastRunMs"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ConfigStatusStore last run status of each config keyed by file and name
+var ConfigStatusStore = struct {
+	sync.RWMutex
+	M map[string]ConfigStatus
+}{M: make(map[string]ConfigStatus)}
+
+// ConfigStatusUpdate record a run of a config
+func ConfigStatusUpdate(cfg Config, start time.Time, duration time.Duration, err error) {
+	file := filepath.Join(cfg.FilePath, cfg.FileName)
+	key := file + ":" + cfg.Name
+
+	ConfigStatusStore.Lock()
+	status := ConfigStatusStore.M[key]
+	status.Name = cfg.Name
+	status.File = file
+	status.Runs++
+	status.LastRunMs = start.UnixNano() / int64(time.Millisecond)
+	status.DurationMs = duration.Nanoseconds() / int64(time.Millisecond)
+	status.Error = ""
+	if err != nil {
+		status.Error = err.Error()
+	}
+	ConfigStatusStore.M[key] = status
+	ConfigStatusStore.Unlock()
+}
+
+// configErrors the input errors of a config since they were last taken
+type configErrors struct {
+	count int
+	last  string
+}
+
+// ConfigErrorStore input errors of each config by name, recorded by the error samples while the config runs
+var ConfigErrorStore = struct {
+	sync.Mutex
+	M map[string]configErrors
+}{M: make(map[string]configErrors)}
+
+// ConfigErrorRecord record an input error of a config
+func ConfigErrorRecord(name string, detail string) {
+	ConfigErrorStore.Lock()
+	errors := ConfigErrorStore.M[name]
+	errors.count++
+	errors.last = detail
+	ConfigErrorStore.M[name] = errors
+	ConfigErrorStore.Unlock()
+}
+
+// ConfigErrorTake returns the number of input errors of a config and the last one, and clears them
+func ConfigErrorTake(name string) (int, string) {
+	ConfigErrorStore.Lock()
+	errors := ConfigErrorStore.M[name]
+	delete(ConfigErrorStore.M, name)
+	ConfigErrorStore.Unlock()
+	return errors.count, errors.last
+}
+
+// APIErrorStore number of input errors reported by each api of each config, it only increases
+// so a fetch can check if its input reported an error while it ran
+var APIErrorStore = struct {
+	sync.Mutex
+	M map[string]int
+}{M: make(map[string]int)}
+
+// APIErrorRecord record an input error of an api
+func APIErrorRecord(config string, api string) {
+	APIErrorStore.Lock()
+	APIErrorStore.M[config+"|"+api]++
+	APIErrorStore.Unlock()
+}
+
+// APIErrorCount returns the number of input errors reported by an api
+func APIErrorCount(config string, api string) int {
+	APIErrorStore.Lock()
+	defer APIErrorStore.Unlock()
+	return APIErrorStore.M[config+"|"+api]
+}
+
+// RunHealth when a config run last finished and the shortest interval configs run at, runs are stalled
+// when none finished for a few intervals
+var RunHealth = struct {
+	sync.RWMutex
+	Finished time.Time
+	Interval time.Duration
+}{}
+
+// RunHealthFinished record a config run finishing
+func RunHealthFinished(finished time.Time) {
+	RunHealth.Lock()
+	RunHealth.Finished = finished
+	RunHealth.Unlock()
+}
+
+// RunHealthInterval set the shortest interval configs run at, zero when nothing is scheduled
+func RunHealthInterval(interval time.Duration) {
+	RunHealth.Lock()
+	RunHealth.Interval = interval
+	RunHealth.Unlock()
+}
+
+// RunHealthStalled returns how long ago a run last finished, and if that is longer than the intervals allowed
+func RunHealthStalled(now time.Time, intervals int) (time.Duration, bool) {
+	RunHealth.RLock()
+	defer RunHealth.RUnlock()
+	since := now.Sub(RunHealth.Finished)
+	if RunHealth.Interval <= 0 || RunHealth.Finished.IsZero() {
+		return since, false
+	}
+	return since, since > time.Duration(intervals)*RunHealth.Interval
+}
+
+// ConfigStatusRead status of all configs sorted by file and name
+func ConfigStatusRead() []ConfigStatus {
+	ConfigStatusStore.RLock()
+	var keys []string
+	for key := range ConfigStatusStore.M {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	statuses := make([]ConfigStatus, 0, len(keys))
+	for _, key := range keys {
+		statuses = append(statuses, ConfigStatusStore.M[key])
+	}
+	ConfigStatusStore.RUnlock()
+	return statuses
+}
+
+// APIStats timing and volume of an api since the stats were last flushed, lookups of the api included
+type APIStats struct {
+	Name          string  `json:"name"`
+	File          string  `json:"file"`
+	API           string  `json:"api"`
+	Runs          int     `json:"runs"`
+	FetchMs       float64 `json:"fetchMs"`
+	ProcessMs     float64 `json:"processMs"`
+	Bytes         int64   `json:"bytes"`
+	Samples       int     `json:"samples"`
+	Dropped       int     `json:"dropped"`
+	LastSuccessMs int64   `json:"lastSuccessMs,omitempty"`
+}
+
+// APIStatsStore stats of each api keyed by file, config name and api name
+var APIStatsStore = struct {
+	sync.Mutex
+	M map[string]*APIStats
+}{M: make(map[string]*APIStats)}
+
+// APIStatsUpdate updates the stats of an api of the config
+func APIStatsUpdate(cfg *Config, api string, update func(stats *APIStats)) {
+	file := filepath.Join(cfg.FilePath, cfg.FileName)
+	key := file + ":" + cfg.Name + ":" + api
+
+	APIStatsStore.Lock()
+	stats, ok := APIStatsStore.M[key]
+	if !ok {
+		stats = &APIStats{Name: cfg.Name, File: file, API: api}
+		APIStatsStore.M[key] = stats
+	}
+	update(stats)
+	APIStatsStore.Unlock()
+}
+
+// APIStatsFlush stats of all apis sorted by file, config and api, the store is emptied
+func APIStatsFlush() []APIStats {
+	APIStatsStore.Lock()
+	var keys []string
+	for key := range APIStatsStore.M {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	stats := make([]APIStats, 0, len(keys))
+	for _, key := range keys {
+		stats = append(stats, *APIStatsStore.M[key])
+	}
+	APIStatsStore.M = make(map[string]*APIStats)
+	APIStatsStore.Unlock()
+	return stats
+}
+
 // Refresh Helper function used for testing
 func Refresh() {
-	FlexStatusCounter.M = make(map[string]int)
-	FlexStatusCounter.M["EventCount"] = 0
-	FlexStatusCounter.M["EventDropCount"] = 0
-	FlexStatusCounter.M["ConfigsProcessed"] = 0
+	StatusCounterReset()
+	FlexStatusTotals.Lock()
+	FlexStatusTotals.M = make(map[string]int)
+	FlexStatusTotals.Unlock()
 	Args.ConfigDir = ""
 	Args.ConfigFile = ""
 	Args.ContainerDiscovery = false
 	Args.ContainerDiscoveryDir = ""
+	SharedStoreEmpty()
+	APIStatsFlush()
+	ConfigErrorStore.Lock()
+	ConfigErrorStore.M = make(map[string]configErrors)
+	ConfigErrorStore.Unlock()
+	RunHealthFinished(time.Time{})
+	RunHealthInterval(0)
 }
@@ -7,11 +7,13 @@ package load
 
 import (
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	sdkArgs "github.com/newrelic/infra-integrations-sdk/args"
 	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/newrelic/infra-integrations-sdk/persist"
 	logrus "github.com/sirupsen/logrus"
 )
 
@@ -57,6 +59,23 @@ type ArgumentList struct {
 	StructuredLogs       bool   `default:"false" help:"output logs in Json structure format for external tool parsing"`
 	AllowEnvCommands     bool   `default:"false" help:"enable to allow the use of FLEX_CMD_PREPEND, FLEX_CMD_APPEND & FLEX_CMD_WRAP"`
 	StdinPipe            bool   `default:"false" help:"use cmd.StdinPipe for commands"`
+	Daemon               bool   `default:"false" help:"Keep Flex running and run each config on its own interval"`
+	DaemonInterval       string `default:"30s" help:"Default interval for configs that do not set one when running as a daemon"`
+	ReloadInterval       string `default:"30s" help:"How often to check for config changes when running as a daemon, 0 to disable"`
+	Validate             bool   `default:"false" help:"Validate the config files strictly and exit, non-zero if any are invalid"`
+	StatusAddr           string `default:"" help:"Serve health, status and Prometheus metrics of Flex on this address when running as a daemon eg. localhost:9100"`
+	GoldenFile           string `default:"" help:"Test the config against this golden file of expected samples, replaying the input fixtures instead of running the inputs"`
+	FixturesDir          string `default:"" help:"Directory of the recorded input fixtures used when testing against a golden file, defaults to fixtures next to the golden file"`
+	Update               bool   `default:"false" help:"Regenerate the golden file instead of comparing with it"`
+	RecordDir            string `default:"" help:"Record the raw output of the inputs as fixtures into this directory"`
+	ReplayDir            string `default:"" help:"Replay the fixtures recorded into this directory instead of running the inputs"`
+	ExplainConfig        string `default:"" help:"Run only this config and print a trace of how each sample changes through every processing step"`
+	ExplainAPI           string `default:"" help:"Limit the explain trace to this api of the explained config"`
+	RunTimeout           string `default:"0" help:"Cancel the configs still running after this duration eg. 25s, 0 to disable"`
+	MaxConcurrency       int    `default:"0" help:"Maximum number of configs, and of inputs across all configs, running at once, 0 for unlimited"`
+	MaxConfigConcurrency int    `default:"0" help:"Maximum number of inputs of a config running at once eg. async lookups, 0 for unlimited"`
+	MaxHostConcurrency   int    `default:"0" help:"Maximum number of inputs connecting to the same host at once, 0 for unlimited"`
+	StatsSamples         bool   `default:"false" help:"Create a flexConfigSample per config and a flexApiSample per api with their fetch and processing times and data volumes"`
 }
 
 // Args Infrastructure SDK Arguments List
@@ -74,6 +93,13 @@ var IgnoredIntegrationData []map[string]interface{}
 // Entity Infrastructure SDK Entity
 var Entity *integration.Entity
 
+// EntityLock guards the entities against being published while samples are written to them,
+// samples are written holding it for reading so configs still write concurrently
+var EntityLock sync.RWMutex
+
+// Storer Infrastructure SDK Storer, persisted when the integration is published
+var Storer persist.Storer
+
 // Hostname current host
 var Hostname string
 
@@ -132,10 +158,20 @@ const (
 	TypeJSON           = "json"
 	TypeXML            = "xml"
 	TypeCSV            = "csv"
+	TypeNDJSON         = "ndjson"
+	TypeYAML           = "yaml"
+	TypeHTML           = "html"
+	TypeText           = "text"
 	TypeColumns        = "columns"
 	Contains           = "contains"
 )
 
+// AuthTypes http auth types that can be set with auth_type, an empty auth type is basic auth
+var AuthTypes = []string{"basic", "digest", "ntlm"}
+
+// ResponseFormats formats that can be set with response_format, an empty format is detected from the response
+var ResponseFormats = []string{TypeJSON, TypeNDJSON, TypeXML, TypeHTML, TypeCSV, TypeYAML, TypeText}
+
 // MetricsStore for Dimensional Metrics to store data and lock and unlock when needed
 var MetricsStore = struct {
 	sync.RWMutex
@@ -146,6 +182,81 @@ var CacheStoreLock = struct {
 	sync.RWMutex
 }{}
 
+// SharedCachePrefix prefix of cache keys reading from the shared store, eg. cache: shared:token
+const SharedCachePrefix = "shared:"
+
+// SharedStore data sets published by apis with publish_as, readable from any config
+var SharedStore = struct {
+	sync.RWMutex
+	Data map[string][]interface{}
+}{Data: map[string][]interface{}{}}
+
+// SharedStorePublish publishes a copy of the data set under the name, replacing the previous one,
+// the producer keeps processing its own samples
+func SharedStorePublish(name string, data []interface{}) {
+	data = copyDataSet(data)
+	SharedStore.Lock()
+	SharedStore.Data[name] = data
+	SharedStore.Unlock()
+}
+
+// SharedStoreRead returns a copy of the data set published under the name, nil if nothing was published,
+// so configs reading it at the same time can each process their own samples
+func SharedStoreRead(name string) []interface{} {
+	SharedStore.RLock()
+	defer SharedStore.RUnlock()
+	return copyDataSet(SharedStore.Data[name])
+}
+
+// copyDataSet copies the samples of a data set and the maps and slices nested in them
+func copyDataSet(data []interface{}) []interface{} {
+	if data == nil {
+		return nil
+	}
+	return copyData(data).([]interface{})
+}
+
+func copyData(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			copied[key] = copyData(nested)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, nested := range v {
+			copied[i] = copyData(nested)
+		}
+		return copied
+	case map[string]string:
+		copied := make(map[string]string, len(v))
+		for key, nested := range v {
+			copied[key] = nested
+		}
+		return copied
+	}
+	return value
+}
+
+// SharedStoreEmpty empties the shared store
+func SharedStoreEmpty() {
+	SharedStore.Lock()
+	SharedStore.Data = map[string][]interface{}{}
+	SharedStore.Unlock()
+}
+
+// CacheRead returns the cached data set of the key, from the shared store when the key has the shared prefix
+func CacheRead(cfg *Config, key string) []interface{} {
+	if strings.HasPrefix(key, SharedCachePrefix) {
+		return SharedStoreRead(strings.TrimPrefix(key, SharedCachePrefix))
+	}
+	CacheStoreLock.RLock()
+	defer CacheStoreLock.RUnlock()
+	return cfg.Datastore[key]
+}
+
 // MetricsStoreAppend Append data to store
 func MetricsStoreAppend(metrics Metrics) {
 	MetricsStore.Lock()
@@ -195,6 +306,10 @@ type Config struct {
 	Secrets            map[string]Secret              `yaml:"secrets"`
 	CustomAttributes   map[string]string              `yaml:"custom_attributes"` // set additional custom attributes
 	MetricAPI          bool                           `yaml:"metric_api"`        // enable use of the dimensional data models metric api
+	Interval           string                         `yaml:"interval"`          // run interval when running as a daemon eg. 15s, 10m
+	Timeout            string                         `yaml:"timeout"`           // cancel the config if still running after this duration eg. 20s
+	MaxConcurrency     int                            `yaml:"max_concurrency"`   // maximum number of inputs of the config running at once, overrides max_config_concurrency
+	DependsOn          []string                       `yaml:"depends_on"`        // names of the configs to run before this one
 }
 
 // Secret Struct
@@ -228,11 +343,15 @@ type ContainerDiscovery struct {
 type Global struct {
 	BaseURL    string `yaml:"base_url"`
 	User, Pass string
+	AuthType   string `yaml:"auth_type"` // basic, digest or ntlm, how user and pass authenticate http requests, default basic
 	Proxy      string
 	Timeout    int
 	Headers    map[string]string `yaml:"headers"`
 	Jmx        JMX               `yaml:"jmx"`
 	TLSConfig  TLSConfig         `yaml:"tls_config"`
+	Retry      Retry             `yaml:"retry"`
+	Breaker    CircuitBreaker    `yaml:"circuit_breaker"`
+	OAuth2     OAuth2            `yaml:"oauth2"`
 	Passphrase string            `yaml:"pass_phrase"`
 	SSHPEMFile string            `yaml:"ssh_pem_file"`
 }
@@ -249,6 +368,33 @@ type TLSConfig struct {
 	ServerName         string `yaml:"server_name"`
 }
 
+// Retry HTTP retry settings, set per api or in global
+type Retry struct {
+	Retries     *int    `yaml:"retries"`      // number of retries after the first attempt, 0 in an api turns off the global retries
+	Backoff     string  `yaml:"backoff"`      // delay before the first retry, doubled on each retry eg. 500ms, default 1s
+	MaxBackoff  string  `yaml:"max_backoff"`  // maximum delay between attempts eg. 30s, default 30s
+	Jitter      float64 `yaml:"jitter"`       // randomize each delay by up to this fraction of it eg. 0.2
+	StatusCodes []int   `yaml:"status_codes"` // status codes to retry, default 429, 502, 503 and 504
+}
+
+// CircuitBreaker stops requesting an endpoint after consecutive failures, set per api or in global
+type CircuitBreaker struct {
+	Failures int    `yaml:"failures"` // consecutive failed requests opening the circuit, 0 disables the breaker
+	OpenFor  string `yaml:"open_for"` // how long the circuit stays open before a probe request is let through eg. 5m, default 1m
+	Key      string `yaml:"key"`      // host or api, whether requests to the same host share a circuit, default host
+}
+
+// OAuth2 fetches a bearer token from a token endpoint and sends it with the http requests, set per api or in global
+type OAuth2 struct {
+	TokenURL     string   `yaml:"token_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+	Audience     string   `yaml:"audience"`
+	RefreshToken string   `yaml:"refresh_token"` // use the refresh_token grant instead of client_credentials
+	AuthStyle    string   `yaml:"auth_style"`    // header or params, how the client credentials are sent, default header
+}
+
 // SampleMerge merge multiple samples into one (will remove previous samples)
 type SampleMerge struct {
 	EventType string   `yaml:"event_type"` // new event_type name for the sample
@@ -274,9 +420,11 @@ type API struct {
 	File              string            `yaml:"file"`
 	URL               string            `yaml:"url"`
 	Pagination        Pagination        `yaml:"pagination"`
+	GraphQL           GraphQL           `yaml:"graphql"` // send a graphql query to the url, walking the pages of its cursor
 	EscapeURL         bool              `yaml:"escape_url"`
 	Prometheus        Prometheus        `yaml:"prometheus"`
-	Cache             string            `yaml:"cache"` // read data from datastore
+	Cache             string            `yaml:"cache"`      // read data from datastore, or from the shared store with shared:<name>
+	PublishAs         string            `yaml:"publish_as"` // publish the fetched data to the shared store under this name
 	Database          string            `yaml:"database"`
 	DBDriver          string            `yaml:"db_driver"`
 	DBConn            string            `yaml:"db_conn"`
@@ -284,15 +432,22 @@ type API struct {
 	CommandsAsync     bool              `yaml:"commands_async"` // run commands async
 	Commands          []Command         `yaml:"commands"`
 	DBQueries         []Command         `yaml:"db_queries"`
-	DBAsync           bool              `yaml:"db_async"`   // perform db queries async
-	Jq                string            `yaml:"jq"`         // parse data using jq
-	ParseHTML         bool              `yaml:"parse_html"` // parse text/html content type table element to JSON
+	DBAsync           bool              `yaml:"db_async"`        // perform db queries async
+	Jq                string            `yaml:"jq"`              // parse data using jq
+	ParseHTML         bool              `yaml:"parse_html"`      // parse text/html content type table element to JSON
+	ResponseFormat    string            `yaml:"response_format"` // json, ndjson, xml, html, csv, yaml or text, overrides the content type of the response
 	Jmx               JMX               `yaml:"jmx"`
 	IgnoreLines       []int             // not implemented - idea is to ignore particular lines starting from 0 of the command output
 	User, Pass        string
+	AuthType          string `yaml:"auth_type"` // overrides the global auth_type
 	Proxy             string
+	UnixSocket        string    `yaml:"unix_socket"` // path of a unix socket to send the requests to, the url is the request path eg. /containers/json
+	Timing            bool      `yaml:"timing"`      // add the dns, connect, tls handshake, first byte and total times of the request to its samples
 	TLSConfig         TLSConfig `yaml:"tls_config"`
 	Timeout           int
+	Retry             Retry          `yaml:"retry"`           // overrides the global retry settings that are set
+	Breaker           CircuitBreaker `yaml:"circuit_breaker"` // overrides the global circuit breaker settings that are set
+	OAuth2            OAuth2         `yaml:"oauth2"`          // replaces the global oauth2 settings when its token_url is set
 	Method            string
 	Payload           string
 	Headers           map[string]string `yaml:"headers"`
@@ -311,8 +466,13 @@ type API struct {
 	SplitArray        bool              `yaml:"split_array"`        // convert array to samples, use SetHeader to set attribute name
 	LeafArray         bool              `yaml:"leaf_array"`         // convert array element to samples when SplitArray, use SetHeader to set attribute name
 	Scp               SCP               `yaml:"scp"`
-	HWSigner          HWSigner          `yaml:"hw_signer"`     // Huawei Cloud Service API signer
-	AliyunSigner      AliyunSigner      `yaml:"aliyun_signer"` // Huawei Cloud Service API signer
+	HWSigner          HWSigner          `yaml:"hw_signer"`      // Huawei Cloud Service API signer
+	AliyunSigner      AliyunSigner      `yaml:"aliyun_signer"`  // Huawei Cloud Service API signer
+	AWSSigner         AWSSigner         `yaml:"aws_signer"`     // AWS signature version 4 signer
+	RunEvery          int               `yaml:"run_every"`      // only run every N executions
+	MinInterval       string            `yaml:"min_interval"`   // only run if at least this long has passed since the last run eg. 5m
+	ReplayOnSkip      bool              `yaml:"replay_on_skip"` // replay the data from the last run when skipped by run_every or min_interval
+	CacheTTL          string            `yaml:"cache_ttl"`      // serve the fetched data from the storer until it expires eg. 1h, and when the input fails
 	// Key manipulation
 	ToLower      bool              `yaml:"to_lower"`       // convert all unicode letters mapped to their lower case.
 	ConvertSpace string            `yaml:"convert_space"`  // convert spaces to another char
@@ -420,6 +580,15 @@ type Assert struct {
 	NotMatch string `yaml:"not_match"` // continue if output does not match this string
 }
 
+// GraphQL query sent with its variables, the pages are walked while the pageInfo of the response has a next page
+type GraphQL struct {
+	Query          string                 `yaml:"query"`
+	Variables      map[string]interface{} `yaml:"variables"`
+	PageInfo       string                 `yaml:"page_info"`       // path of the pageInfo object under data eg. repository.issues.pageInfo, found automatically when not set
+	CursorVariable string                 `yaml:"cursor_variable"` // variable set to the endCursor of the previous page, defaults to after
+	MaxPages       int                    `yaml:"max_pages"`       // stop after this many pages, 0 walks all the pages
+}
+
 // Pagination handles request pagination
 type Pagination struct {
 	// internal attribute use
@@ -446,6 +615,15 @@ type Pagination struct {
 
 	NextLinkKey  string `yaml:"next_link_key"`  // look for a next link key to browse too
 	NextLinkHost string `yaml:"next_link_host"` // set next link host - useful when next_link_key returns a partial URL, e.g "/mynextlinkABC", the next link will be {next_link_host}/mynextlinkABC
+
+	// jq expressions evaluated against the parsed body, the response headers are available as $headers eg. $headers["X-Next-Cursor"]
+	NextCursorPath string `yaml:"next_cursor_path"` // next cursor to query next, the walk stops when there is none eg. .meta.next_cursor
+	NextLinkPath   string `yaml:"next_link_path"`   // next link to browse too, prefixed with next_link_host, the walk stops when there is none
+	PageNextPath   string `yaml:"page_next_path"`   // next page to walk too
+	PageLimitPath  string `yaml:"page_limit_path"`  // limit / page size / offset to use
+	MaxPagesPath   string `yaml:"max_pages_path"`   // max number of pages to walk
+	PayloadPath    string `yaml:"payload_path"`     // items of the page, the walk stops on an empty page eg. .data.items
+	TotalPath      string `yaml:"total_path"`       // total number of items, the walk stops once the offset in ${page} reaches it
 }
 
 // RegMatch support for regex matches
@@ -511,6 +689,18 @@ type AliyunSigner struct {
 	Secret string `yaml:"secret"`
 }
 
+// AWSSigner struct, the explicit keys are used when set, otherwise the credentials of the profile
+// or of the default credential chain
+type AWSSigner struct {
+	Service      string `yaml:"service"` // eg. es, execute-api, aps
+	Region       string `yaml:"region"`  // defaults to the region of the profile or of AWS_REGION
+	AccessKey    string `yaml:"access_key"`
+	SecretKey    string `yaml:"secret_key"`
+	SessionToken string `yaml:"session_token"`
+	Profile      string `yaml:"profile"`
+	RoleARN      string `yaml:"role_arn"` // role assumed with the credentials
+}
+
 // Parse struct
 type Parse struct {
 	Type    string   `yaml:"type"` // perform a contains, match, hasPrefix or regex for specified key
@@ -0,0 +1,108 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package outputs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+// Error classes of a flexErrorSample
+const (
+	ErrorClassTimeout = "timeout"
+	ErrorClassAuth    = "auth"
+	ErrorClassParse   = "parse"
+	ErrorClassConnect = "connect"
+	ErrorClassOther   = "other"
+)
+
+// errorDetailLimit error details longer than this are truncated
+const errorDetailLimit = 1024
+
+var (
+	redactUserInfo = regexp.MustCompile(`(://)[^/\s:@]+:[^/\s@]+@`)
+	redactBearer   = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[^\s"',;]+`)
+	redactKeyValue = regexp.MustCompile(`(?i)\b((?:[a-z_-]*(?:password|passwd|pwd|secret|token|api[_-]?key|apikey|access[_-]?key|credentials?))["']?\s*[=:]\s*["']?)[^\s&"',;}]+`)
+
+	authPattern    = regexp.MustCompile(`(?i)\b(401|403|unauthori[sz]ed|forbidden|authentication|permission denied|access denied|invalid credentials)\b`)
+	timeoutPattern = regexp.MustCompile(`(?i)(timeout|timed out|deadline exceeded|signal: killed)`)
+	parsePattern   = regexp.MustCompile(`(?i)(unmarshal|parse|parsing|invalid character|unexpected end of|syntax error|failed to convert)`)
+	connectPattern = regexp.MustCompile(`(?i)(connection refused|connection reset|no such host|network is unreachable|no route to host|dial |EOF|broken pipe|handshake)`)
+)
+
+// ErrorSample creates a flexErrorSample for a failed input or processing stage,
+// the error class is derived from the error and its detail is redacted
+func ErrorSample(config, api, input string, err error) {
+	load.EntityLock.RLock()
+	defer load.EntityLock.RUnlock()
+	if err == nil {
+		return
+	}
+	detail := RedactError(err.Error())
+	load.ConfigErrorRecord(config, detail)
+	load.APIErrorRecord(config, api)
+	if load.Entity == nil {
+		return
+	}
+	class := ErrorClass(err)
+	load.StatusCounterIncrement("EventCount")
+	load.StatusCounterIncrement("flexErrorSample")
+	load.StatusCounterIncrement("Errors." + class)
+
+	errorMetricSet := load.Entity.NewMetricSet("flexErrorSample")
+	statusLog(errorMetricSet.SetMetric("name", config, metric.ATTRIBUTE))
+	if api != "" {
+		statusLog(errorMetricSet.SetMetric("api", api, metric.ATTRIBUTE))
+	}
+	statusLog(errorMetricSet.SetMetric("input", input, metric.ATTRIBUTE))
+	statusLog(errorMetricSet.SetMetric("errorClass", class, metric.ATTRIBUTE))
+	statusLog(errorMetricSet.SetMetric("error", detail, metric.ATTRIBUTE))
+}
+
+// ErrorClass classifies an error as timeout, auth, parse, connect or other
+func ErrorClass(err error) string {
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return ErrorClassParse
+	}
+
+	// most inputs wrap errors in strings, fall back on the message
+	message := err.Error()
+	switch {
+	case timeoutPattern.MatchString(message):
+		return ErrorClassTimeout
+	case authPattern.MatchString(message):
+		return ErrorClassAuth
+	case connectPattern.MatchString(message) || errors.As(err, &netErr):
+		return ErrorClassConnect
+	case parsePattern.MatchString(message):
+		return ErrorClassParse
+	}
+	return ErrorClassOther
+}
+
+// RedactError removes credentials from an error detail, eg. passwords in urls and connection strings, and tokens
+func RedactError(detail string) string {
+	detail = redactUserInfo.ReplaceAllString(detail, "${1}<redacted>@")
+	detail = redactBearer.ReplaceAllString(detail, "$1 <redacted>")
+	detail = strings.TrimSpace(redactKeyValue.ReplaceAllString(detail, "${1}<redacted>"))
+	if len(detail) > errorDetailLimit {
+		detail = detail[:errorDetailLimit] + "..."
+	}
+	return detail
+}
@@ -23,12 +23,12 @@ func InfraIntegration() error {
 		return fmt.Errorf("flex: failed to get the hostname while creating integration")
 	}
 
-	storer, err := createStorer()
+	load.Storer, err = createStorer()
 	if err != nil {
 		return fmt.Errorf("can't create custom store: %s", err)
 	}
 
-	load.Integration, err = Integration.New(load.IntegrationName, load.IntegrationVersion, Integration.Args(&load.Args), Integration.Storer(storer))
+	load.Integration, err = Integration.New(load.IntegrationName, load.IntegrationVersion, Integration.Args(&load.Args), Integration.Storer(load.Storer))
 	if err != nil {
 		return fmt.Errorf("flex: failed to create integration %v", err)
 	}
@@ -49,6 +49,16 @@ func InfraIntegration() error {
 	return nil
 }
 
+// ResetEntity re-creates the entity, required after publishing as the integration is cleared
+func ResetEntity() error {
+	var err error
+	load.Entity, err = createEntity(load.Args.Local, load.Args.Entity)
+	if err != nil {
+		return fmt.Errorf("flex: failed create entity: %v", err)
+	}
+	return nil
+}
+
 func createEntity(isLocalEntity bool, entityName string) (*Integration.Entity, error) {
 	if isLocalEntity {
 		return load.Integration.LocalEntity(), nil
@@ -0,0 +1,122 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package outputs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/sirupsen/logrus"
+)
+
+// healthzIntervals /healthz fails when no config run finished for this many of the shortest config interval
+const healthzIntervals = 3
+
+// StartStatusServer serves /healthz, /status and /metrics on the status address in the background
+func StartStatusServer(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("status: failed to listen on %s, %v", addr, err)
+	}
+
+	load.Logrus.WithFields(logrus.Fields{"addr": listener.Addr().String()}).Info("status: serving flex status")
+	go func() {
+		if err := http.Serve(listener, statusHandler()); err != nil {
+			load.Logrus.WithError(err).Error("status: server stopped")
+		}
+	}()
+	return nil
+}
+
+func statusHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if since, stalled := load.RunHealthStalled(time.Now(), healthzIntervals); stalled {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "stalled: no config run finished in %v\n", since.Round(time.Second))
+			return
+		}
+		_, _ = io.WriteString(w, "ok\n")
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		status := map[string]interface{}{
+			"name":        load.IntegrationName,
+			"version":     load.IntegrationVersion,
+			"hostname":    load.Hostname,
+			"startTimeMs": load.StartTime,
+			"counters":    load.StatusTotalsSnapshot(),
+			"configs":     load.ConfigStatusRead(),
+		}
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			load.Logrus.WithError(err).Error("status: failed to write status")
+		}
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = io.WriteString(w, prometheusMetrics())
+	})
+	return mux
+}
+
+// prometheusMetrics the counters and config statuses in the Prometheus text format
+func prometheusMetrics() string {
+	var b strings.Builder
+
+	b.WriteString("# HELP flex_info Flex version.\n# TYPE flex_info gauge\n")
+	fmt.Fprintf(&b, "flex_info{version=\"%s\"} 1\n", promLabel(load.IntegrationVersion))
+
+	counters := load.StatusTotalsSnapshot()
+	var names []string
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b.WriteString("# HELP flex_counter_total Flex status counters since Flex started.\n# TYPE flex_counter_total counter\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "flex_counter_total{name=\"%s\"} %d\n", promLabel(name), counters[name])
+	}
+
+	configs := load.ConfigStatusRead()
+	metrics := []struct {
+		name, help string
+		value      func(load.ConfigStatus) float64
+	}{
+		{"flex_config_runs_total", "Number of times the config ran.", func(s load.ConfigStatus) float64 { return float64(s.Runs) }},
+		{"flex_config_last_run_timestamp_seconds", "Time the config last ran.", func(s load.ConfigStatus) float64 { return float64(s.LastRunMs) / 1000 }},
+		{"flex_config_duration_seconds", "Duration of the last run of the config.", func(s load.ConfigStatus) float64 { return float64(s.DurationMs) / 1000 }},
+		{"flex_config_error", "1 if the last run of the config failed.", func(s load.ConfigStatus) float64 {
+			if s.Error != "" {
+				return 1
+			}
+			return 0
+		}},
+	}
+	for _, metric := range metrics {
+		metricType := "gauge"
+		if strings.HasSuffix(metric.name, "_total") {
+			metricType = "counter"
+		}
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metricType)
+		for _, status := range configs {
+			fmt.Fprintf(&b, "%s{config=\"%s\",file=\"%s\"} %g\n", metric.name, promLabel(status.Name), promLabel(status.File), metric.value(status))
+		}
+	}
+	return b.String()
+}
+
+// promLabel escapes a Prometheus label value
+func promLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
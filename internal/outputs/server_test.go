@@ -0,0 +1,75 @@
+package outputs
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestStatusHandler(t *testing.T) {
+	load.Refresh()
+	load.StatusCounterIncrement("EventCount")
+	// a publish resets the status counters, not their totals
+	load.StatusCounterReset()
+	load.StatusCounterIncrement("EventCount")
+	load.ConfigStatusUpdate(load.Config{Name: "good", FileName: "good.yml"}, time.Unix(100, 0), 2*time.Second, nil)
+	load.ConfigStatusUpdate(load.Config{Name: "bad", FileName: "bad.yml"}, time.Unix(100, 0), 0, errors.New("failed"))
+
+	server := httptest.NewServer(statusHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/status")
+	require.NoError(t, err)
+	var status struct {
+		Counters map[string]int
+		Configs  []load.ConfigStatus
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	resp.Body.Close()
+	assert.Equal(t, 2, status.Counters["EventCount"])
+	assert.Equal(t, 1, load.StatusCounterRead("EventCount"))
+	require.Len(t, status.Configs, 2)
+	assert.Equal(t, "bad", status.Configs[0].Name)
+	assert.Equal(t, "failed", status.Configs[0].Error)
+	assert.Equal(t, int64(2000), status.Configs[1].DurationMs)
+
+	// the runs stall once none finished for three times the shortest interval
+	load.RunHealthInterval(10 * time.Second)
+	load.RunHealthFinished(time.Now().Add(-20 * time.Second))
+	resp, err = http.Get(server.URL + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	load.RunHealthFinished(time.Now().Add(-time.Minute))
+	resp, err = http.Get(server.URL + "/healthz")
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Contains(t, string(body), "stalled: no config run finished in 1m0s")
+
+	metrics := prometheusMetrics()
+	assert.Contains(t, metrics, `flex_counter_total{name="EventCount"} 2`)
+	assert.Contains(t, metrics, `flex_config_error{config="bad",file="bad.yml"} 1`)
+	assert.Contains(t, metrics, `flex_config_duration_seconds{config="good",file="good.yml"} 2`)
+	assert.Contains(t, metrics, `flex_config_runs_total{config="good",file="good.yml"} 1`)
+}
+
+func TestPromLabel(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\nd`, promLabel("a\"b\\c\nd"))
+}
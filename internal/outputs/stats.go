@@ -0,0 +1,99 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package outputs
+
+import (
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+// StatsSamples creates a flexApiSample for each api and a flexConfigSample for each config run since the last stats
+// when stats_samples is enabled, so slow or failing configs can be found without turning on debug logs
+func StatsSamples() {
+	// the stats are flushed either way so they don't pile up when running as a daemon
+	apiStats := load.APIStatsFlush()
+	if !load.Args.StatsSamples || load.Entity == nil {
+		return
+	}
+
+	configs := map[string]*load.APIStats{}
+	for _, stats := range apiStats {
+		stats := stats
+		stats.LastSuccessMs = lastSuccess(stats)
+
+		apiSample := load.Entity.NewMetricSet("flexApiSample")
+		statusLog(apiSample.SetMetric("name", stats.Name, metric.ATTRIBUTE))
+		statusLog(apiSample.SetMetric("file", stats.File, metric.ATTRIBUTE))
+		statusLog(apiSample.SetMetric("api", stats.API, metric.ATTRIBUTE))
+		setStats(apiSample, &stats)
+		statusLog(apiSample.SetMetric("runs", stats.Runs, metric.GAUGE))
+
+		key := stats.File + ":" + stats.Name
+		total, ok := configs[key]
+		if !ok {
+			total = &load.APIStats{}
+			configs[key] = total
+		}
+		total.Runs++ // runs of the config total are its apis
+		total.FetchMs += stats.FetchMs
+		total.ProcessMs += stats.ProcessMs
+		total.Bytes += stats.Bytes
+		total.Samples += stats.Samples
+		total.Dropped += stats.Dropped
+		if stats.LastSuccessMs > total.LastSuccessMs {
+			total.LastSuccessMs = stats.LastSuccessMs
+		}
+	}
+
+	for _, status := range load.ConfigStatusRead() {
+		// configs keep their status between runs of the daemon, only report the ones run since the start of this run
+		if status.LastRunMs < load.StartTime {
+			continue
+		}
+		total, ok := configs[status.File+":"+status.Name]
+		if !ok {
+			total = &load.APIStats{}
+		}
+		configSample := load.Entity.NewMetricSet("flexConfigSample")
+		statusLog(configSample.SetMetric("name", status.Name, metric.ATTRIBUTE))
+		statusLog(configSample.SetMetric("file", status.File, metric.ATTRIBUTE))
+		statusLog(configSample.SetMetric("durationMs", status.DurationMs, metric.GAUGE))
+		statusLog(configSample.SetMetric("apis", total.Runs, metric.GAUGE))
+		setStats(configSample, total)
+		if status.Error != "" {
+			statusLog(configSample.SetMetric("error", RedactError(status.Error), metric.ATTRIBUTE))
+		}
+	}
+}
+
+func setStats(metricSet *metric.Set, stats *load.APIStats) {
+	statusLog(metricSet.SetMetric("fetchMs", stats.FetchMs, metric.GAUGE))
+	statusLog(metricSet.SetMetric("processMs", stats.ProcessMs, metric.GAUGE))
+	statusLog(metricSet.SetMetric("bytes", stats.Bytes, metric.GAUGE))
+	statusLog(metricSet.SetMetric("samples", stats.Samples, metric.GAUGE))
+	statusLog(metricSet.SetMetric("samplesDropped", stats.Dropped, metric.GAUGE))
+	if stats.LastSuccessMs > 0 {
+		statusLog(metricSet.SetMetric("lastSuccessMs", stats.LastSuccessMs, metric.GAUGE))
+	}
+}
+
+// lastSuccess returns when the api last fetched its data successfully, the time is kept in the store
+// so it is also known after runs that failed
+func lastSuccess(stats load.APIStats) int64 {
+	if load.Storer == nil {
+		return stats.LastSuccessMs
+	}
+	key := "flex-last-success-" + stats.File + ":" + stats.Name + ":" + stats.API
+	if stats.LastSuccessMs > 0 {
+		load.Storer.Set(key, stats.LastSuccessMs)
+		return stats.LastSuccessMs
+	}
+	var lastSuccessMs int64
+	if _, err := load.Storer.Get(key, &lastSuccessMs); err != nil {
+		return 0
+	}
+	return lastSuccessMs
+}
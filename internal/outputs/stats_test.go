@@ -0,0 +1,90 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package outputs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/newrelic/infra-integrations-sdk/persist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestStatsSamples(t *testing.T) {
+	load.Refresh()
+	defer load.Refresh()
+	load.Storer = persist.NewInMemoryStore()
+	defer func() { load.Storer = nil }()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestStatsSamples", "nri-flex")
+
+	load.Args.StatsSamples = true
+	defer func() { load.Args.StatsSamples = false }()
+	load.StartTime = load.MakeTimestamp()
+	cfg := &load.Config{Name: "slow", FileName: "slow.yml"}
+	load.ConfigStatusUpdate(*cfg, time.Now(), 3*time.Second, errors.New("http: token=abc rejected"))
+	load.ConfigStatusUpdate(load.Config{Name: "old", FileName: "old.yml"}, time.Unix(100, 0), time.Second, nil)
+	load.APIStatsUpdate(cfg, "first", func(stats *load.APIStats) {
+		stats.Runs = 2
+		stats.FetchMs = 2500
+		stats.ProcessMs = 10
+		stats.Bytes = 2048
+		stats.Samples = 20
+		stats.Dropped = 5
+		stats.LastSuccessMs = 1000
+	})
+	load.APIStatsUpdate(cfg, "second", func(stats *load.APIStats) {
+		stats.Runs = 1
+		stats.FetchMs = 500
+		stats.Bytes = 10
+		stats.Samples = 1
+	})
+	StatsSamples()
+
+	require.Len(t, load.Entity.Metrics, 3)
+	first := load.Entity.Metrics[0].Metrics
+	assert.Equal(t, "flexApiSample", first["event_type"])
+	assert.Equal(t, "slow", first["name"])
+	assert.Equal(t, "slow.yml", first["file"])
+	assert.Equal(t, "first", first["api"])
+	assert.Equal(t, 2500.0, first["fetchMs"])
+	assert.Equal(t, 2048.0, first["bytes"])
+	assert.Equal(t, 20.0, first["samples"])
+	assert.Equal(t, 5.0, first["samplesDropped"])
+	assert.Equal(t, 1000.0, first["lastSuccessMs"])
+	assert.Equal(t, 2.0, first["runs"])
+	assert.NotContains(t, load.Entity.Metrics[1].Metrics, "lastSuccessMs")
+
+	config := load.Entity.Metrics[2].Metrics
+	assert.Equal(t, "flexConfigSample", config["event_type"])
+	assert.Equal(t, "slow", config["name"])
+	assert.Equal(t, 3000.0, config["durationMs"])
+	assert.Equal(t, 2.0, config["apis"])
+	assert.Equal(t, 3000.0, config["fetchMs"])
+	assert.Equal(t, 2058.0, config["bytes"])
+	assert.Equal(t, 21.0, config["samples"])
+	assert.Equal(t, 1000.0, config["lastSuccessMs"])
+	assert.Equal(t, "http: token=<redacted> rejected", config["error"])
+
+	// a failed run still reports when the api last succeeded
+	load.Entity.Metrics = nil
+	load.APIStatsUpdate(cfg, "first", func(stats *load.APIStats) { stats.Runs = 1 })
+	StatsSamples()
+	require.Len(t, load.Entity.Metrics, 2)
+	assert.Equal(t, 1000.0, load.Entity.Metrics[0].Metrics["lastSuccessMs"])
+
+	load.Entity.Metrics = nil
+	load.Args.StatsSamples = false
+	load.APIStatsUpdate(cfg, "first", func(stats *load.APIStats) { stats.Runs = 1 })
+	StatsSamples()
+	assert.Empty(t, load.Entity.Metrics)
+	assert.Empty(t, load.APIStatsFlush())
+}
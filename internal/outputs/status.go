@@ -10,8 +10,8 @@ import (
 	"github.com/newrelic/nri-flex/internal/load"
 )
 
-// StatusSample creates flexStatusSample
-func StatusSample() {
+// StatusSample creates flexStatusSample with the given status counters
+func StatusSample(counters map[string]int) {
 	flexStatusSample := load.Entity.NewMetricSet("flexStatusSample")
 	endTimeNs := load.MakeTimestamp()
 	statusLog(flexStatusSample.SetMetric("flex.time.endMs", endTimeNs, metric.GAUGE))
@@ -43,7 +43,7 @@ func StatusSample() {
 	if load.ServerlessExecutionEnv != "" {
 		statusLog(flexStatusSample.SetMetric("flex.ServerlessExecutionEnv", load.ServerlessExecutionEnv, metric.ATTRIBUTE))
 	}
-	for counter, value := range load.FlexStatusCounter.M {
+	for counter, value := range counters {
 		statusLog(flexStatusSample.SetMetric("flex.counter."+counter, value, metric.GAUGE))
 	}
 	for pid, val := range load.DiscoveredProcesses {
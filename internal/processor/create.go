@@ -25,12 +25,20 @@ const regex = "regex"
 // CreateMetricSets creates metric sets
 // hren added samplesToMerge parameter, moved merge operation to CreateMetricSets so that the "Run...." functions still apply before merge
 func CreateMetricSets(samples []interface{}, config *load.Config, i int, mergeMetric bool, samplesToMerge *load.SamplesToMerge, originalAPINo int) {
+	load.EntityLock.RLock()
+	defer load.EntityLock.RUnlock()
 	api := config.APIs[i]
+	created, dropped := 0, 0
 	// as it stands we know that this always receives map[string]interface{}'s
-	for _, sample := range samples {
+	for n, sample := range samples {
 		currentSample := sample.(map[string]interface{})
+		trace := newTrace(config, i, "sample")
+		trace.start(currentSample)
+
 		eventType := "UnknownSample" // set an UnknownSample event name
 		SetEventType(&currentSample, &eventType, api.EventType, api.Merge, api.Name)
+		trace.step("SetEventType", currentSample)
+		trace.note("SetEventType", "event type %s", eventType)
 
 		// add custom attribute(s)
 		// global
@@ -41,6 +49,7 @@ func CreateMetricSets(samples []interface{}, config *load.Config, i int, mergeMe
 		for k, v := range api.CustomAttributes {
 			currentSample[k] = v
 		}
+		trace.step("custom_attributes", currentSample)
 
 		// init lookup store
 		if (&config.LookupStore) == nil { //nolint
@@ -53,6 +62,8 @@ func CreateMetricSets(samples []interface{}, config *load.Config, i int, mergeMe
 			if load.StatusCounterRead("EventDropCount") == 1 { // don't output the message more then once
 				load.Logrus.Errorf("flex: event limit %d has been reached, please increase if required", load.Args.EventLimit)
 			}
+			trace.note("event limiter", "dropped, event limit %d reached", load.Args.EventLimit)
+			dropped += len(samples) - n
 			break
 		}
 
@@ -62,15 +73,25 @@ func CreateMetricSets(samples []interface{}, config *load.Config, i int, mergeMe
 		var modifiedKeys []string
 		for k, v := range currentSample { // k == original key
 			key := k
+			keyTrace := trace.key(k, v)
 			RunKeyConversion(&key, api, v, &SkipProcessing)
+			keyTrace.step("RunKeyConversion", key, v)
 			RunValConversion(&v, api, &key)
+			keyTrace.step("RunValConversion", key, v)
 			RunValueParser(&v, api, &key)
+			keyTrace.step("RunValueParser", key, v)
 			RunPluckNumbers(&v, api, &key)
-			RunSubParse(api.SubParse, &currentSample, key, v)        // subParse key pairs (see redis example)
-			RunValueTransformer(&v, api, &key)                       // Needs to be run before KeyRenamer and KeyReplacer
+			keyTrace.step("RunPluckNumbers", key, v)
+			RunSubParse(api.SubParse, &currentSample, key, v) // subParse key pairs (see redis example)
+			trace.step("RunSubParse", currentSample)
+			RunValueTransformer(&v, api, &key) // Needs to be run before KeyRenamer and KeyReplacer
+			keyTrace.step("RunValueTransformer", key, v)
 			RunValueMapper(api.ValueMapper, &currentSample, key, &v) // valueMapper
+			keyTrace.step("RunValueMapper", key, v)
+			trace.step("RunValueMapper", currentSample)
 
 			RunTimestampConversion(&v, api, &key)
+			keyTrace.step("RunTimestampConversion", key, v)
 			// find keys with regex, convert date<=>timestamp
 			// timestamp_conversion:
 			//   started_at: TIMESTAMP::RFC3339
@@ -81,6 +102,7 @@ func CreateMetricSets(samples []interface{}, config *load.Config, i int, mergeMe
 			if !sliceContains(modifiedKeys, k) {
 				RunKeyRenamer(api.RenameKeys, &key)  // use key renamer if key replace hasn't occurred
 				RunKeyRenamer(api.ReplaceKeys, &key) // kept for backwards compatibility with replace_keys
+				keyTrace.step("RunKeyRenamer", key, v)
 			}
 
 			currentSample[key] = v
@@ -88,15 +110,19 @@ func CreateMetricSets(samples []interface{}, config *load.Config, i int, mergeMe
 				modifiedKeys = append(modifiedKeys, key)
 				delete(currentSample, k)
 			}
+			trace.sync(currentSample)
 
 			// if keepkeys used will do inverse
 			RunKeepKeys(api.KeepKeys, &key, &currentSample)
+			trace.step("RunKeepKeys", currentSample)
 			RunSampleRenamer(api.RenameSamples, &currentSample, key, &eventType)
+			trace.step("RunSampleRenamer", currentSample)
 		}
 
 		// addAttribute is kept outside the first currentSample loop intentionally
 		// if an attribute is added to the currentSample while in the loop it will restart the loop
 		addAttribute(currentSample, api.AddAttribute)
+		trace.step("addAttribute", currentSample)
 
 		// lookups should be performed after addAttribute to ensure anything constructed is available for lookup creation
 		// if run_async is set to true for the API, we will skip StoreLookups and VariableLookups processing due to potential concurrent map write operation
@@ -123,6 +149,7 @@ func CreateMetricSets(samples []interface{}, config *load.Config, i int, mergeMe
 			createSample = false
 			currentSample["event_type"] = eventType
 			load.IgnoredIntegrationData = append(load.IgnoredIntegrationData, currentSample)
+			trace.note("ignore_output", "not created, kept for lookups only")
 		} else {
 			// check if this contains any key pair values to filter out
 			excludeSample := true
@@ -137,6 +164,9 @@ func CreateMetricSets(samples []interface{}, config *load.Config, i int, mergeMe
 				} else {
 					RunSampleFilter(currentSample, api.SampleIncludeFilter, &excludeSample)
 					runSampleFilterExperimental = false
+					if excludeSample {
+						trace.note("RunSampleFilter", "dropped, no match for sample_include_filter")
+					}
 				}
 			}
 			// check sample_exclude_filter and sample_filter, only if it passes sample_include_filter filter or there is no sample_include_filter defined
@@ -144,14 +174,31 @@ func CreateMetricSets(samples []interface{}, config *load.Config, i int, mergeMe
 				createSample = true
 				if runSampleFilterExperimental {
 					RunSampleFilterMatchAll(currentSample, api.SampleIncludeMatchAllFilter, &createSample)
+					if !createSample {
+						trace.note("RunSampleFilterMatchAll", "dropped, no match for sample_include_match_all_filter")
+					}
+				}
+				if createSample {
+					RunSampleFilter(currentSample, api.SampleFilter, &createSample)
+					if !createSample {
+						trace.note("RunSampleFilter", "dropped by sample_filter")
+					}
 				}
-				RunSampleFilter(currentSample, api.SampleFilter, &createSample)
-				RunSampleFilter(currentSample, api.SampleExcludeFilter, &createSample)
+				if createSample {
+					RunSampleFilter(currentSample, api.SampleExcludeFilter, &createSample)
+					if !createSample {
+						trace.note("RunSampleFilter", "dropped by sample_exclude_filter")
+					}
+				}
+			}
+			if !createSample {
+				dropped++
 			}
 		}
 
 		if createSample {
 			RunMathCalculations(&api.Math, &currentSample)
+			trace.step("RunMathCalculations", currentSample)
 
 			// inject some additional attributes if set
 			if config.Global.BaseURL != "" {
@@ -161,15 +208,19 @@ func CreateMetricSets(samples []interface{}, config *load.Config, i int, mergeMe
 			// remove keys from sample
 			// this should be kept last
 			RunKeyRemover(&currentSample, api.RemoveKeys)
+			trace.step("RunKeyRemover", currentSample)
 
 			// hren: if it is not mergeMetric, it will proceed to publish metric
 			if !mergeMetric {
 				workingEntity := setEntity(api.Entity, api.EntityType) // default type instance
 				if config.MetricAPI {
 					AutoSetMetricAPI(&currentSample, &api)
+					trace.note("AutoSetMetricAPI", "created metrics")
 				} else {
 					AutoSetStandard(&currentSample, &api, workingEntity, eventType, config)
+					trace.note("AutoSetStandard", "created %s", eventType)
 				}
+				created++
 			} else {
 				// hren: it is mergeMetric, add the metric to mergeData, which will be published later
 				currentSample["_originalAPINo"] = originalAPINo
@@ -178,11 +229,19 @@ func CreateMetricSets(samples []interface{}, config *load.Config, i int, mergeMe
 				// (*samplesToMerge)[config.APIs[i].Merge] = append((*samplesToMerge)[config.APIs[i].Merge], currentSample)
 
 				samplesToMerge.SampleAppend(config.APIs[i].Merge, currentSample)
+				trace.note("merge", "merged into %s", config.APIs[i].Merge)
 			}
 
 		}
 
 	}
+	if created > 0 || dropped > 0 {
+		load.APIStatsUpdate(config, api.Name, func(stats *load.APIStats) {
+			stats.Samples += created
+			stats.Dropped += dropped
+		})
+	}
+
 	//Save samples if specified
 	if api.SaveOutput != "" {
 		saveSamples(samples, api.SaveOutput)
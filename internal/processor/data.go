@@ -11,6 +11,7 @@ import (
 
 	"github.com/itchyny/gojq"
 	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/outputs"
 	"github.com/sirupsen/logrus"
 )
 
@@ -23,7 +24,11 @@ func RunDataHandler(dataSets []interface{}, samplesToMerge *load.SamplesToMerge,
 	}).Debug("processor-data: running data handler")
 
 	if cfg.APIs[i].Jq != "" {
-		dataSets = runJq(dataSets, cfg.APIs[i])
+		var err error
+		dataSets, err = runJq(dataSets, cfg.APIs[i])
+		if err != nil {
+			outputs.ErrorSample(cfg.Name, cfg.APIs[i].Name, "jq", err)
+		}
 	}
 
 	for _, dataSet := range dataSets {
@@ -50,18 +55,27 @@ func processDataSet(dataSet *map[string]interface{}, samplesToMerge *load.Sample
 		cfg.LookupStore = map[string]map[string]struct{}{}
 	}
 
+	trace := newTrace(cfg, i, "dataset")
+	trace.start(ds)
+
 	FindStartKey(&ds, cfg.APIs[i].StartKey, cfg.APIs[i].InheritAttributes) // start at a later part in the received data
-	StripKeys(&ds, cfg.APIs[i].StripKeys)                                  // remove before flattening
-	RunLazyFlatten(&ds, cfg, i)                                            // perform lazy flatten if needed
+	trace.step("FindStartKey", ds)
+	StripKeys(&ds, cfg.APIs[i].StripKeys) // remove before flattening
+	trace.step("StripKeys", ds)
+	RunLazyFlatten(&ds, cfg, i) // perform lazy flatten if needed
+	trace.step("RunLazyFlatten", ds)
 	flattenedData := FlattenData(ds, map[string]interface{}{}, "", cfg.APIs[i].SampleKeys, &cfg.APIs[i])
+	trace.step("FlattenData", flattenedData)
 
 	// also strip from flattened data
 	for _, stripKey := range cfg.APIs[i].StripKeys {
 		delete(flattenedData, stripKey)
 		delete(flattenedData, stripKey+"Samples")
 	}
+	trace.step("StripKeys", flattenedData)
 
 	mergedData := FinalMerge(flattenedData)
+	trace.note("FinalMerge", "%d sample(s) created", len(mergedData))
 
 	if cfg.APIs[i].Merge == "" {
 		CreateMetricSets(mergedData, cfg, i, false, nil, originalAPINo)
@@ -70,7 +84,8 @@ func processDataSet(dataSet *map[string]interface{}, samplesToMerge *load.Sample
 	}
 }
 
-func runJq(dataSets interface{}, api load.API) []interface{} {
+// runJq runs the jq query of the api on the data sets, returns the error when the query fails
+func runJq(dataSets interface{}, api load.API) ([]interface{}, error) {
 	// due to the current design, dataSets is always a slice
 	// so an api that returns a map will still be a slice returned for processing
 	// for better usability if there is no array prefix access the first item in the slice automatically for the user
@@ -87,7 +102,7 @@ func runJq(dataSets interface{}, api load.API) []interface{} {
 		load.Logrus.WithFields(logrus.Fields{
 			"api": api.Name,
 		}).WithError(err).Error("jq: failed to parse")
-		return []interface{}{}
+		return []interface{}{}, fmt.Errorf("jq: failed to parse %s: %v", api.Jq, err)
 	}
 
 	tempDataSets := []interface{}{}
@@ -101,18 +116,18 @@ func runJq(dataSets interface{}, api load.API) []interface{} {
 
 		switch value := v.(type) {
 		case []interface{}:
-			return value
+			return value, nil
 		case map[string]interface{}:
 			tempDataSets = append(tempDataSets, value)
 		case error:
 			load.Logrus.WithFields(logrus.Fields{
 				"api": api.Name,
 				"jq":  api.Jq,
-			}).WithError(err).Debug("jq: failed to process")
-			return []interface{}{}
+			}).WithError(value).Debug("jq: failed to process")
+			return []interface{}{}, fmt.Errorf("jq: failed to process %s: %v", api.Jq, value)
 		}
 
 	}
 
-	return tempDataSets
+	return tempDataSets, nil
 }
@@ -22,7 +22,7 @@ func TestRunJq(t *testing.T) {
 		Jq: ".foo.data",
 	}
 
-	var dataSets = runJq(input, api)
+	var dataSets, _ = runJq(input, api)
 	var expectedResult = []interface{}{map[string]interface{}{"abc": 1, "def": 2}}
 
 	if len(dataSets) != len(expectedResult) {
@@ -62,7 +62,7 @@ func TestRunJqMultipleResults(t *testing.T) {
 		Jq: ".foo.data,.[0].foo.more_data",
 	}
 
-	var dataSets = runJq(input, api)
+	var dataSets, _ = runJq(input, api)
 	var expectedResult = []interface{}{
 		map[string]interface{}{"abc": 1, "def": 2},
 		map[string]interface{}{"ghi": 3, "jkl": 4},
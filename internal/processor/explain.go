@@ -0,0 +1,230 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+// explainValueLimit values longer than this are truncated in traces
+const explainValueLimit = 120
+
+// explaining set to 1 while explaining, checked before taking the explain lock so processing isn't serialized
+// on it otherwise
+var explaining int32
+
+// explain traces recorded for the explained config and api
+var explain = struct {
+	sync.Mutex
+	enabled     bool
+	config, api string
+	traces      []*Trace
+}{}
+
+// Trace the state of a data set or sample through each processing step
+type Trace struct {
+	Config string
+	API    string
+	Kind   string // dataset or sample
+	ID     int
+	Steps  []TraceStep
+
+	state map[string]string
+}
+
+// TraceStep a processing step with the changes it made, or a note about a decision it took
+type TraceStep struct {
+	Step    string
+	Changes []string
+}
+
+// keyTrace follows a single key through the key and value conversions
+type keyTrace struct {
+	trace      *Trace
+	key, value string
+}
+
+// StartExplain traces the processing of the samples of the config, and of a single api when set
+func StartExplain(config, api string) {
+	explain.Lock()
+	defer explain.Unlock()
+	explain.enabled = true
+	explain.config = config
+	explain.api = api
+	explain.traces = nil
+	atomic.StoreInt32(&explaining, 1)
+}
+
+// StopExplain stops tracing and returns the recorded traces
+func StopExplain() []*Trace {
+	explain.Lock()
+	defer explain.Unlock()
+	traces := explain.traces
+	explain.enabled = false
+	explain.traces = nil
+	atomic.StoreInt32(&explaining, 0)
+	return traces
+}
+
+// newTrace starts a trace when the api of the config is being explained, nil otherwise
+// all trace functions can be called on a nil trace so processing is unchanged when not explaining
+func newTrace(cfg *load.Config, i int, kind string) *Trace {
+	if atomic.LoadInt32(&explaining) == 0 {
+		return nil
+	}
+	explain.Lock()
+	defer explain.Unlock()
+	if !explain.enabled || cfg.Name != explain.config || (explain.api != "" && cfg.APIs[i].Name != explain.api) {
+		return nil
+	}
+
+	id := 1
+	for _, trace := range explain.traces {
+		if trace.Kind == kind {
+			id++
+		}
+	}
+	trace := &Trace{Config: cfg.Name, API: cfg.APIs[i].Name, Kind: kind, ID: id}
+	explain.traces = append(explain.traces, trace)
+	return trace
+}
+
+// start records the initial state of the data
+func (t *Trace) start(data map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	t.state = explainState(data)
+	var changes []string
+	for _, key := range sortedKeys(t.state) {
+		changes = append(changes, fmt.Sprintf("  %s: %s", key, t.state[key]))
+	}
+	t.Steps = append(t.Steps, TraceStep{Step: "input", Changes: changes})
+}
+
+// step records the changes the step made to the data
+func (t *Trace) step(step string, data map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	state := explainState(data)
+	var changes []string
+	for _, key := range sortedKeys(t.state) {
+		value, ok := state[key]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("- %s: %s", key, t.state[key]))
+		} else if value != t.state[key] {
+			changes = append(changes, fmt.Sprintf("~ %s: %s -> %s", key, t.state[key], value))
+		}
+	}
+	for _, key := range sortedKeys(state) {
+		if _, ok := t.state[key]; !ok {
+			changes = append(changes, fmt.Sprintf("+ %s: %s", key, state[key]))
+		}
+	}
+	t.state = state
+	if len(changes) > 0 {
+		t.Steps = append(t.Steps, TraceStep{Step: step, Changes: changes})
+	}
+}
+
+// sync updates the traced state without recording changes already traced per key
+func (t *Trace) sync(data map[string]interface{}) {
+	if t == nil {
+		return
+	}
+	t.state = explainState(data)
+}
+
+// note records a decision taken by a step, next to its changes when the step made any
+func (t *Trace) note(step string, format string, args ...interface{}) {
+	if t == nil {
+		return
+	}
+	change := "! " + fmt.Sprintf(format, args...)
+	if last := len(t.Steps) - 1; last >= 0 && t.Steps[last].Step == step {
+		t.Steps[last].Changes = append(t.Steps[last].Changes, change)
+		return
+	}
+	t.Steps = append(t.Steps, TraceStep{Step: step, Changes: []string{change}})
+}
+
+// key starts following a key through the key and value conversions
+func (t *Trace) key(k string, v interface{}) *keyTrace {
+	if t == nil {
+		return nil
+	}
+	return &keyTrace{trace: t, key: k, value: explainValue(v)}
+}
+
+// step records the key or value change made by the conversion
+func (kt *keyTrace) step(step string, k string, v interface{}) {
+	if kt == nil {
+		return
+	}
+	value := explainValue(v)
+	var changes []string
+	if k != kt.key {
+		changes = append(changes, fmt.Sprintf("~ key %s -> %s", kt.key, k))
+	}
+	if value != kt.value {
+		changes = append(changes, fmt.Sprintf("~ %s: %s -> %s", k, kt.value, value))
+	}
+	kt.key, kt.value = k, value
+	if len(changes) > 0 {
+		kt.trace.Steps = append(kt.trace.Steps, TraceStep{Step: step, Changes: changes})
+	}
+}
+
+// String renders the trace as readable text
+func (t *Trace) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %d (config %s, api %s)\n", t.Kind, t.ID, t.Config, t.API)
+	for _, step := range t.Steps {
+		fmt.Fprintf(&b, "  %s:\n", step.Step)
+		for _, change := range step.Changes {
+			fmt.Fprintf(&b, "    %s\n", change)
+		}
+	}
+	return b.String()
+}
+
+func explainState(data map[string]interface{}) map[string]string {
+	state := make(map[string]string, len(data))
+	for key, value := range data {
+		state[key] = explainValue(value)
+	}
+	return state
+}
+
+// explainValue renders a value as json so nested values and types are visible, eg. "1" vs 1
+func explainValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	value := string(b)
+	if err != nil {
+		value = fmt.Sprintf("%v", v)
+	}
+	if len(value) > explainValueLimit {
+		value = value[:explainValueLimit] + "..."
+	}
+	return value
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,62 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package processor
+
+import (
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestExplain(t *testing.T) {
+	load.Refresh()
+	defer load.Refresh()
+	i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+	load.Entity, _ = i.Entity("TestExplain", "nri-flex")
+
+	cfg := &load.Config{
+		Name: "explainConfig",
+		APIs: []load.API{
+			{
+				Name:                "explainAPI",
+				RenameKeys:          map[string]string{"^cnt$": "count"},
+				Math:                map[string]string{"double": "${count} * 2"},
+				SampleExcludeFilter: []map[string]string{{"name": "skip"}},
+			},
+		},
+	}
+	dataSets := []interface{}{
+		map[string]interface{}{"name": "keep", "cnt": 2},
+		map[string]interface{}{"name": "skip", "cnt": 3},
+	}
+
+	assert.Nil(t, newTrace(cfg, 0, "sample"))
+
+	StartExplain("explainConfig", "")
+	RunDataHandler(dataSets, &load.SamplesToMerge{}, 0, cfg, 0)
+	traces := StopExplain()
+
+	var samples []string
+	for _, trace := range traces {
+		if trace.Kind == "sample" {
+			samples = append(samples, trace.String())
+		}
+	}
+	require.Len(t, samples, 2)
+	assert.Contains(t, samples[0], "sample 1 (config explainConfig, api explainAPI)")
+	assert.Contains(t, samples[0], "~ key cnt -> count")
+	assert.Contains(t, samples[0], "+ double: 4")
+	assert.Contains(t, samples[1], "dropped by sample_exclude_filter")
+
+	StartExplain("explainConfig", "otherAPI")
+	RunDataHandler(dataSets, &load.SamplesToMerge{}, 0, cfg, 0)
+	assert.Empty(t, StopExplain())
+	assert.Nil(t, newTrace(cfg, 0, "sample"))
+}
@@ -0,0 +1,406 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/newrelic/nri-flex/internal/config"
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/outputs"
+	"github.com/sirupsen/logrus"
+)
+
+// daemonTick how often the daemon checks for configs that are due to run
+const daemonTick = time.Second
+
+// Daemon long running runtime, loads configs like the Default runtime
+// but keeps running them on their own interval
+type Daemon struct {
+	Default
+	watcher *configWatcher
+}
+
+// The Daemon runtime is only available when requested
+func (i *Daemon) isAvailable() bool {
+	return load.Args.Daemon
+}
+
+// Load the configs like the Default runtime and start watching them for changes
+func (i *Daemon) loadConfigs(configs *[]load.Config) error {
+	err := i.Default.loadConfigs(configs)
+	if err != nil {
+		return err
+	}
+	i.watcher = newConfigWatcher()
+	i.watcher.reload()
+	return nil
+}
+
+// scheduledConfig a config with its interval, next run time and the scheduled configs it depends on
+type scheduledConfig struct {
+	cfg       load.Config
+	interval  time.Duration
+	nextRun   time.Time
+	dependsOn []string
+}
+
+// RunDaemon loads the configs and runs them on their interval until SIGINT or SIGTERM is received,
+// configs are reloaded when their files change
+func RunDaemon(instance *Daemon) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	stop := make(chan struct{})
+	go func() {
+		sig := <-signals
+		log.WithFields(logrus.Fields{"signal": sig.String()}).Info("runtime.RunDaemon: stopping")
+		close(stop)
+	}()
+
+	return runDaemon(instance, stop)
+}
+
+func runDaemon(instance *Daemon, stop <-chan struct{}) error {
+	setStatusCounters()
+	load.StartTime = load.MakeTimestamp()
+
+	log.WithFields(logrus.Fields{
+		"version": load.IntegrationVersion,
+		"GOOS":    runtime.GOOS,
+		"GOARCH":  runtime.GOARCH,
+	}).Info(load.IntegrationName + " daemon")
+
+	if load.Args.StatusAddr != "" {
+		if err := outputs.StartStatusServer(load.Args.StatusAddr); err != nil {
+			return err
+		}
+	}
+
+	var configs []load.Config
+	err := instance.loadConfigs(&configs)
+	if err != nil {
+		return err
+	}
+
+	reloadInterval, err := time.ParseDuration(load.Args.ReloadInterval)
+	if err != nil {
+		return fmt.Errorf("runtime.RunDaemon: invalid reload interval: %v", err)
+	}
+	// checked once, the run timeout applies to every pass
+	if _, err := runTimeout(); err != nil {
+		return fmt.Errorf("runtime.RunDaemon: %v", err)
+	}
+
+	// stopping cancels the configs still running
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	startFixtures()
+	schedule := newSchedule(configs, time.Now())
+	if len(schedule) == 0 && reloadInterval <= 0 {
+		return fmt.Errorf("runtime.RunDaemon: no configs to schedule")
+	}
+	load.RunHealthFinished(time.Now())
+	load.RunHealthInterval(shortestInterval(schedule))
+
+	ticker := time.NewTicker(daemonTick)
+	defer ticker.Stop()
+
+	runs := newDaemonRuns()
+	run := func(ctx context.Context, cfg load.Config) {
+		runDaemonConfig(ctx, cfg)
+		publishDaemon(runs)
+	}
+
+	now := time.Now()
+	lastReload := now
+	for {
+		if reloadInterval > 0 && now.Sub(lastReload) >= reloadInterval {
+			lastReload = now
+			if configs, changed := instance.reloadConfigs(); changed {
+				schedule = reschedule(schedule, configs, now)
+				load.RunHealthInterval(shortestInterval(schedule))
+				log.WithFields(logrus.Fields{"configs": len(schedule)}).Info("runtime.RunDaemon: configs reloaded")
+			}
+		}
+		startDueConfigs(ctx, schedule, now, runs, run)
+		select {
+		case <-stop:
+			// the configs still running are cancelled, wait for them to publish what they collected
+			cancel()
+			runs.wait()
+			return nil
+		case now = <-ticker.C:
+		}
+	}
+}
+
+// newSchedule creates the schedule for the configs, all configs are due straight away,
+// the configs that depend on others wait for them to complete once
+func newSchedule(configs []load.Config, now time.Time) []*scheduledConfig {
+	var schedule []*scheduledConfig
+	for _, cfg := range configs {
+		interval, err := configInterval(cfg)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"name":     cfg.Name,
+				"file":     cfg.FileName,
+				"interval": cfg.Interval,
+			}).WithError(err).Error("runtime.RunDaemon: invalid interval, config will not be scheduled")
+			continue
+		}
+		log.WithFields(logrus.Fields{
+			"name":     cfg.Name,
+			"interval": interval.String(),
+		}).Debug("runtime.RunDaemon: scheduled config")
+		schedule = append(schedule, &scheduledConfig{cfg: cfg, interval: interval, nextRun: now})
+	}
+	return scheduleDependencies(schedule, now)
+}
+
+// scheduleDependencies sets the scheduled configs each config depends on,
+// the configs in a dependency cycle are never able to run and are not scheduled
+func scheduleDependencies(schedule []*scheduledConfig, now time.Time) []*scheduledConfig {
+	configs := make([]load.Config, len(schedule))
+	scheduled := map[string]bool{}
+	for i, s := range schedule {
+		configs[i] = s.cfg
+		scheduled[s.cfg.Name] = true
+	}
+	cyclic := map[int]bool{}
+	for _, i := range config.DependencyCycles(configs) {
+		cyclic[i] = true
+		err := fmt.Errorf("runtime.RunDaemon: %s: depends_on can't be satisfied because of a dependency cycle, config will not be scheduled", configs[i].Name)
+		load.ConfigStatusUpdate(configs[i], now, 0, err)
+		log.WithFields(logrus.Fields{
+			"name":       configs[i].Name,
+			"file":       configs[i].FileName,
+			"depends_on": configs[i].DependsOn,
+		}).Error("runtime.RunDaemon: dependency cycle, config will not be scheduled")
+	}
+
+	var acyclic []*scheduledConfig
+	for i, s := range schedule {
+		if cyclic[i] {
+			continue
+		}
+		for _, name := range s.cfg.DependsOn {
+			if scheduled[name] {
+				s.dependsOn = append(s.dependsOn, name)
+			}
+		}
+		acyclic = append(acyclic, s)
+	}
+	return acyclic
+}
+
+// configInterval returns the interval of the config, falling back to the daemon interval
+func configInterval(cfg load.Config) (time.Duration, error) {
+	interval := cfg.Interval
+	if interval == "" {
+		interval = load.Args.DaemonInterval
+	}
+	duration, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("interval must be greater than zero: %s", interval)
+	}
+	return duration, nil
+}
+
+// shortestInterval returns the shortest interval of the schedule, zero when it is empty
+func shortestInterval(schedule []*scheduledConfig) time.Duration {
+	var shortest time.Duration
+	for _, s := range schedule {
+		if shortest == 0 || s.interval < shortest {
+			shortest = s.interval
+		}
+	}
+	return shortest
+}
+
+// dueConfigs returns a fresh copy of the configs due to run and moves their next run forward,
+// runs that were missed while the daemon was busy are skipped. A config stays due until the configs
+// it depends on completed once, so on start a consumer doesn't race the configs it reads from
+func dueConfigs(schedule []*scheduledConfig, now time.Time, completed func(name string) bool) []load.Config {
+	var due []load.Config
+	for _, s := range schedule {
+		if now.Before(s.nextRun) || !dependenciesCompleted(s.dependsOn, completed) {
+			continue
+		}
+		due = append(due, cloneConfig(s.cfg))
+		for !now.Before(s.nextRun) {
+			s.nextRun = s.nextRun.Add(s.interval)
+		}
+	}
+	return due
+}
+
+func dependenciesCompleted(dependsOn []string, completed func(name string) bool) bool {
+	for _, name := range dependsOn {
+		if !completed(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// cloneConfig copies the stores that are modified while a config runs so each run starts clean
+func cloneConfig(cfg load.Config) load.Config {
+	clone := cfg
+	if cfg.Datastore != nil {
+		clone.Datastore = make(map[string][]interface{}, len(cfg.Datastore))
+		for k, v := range cfg.Datastore {
+			clone.Datastore[k] = v
+		}
+	}
+	if cfg.LookupStore != nil {
+		clone.LookupStore = make(map[string]map[string]struct{}, len(cfg.LookupStore))
+		for k, v := range cfg.LookupStore {
+			lookups := make(map[string]struct{}, len(v))
+			for lookup := range v {
+				lookups[lookup] = struct{}{}
+			}
+			clone.LookupStore[k] = lookups
+		}
+	}
+	if cfg.VariableStore != nil {
+		clone.VariableStore = make(map[string]string, len(cfg.VariableStore))
+		for k, v := range cfg.VariableStore {
+			clone.VariableStore[k] = v
+		}
+	}
+	return clone
+}
+
+// daemonRuns the configs running in the background, each config runs in its own goroutine
+// so a slow config doesn't hold back the others, and isn't started again while its previous run is in flight
+type daemonRuns struct {
+	sync.Mutex
+	wg        sync.WaitGroup
+	inFlight  map[string]bool
+	completed map[string]bool
+}
+
+func newDaemonRuns() *daemonRuns {
+	return &daemonRuns{inFlight: map[string]bool{}, completed: map[string]bool{}}
+}
+
+// start runs the config in the background, false when its previous run is still in flight
+func (r *daemonRuns) start(ctx context.Context, cfg load.Config, run func(context.Context, load.Config)) bool {
+	id := scheduleID(cfg)
+	r.Lock()
+	if r.inFlight[id] {
+		r.Unlock()
+		return false
+	}
+	r.inFlight[id] = true
+	r.wg.Add(1)
+	r.Unlock()
+
+	go func() {
+		defer func() {
+			r.Lock()
+			delete(r.inFlight, id)
+			r.completed[cfg.Name] = true
+			r.Unlock()
+			r.wg.Done()
+		}()
+		run(ctx, cfg)
+	}()
+	return true
+}
+
+// running returns the number of configs in flight
+func (r *daemonRuns) running() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.inFlight)
+}
+
+// completedOnce returns whether a config with the name completed a run
+func (r *daemonRuns) completedOnce(name string) bool {
+	r.Lock()
+	defer r.Unlock()
+	return r.completed[name]
+}
+
+// wait waits for the configs in flight to finish
+func (r *daemonRuns) wait() {
+	r.wg.Wait()
+}
+
+// startDueConfigs starts the configs due to run, the run of a config still in flight is skipped
+func startDueConfigs(ctx context.Context, schedule []*scheduledConfig, now time.Time, runs *daemonRuns, run func(context.Context, load.Config)) {
+	for _, cfg := range dueConfigs(schedule, now, runs.completedOnce) {
+		if !runs.start(ctx, cfg, run) {
+			log.WithFields(logrus.Fields{
+				"name": cfg.Name,
+				"file": cfg.FileName,
+			}).Warn("runtime.RunDaemon: previous run still in flight, skipping run")
+		}
+	}
+}
+
+// runDaemonConfig runs the config within the run timeout
+func runDaemonConfig(ctx context.Context, cfg load.Config) {
+	// the run timeout was checked when the daemon started
+	runCtx, cancel, _ := runContext(ctx)
+	defer cancel()
+
+	configs := []load.Config{cfg}
+	errors := config.RunFiles(runCtx, &configs)
+	for _, err := range errors {
+		log.WithError(err).Error("runtime.RunDaemon: failed to run configuration file")
+	}
+}
+
+// publishDaemon publishes the samples collected since the previous publish, including those of the configs
+// still running, the status sample covers the same period
+func publishDaemon(runs *daemonRuns) {
+	load.EntityLock.Lock()
+	defer load.EntityLock.Unlock()
+
+	// configs still running keep counting, taking the counters in one step loses none of their increments
+	outputs.StatusSample(load.StatusCounterReset())
+	outputs.StatsSamples()
+	sendOutputs()
+	load.MetricsStoreEmpty()
+
+	if err := load.Integration.Publish(); err != nil {
+		log.WithError(err).Error("runtime.RunDaemon: failed to publish")
+	}
+	// publishing clears the integration entities
+	if err := outputs.ResetEntity(); err != nil {
+		log.WithError(err).Error("runtime.RunDaemon: failed to reset entity")
+	}
+
+	load.StartTime = load.MakeTimestamp()
+	load.RunHealthFinished(time.Now())
+	// lookups of a running config can still need the ignored samples and fixtures, the publishing config is still in flight
+	if runs.running() <= 1 {
+		load.IgnoredIntegrationData = nil
+		startFixtures()
+	}
+}
@@ -0,0 +1,175 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package runtime
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigInterval(t *testing.T) {
+	load.Args.DaemonInterval = "30s"
+
+	interval, err := configInterval(load.Config{})
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, interval)
+
+	interval, err = configInterval(load.Config{Interval: "10m"})
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, interval)
+
+	_, err = configInterval(load.Config{Interval: "abc"})
+	assert.Error(t, err)
+
+	_, err = configInterval(load.Config{Interval: "0s"})
+	assert.Error(t, err)
+}
+
+func TestDueConfigs(t *testing.T) {
+	load.Args.DaemonInterval = "30s"
+	now := time.Now()
+	configs := []load.Config{
+		{Name: "fast", Interval: "15s"},
+		{Name: "slow", Interval: "10m"},
+		{Name: "default"},
+		{Name: "invalid", Interval: "-1s"},
+	}
+
+	schedule := newSchedule(configs, now)
+	require.Len(t, schedule, 3)
+
+	assert.Len(t, dueConfigs(schedule, now, nil), 3)
+	assert.Empty(t, dueConfigs(schedule, now.Add(10*time.Second), nil))
+
+	due := dueConfigs(schedule, now.Add(15*time.Second), nil)
+	require.Len(t, due, 1)
+	assert.Equal(t, "fast", due[0].Name)
+
+	// missed runs are skipped rather than run back to back
+	due = dueConfigs(schedule, now.Add(2*time.Minute), nil)
+	require.Len(t, due, 2)
+	assert.Empty(t, dueConfigs(schedule, now.Add(2*time.Minute+time.Second), nil))
+}
+
+func TestNewScheduleDependsOn(t *testing.T) {
+	load.Refresh()
+	load.Args.DaemonInterval = "30s"
+	schedule := newSchedule([]load.Config{
+		{Name: "consumer", DependsOn: []string{"producer", "notLoaded"}},
+		{Name: "producer"},
+		{Name: "self", DependsOn: []string{"self"}},
+	}, time.Now())
+
+	// configs in a dependency cycle are never able to run
+	require.Len(t, schedule, 2)
+	assert.Equal(t, []string{"producer"}, schedule[0].dependsOn)
+	assert.Empty(t, schedule[1].dependsOn)
+	var cycleError string
+	for _, status := range load.ConfigStatusRead() {
+		if status.Name == "self" {
+			cycleError = status.Error
+		}
+	}
+	assert.Contains(t, cycleError, "dependency cycle")
+}
+
+func TestCloneConfig(t *testing.T) {
+	cfg := load.Config{
+		Name:          "clone",
+		Datastore:     map[string][]interface{}{"a": {1}},
+		LookupStore:   map[string]map[string]struct{}{"b": {"c": {}}},
+		VariableStore: map[string]string{"d": "e"},
+	}
+
+	clone := cloneConfig(cfg)
+	clone.Datastore["x"] = []interface{}{2}
+	clone.LookupStore["b"]["y"] = struct{}{}
+	clone.VariableStore["z"] = "z"
+
+	assert.Len(t, cfg.Datastore, 1)
+	assert.Len(t, cfg.LookupStore["b"], 1)
+	assert.Len(t, cfg.VariableStore, 1)
+	assert.Equal(t, "clone", clone.Name)
+}
+
+func TestStartDueConfigsSlowConfig(t *testing.T) {
+	load.Args.DaemonInterval = "30s"
+	now := time.Now()
+	schedule := newSchedule([]load.Config{
+		{Name: "fast", Interval: "15s"},
+		{Name: "slow", Interval: "10m"},
+	}, now)
+
+	release := make(chan struct{})
+	fastRuns := make(chan struct{}, 10)
+	var slowRuns int32
+	run := func(ctx context.Context, cfg load.Config) {
+		if cfg.Name == "slow" {
+			atomic.AddInt32(&slowRuns, 1)
+			<-release
+			return
+		}
+		fastRuns <- struct{}{}
+	}
+
+	// the fast config keeps running on its interval while the slow config is in flight
+	runs := newDaemonRuns()
+	for tick := 0; tick < 3; tick++ {
+		startDueConfigs(context.Background(), schedule, now.Add(time.Duration(tick)*15*time.Second), runs, run)
+		select {
+		case <-fastRuns:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("fast config starved at tick %d", tick)
+		}
+	}
+
+	// the slow config isn't started again while its previous run is in flight
+	startDueConfigs(context.Background(), schedule, now.Add(10*time.Minute), runs, run)
+	<-fastRuns
+	close(release)
+	runs.wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slowRuns))
+	assert.Equal(t, 0, runs.running())
+}
+
+func TestStartDueConfigsDependsOn(t *testing.T) {
+	load.Args.DaemonInterval = "30s"
+	now := time.Now()
+	schedule := newSchedule([]load.Config{
+		{Name: "consumer", DependsOn: []string{"producer"}},
+		{Name: "producer"},
+	}, now)
+
+	release := make(chan struct{})
+	started := make(chan string, 10)
+	run := func(ctx context.Context, cfg load.Config) {
+		started <- cfg.Name
+		if cfg.Name == "producer" {
+			<-release
+		}
+	}
+
+	// on start the consumer waits for the producer to complete once
+	runs := newDaemonRuns()
+	startDueConfigs(context.Background(), schedule, now, runs, run)
+	assert.Equal(t, "producer", <-started)
+	startDueConfigs(context.Background(), schedule, now.Add(time.Second), runs, run)
+	close(release)
+	runs.wait()
+	assert.Empty(t, started)
+
+	// the consumer was kept due and runs on the next tick
+	startDueConfigs(context.Background(), schedule, now.Add(2*time.Second), runs, run)
+	runs.wait()
+	assert.Equal(t, "consumer", <-started)
+	assert.Empty(t, started)
+}
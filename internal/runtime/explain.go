@@ -0,0 +1,66 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/newrelic/nri-flex/internal/config"
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/newrelic/nri-flex/internal/processor"
+)
+
+// RunExplain runs the explained config and prints how its samples change through each processing step
+func RunExplain(instance Instance) error {
+	setStatusCounters()
+	startFixtures()
+
+	ctx, cancel, err := runContext(context.Background())
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	var configs []load.Config
+	if err := instance.loadConfigs(&configs); err != nil {
+		return err
+	}
+
+	var explained []load.Config
+	for _, cfg := range configs {
+		if cfg.Name == load.Args.ExplainConfig {
+			explained = append(explained, cfg)
+		}
+	}
+	if len(explained) == 0 {
+		return fmt.Errorf("explain: config %s not found", load.Args.ExplainConfig)
+	}
+
+	processor.StartExplain(load.Args.ExplainConfig, load.Args.ExplainAPI)
+	errors := config.RunFiles(ctx, &explained)
+	traces := processor.StopExplain()
+	if len(errors) > 0 {
+		return fmt.Errorf("explain: failed to run config %s", load.Args.ExplainConfig)
+	}
+
+	return writeTraces(os.Stdout, traces)
+}
+
+func writeTraces(w io.Writer, traces []*processor.Trace) error {
+	if len(traces) == 0 {
+		_, err := fmt.Fprintf(w, "no samples processed for config %s\n", load.Args.ExplainConfig)
+		return err
+	}
+	for _, trace := range traces {
+		if _, err := fmt.Fprintln(w, trace.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,6 +6,7 @@
 package runtime
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -13,8 +14,10 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/newrelic/nri-flex/internal/config"
+	"github.com/newrelic/nri-flex/internal/inputs"
 	"github.com/newrelic/nri-flex/internal/load"
 	"github.com/newrelic/nri-flex/internal/outputs"
 	"github.com/newrelic/nri-flex/internal/utils"
@@ -29,7 +32,7 @@ type Instance interface {
 }
 
 // Add new  runtime types to this  list. Test & Default don't go here
-var runtimeTypes = [2]Instance{new(Lambda), new(Function)}
+var runtimeTypes = [3]Instance{new(Lambda), new(Function), new(Daemon)}
 var log = load.Logrus
 
 // Get the first available runtime type, defaults to the server-based (Linux | Windows) Default type
@@ -75,6 +78,7 @@ func CommonPreInit() {
 // RunFlex Common run (once) function
 func RunFlex(instance Instance) error {
 	setStatusCounters()
+	startFixtures()
 
 	log.WithFields(logrus.Fields{
 		"version": load.IntegrationVersion,
@@ -82,21 +86,59 @@ func RunFlex(instance Instance) error {
 		"GOARCH":  runtime.GOARCH,
 	}).Info(load.IntegrationName)
 
+	ctx, cancel, err := runContext(context.Background())
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
 	var configs []load.Config
 
 	// runtime instance specific run
-	err := instance.loadConfigs(&configs)
+	err = instance.loadConfigs(&configs)
 	if err != nil {
 		return err
 	}
 
-	errors := config.RunFiles(&configs)
+	errors := config.RunFiles(ctx, &configs)
 	if len(errors) > 0 {
 		return fmt.Errorf("runtime.RunFlex: failed to run configuration files")
 	}
 
-	outputs.StatusSample()
+	outputs.StatusSample(load.StatusCounterSnapshot())
+	outputs.StatsSamples()
+	sendOutputs()
+	return nil
+}
+
+// runTimeout returns the run timeout, zero when disabled
+func runTimeout() (time.Duration, error) {
+	if load.Args.RunTimeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(load.Args.RunTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("runtime: invalid run timeout: %v", err)
+	}
+	return timeout, nil
+}
 
+// runContext returns the context of a run of the configs, cancelled after the run timeout when set
+func runContext(parent context.Context) (context.Context, context.CancelFunc, error) {
+	timeout, err := runTimeout()
+	if err != nil {
+		return nil, nil, err
+	}
+	if timeout <= 0 {
+		ctx, cancel := context.WithCancel(parent)
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	return ctx, cancel, nil
+}
+
+// sendOutputs sends the collected samples to insights or the metric api when configured
+func sendOutputs() {
 	if load.Args.InsightsURL != "" && load.Args.InsightsAPIKey != "" {
 		for _, batch := range outputs.GetMetricBatches() {
 			if err := outputs.SendBatchToInsights(batch); err != nil {
@@ -110,7 +152,6 @@ func RunFlex(instance Instance) error {
 	} else if len(load.MetricsStore.Data) > 0 && (load.Args.MetricAPIUrl == "" || (load.Args.InsightsAPIKey == "" || load.Args.MetricAPIKey == "")) {
 		log.Debug("runtime.RunFlex: metric_api is being used, but metric url and/or key has not been set")
 	}
-	return nil
 }
 
 func addSingleConfigFile(configFile string, configs *[]load.Config) error {
@@ -159,12 +200,19 @@ func logEncryptPass() error {
 	return nil
 }
 
+// startFixtures starts recording or replaying the raw output of the inputs when requested
+func startFixtures() {
+	if load.Args.RecordDir != "" {
+		inputs.StartRecord(load.Args.RecordDir)
+	}
+	if load.Args.ReplayDir != "" {
+		inputs.StartReplay(load.Args.ReplayDir)
+	}
+}
+
 func setStatusCounters() {
 	log.Out = os.Stderr
-	load.FlexStatusCounter.M = make(map[string]int)
-	load.FlexStatusCounter.M["EventCount"] = 0
-	load.FlexStatusCounter.M["EventDropCount"] = 0
-	load.FlexStatusCounter.M["ConfigsProcessed"] = 0
+	load.StatusCounterReset()
 }
 
 // setEnvs set environment variable argument overrides
@@ -0,0 +1,233 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/newrelic/nri-flex/internal/config"
+	"github.com/newrelic/nri-flex/internal/inputs"
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/sirupsen/logrus"
+)
+
+// volatileKeys attributes that change between runs or releases and are left out of golden files
+var volatileKeys = []string{"integration_version", "flex.commandTimeMs", "flex.QueryStartMs", "flex.QueryTimeMs"}
+
+// goldenOutput the samples and metric api metrics produced by the configs, as stored in golden files
+type goldenOutput struct {
+	Samples []map[string]interface{} `json:"samples"`
+	Metrics []load.Metrics           `json:"metrics,omitempty"`
+}
+
+// RunGolden runs the configs replaying the input fixtures, and compares the produced samples with the golden file
+// or regenerates it when updating
+func RunGolden(instance Instance) error {
+	setStatusCounters()
+
+	ctx, cancel, err := runContext(context.Background())
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	var configs []load.Config
+	if err := instance.loadConfigs(&configs); err != nil {
+		return err
+	}
+
+	fixturesDir := load.Args.FixturesDir
+	if fixturesDir == "" {
+		fixturesDir = filepath.Join(filepath.Dir(load.Args.GoldenFile), "fixtures")
+	}
+	inputs.StartReplay(fixturesDir)
+	defer inputs.StopReplay()
+
+	if errors := config.RunFiles(ctx, &configs); len(errors) > 0 {
+		return fmt.Errorf("golden: failed to run configuration files")
+	}
+
+	actual, err := marshalGolden(collectGolden())
+	if err != nil {
+		return err
+	}
+
+	if load.Args.Update {
+		if err := ioutil.WriteFile(load.Args.GoldenFile, actual, 0644); err != nil {
+			return fmt.Errorf("golden: failed to write %s: %v", load.Args.GoldenFile, err)
+		}
+		log.WithFields(logrus.Fields{"file": load.Args.GoldenFile}).Info("golden: updated")
+		return nil
+	}
+
+	expected, err := readGolden(load.Args.GoldenFile)
+	if err != nil {
+		return err
+	}
+	diff := diffLines(strings.Split(strings.TrimSpace(string(expected)), "\n"), strings.Split(strings.TrimSpace(string(actual)), "\n"))
+	if len(diff) > 0 {
+		fmt.Fprintf(os.Stdout, "--- %s\n+++ actual\n%s\n", load.Args.GoldenFile, strings.Join(diff, "\n"))
+		return fmt.Errorf("golden: output does not match %s", load.Args.GoldenFile)
+	}
+
+	log.WithFields(logrus.Fields{"file": load.Args.GoldenFile}).Info("golden: output matches")
+	return nil
+}
+
+// collectGolden collects the samples of every entity and the stored metric api metrics without volatile attributes
+func collectGolden() goldenOutput {
+	output := goldenOutput{Samples: []map[string]interface{}{}}
+	for _, entity := range load.Integration.Entities {
+		for _, metricSet := range entity.Metrics {
+			sample := map[string]interface{}{}
+			for key, value := range metricSet.Metrics {
+				sample[key] = value
+			}
+			for _, key := range volatileKeys {
+				delete(sample, key)
+			}
+			output.Samples = append(output.Samples, sample)
+		}
+	}
+
+	load.MetricsStore.RLock()
+	for _, metrics := range load.MetricsStore.Data {
+		metrics.TimestampMs = 0
+		metrics.IntervalMs = 0
+		output.Metrics = append(output.Metrics, metrics)
+	}
+	load.MetricsStore.RUnlock()
+
+	return output
+}
+
+// marshalGolden marshals the output in a stable order, samples are sorted so async runs compare equal
+func marshalGolden(output goldenOutput) ([]byte, error) {
+	sortByJSON := func(length int, item func(int) interface{}) ([]int, error) {
+		keys := make([]string, length)
+		order := make([]int, length)
+		for i := 0; i < length; i++ {
+			b, err := json.Marshal(item(i))
+			if err != nil {
+				return nil, fmt.Errorf("golden: failed to marshal output: %v", err)
+			}
+			keys[i] = string(b)
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool { return keys[order[a]] < keys[order[b]] })
+		return order, nil
+	}
+
+	order, err := sortByJSON(len(output.Samples), func(i int) interface{} { return output.Samples[i] })
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]map[string]interface{}, len(order))
+	for i, j := range order {
+		samples[i] = output.Samples[j]
+	}
+
+	order, err = sortByJSON(len(output.Metrics), func(i int) interface{} { return output.Metrics[i] })
+	if err != nil {
+		return nil, err
+	}
+	var metrics []load.Metrics
+	for _, j := range order {
+		metrics = append(metrics, output.Metrics[j])
+	}
+
+	b, err := json.MarshalIndent(goldenOutput{Samples: samples, Metrics: metrics}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("golden: failed to marshal output: %v", err)
+	}
+	return append(b, '\n'), nil
+}
+
+// readGolden reads the golden file and normalizes it the same way as the produced output
+func readGolden(file string) ([]byte, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("golden: failed to read %s: %v", file, err)
+	}
+	var output goldenOutput
+	if err := json.Unmarshal(b, &output); err != nil {
+		return nil, fmt.Errorf("golden: failed to parse %s: %v", file, err)
+	}
+	if output.Samples == nil {
+		output.Samples = []map[string]interface{}{}
+	}
+	return marshalGolden(output)
+}
+
+// diffLines returns the changed lines between expected and actual, with two lines of context around each change
+func diffLines(expected, actual []string) []string {
+	// longest common subsequence lengths of the remaining lines
+	lcs := make([][]int, len(expected)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(actual)+1)
+	}
+	for i := len(expected) - 1; i >= 0; i-- {
+		for j := len(actual) - 1; j >= 0; j-- {
+			if expected[i] == actual[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	var changed []bool
+	i, j := 0, 0
+	for i < len(expected) || j < len(actual) {
+		switch {
+		case i < len(expected) && j < len(actual) && expected[i] == actual[j]:
+			lines = append(lines, "  "+expected[i])
+			changed = append(changed, false)
+			i++
+			j++
+		case i < len(expected) && (j == len(actual) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "- "+expected[i])
+			changed = append(changed, true)
+			i++
+		default:
+			lines = append(lines, "+ "+actual[j])
+			changed = append(changed, true)
+			j++
+		}
+	}
+
+	const context = 2
+	var diff []string
+	last := -1
+	for n := range lines {
+		near := false
+		for c := n - context; c <= n+context; c++ {
+			if c >= 0 && c < len(changed) && changed[c] {
+				near = true
+				break
+			}
+		}
+		if !near {
+			continue
+		}
+		if last >= 0 && n > last+1 {
+			diff = append(diff, "...")
+		}
+		diff = append(diff, lines[n])
+		last = n
+	}
+	return diff
+}
@@ -0,0 +1,82 @@
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestRunGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golden")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "golden.yml")
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(`
+name: goldenTest
+apis:
+  - name: status
+    url: http://localhost:1/status
+  - name: uptime
+    commands:
+      - run: cat /proc/uptime
+        split_by: " "
+`), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "fixtures", "goldenTest"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "fixtures", "goldenTest", "status.json"), []byte(`{
+  "fixtures": [
+    {"input": "http", "key": "http://localhost:1/status", "headers": {"Content-Type": "application/json"}, "body": "{\"up\":true,\"connections\":5}"}
+  ]
+}`), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "fixtures", "goldenTest", "uptime.json"), []byte(`{
+  "fixtures": [
+    {"input": "command", "key": "cat /proc/uptime", "body": "uptime 350735.47"}
+  ]
+}`), 0644))
+
+	goldenFile := filepath.Join(dir, "golden.json")
+	load.Args.GoldenFile = goldenFile
+	defer func() {
+		load.Args.ConfigFile = ""
+		load.Args.GoldenFile = ""
+		load.Args.Update = false
+	}()
+
+	run := func() error {
+		load.Refresh()
+		load.Args.ConfigFile = configFile
+		i, _ := integration.New(load.IntegrationName, load.IntegrationVersion)
+		load.Integration = i
+		load.Entity, _ = i.Entity("TestRunGolden", "nri-flex")
+		return RunGolden(GetTestRuntime())
+	}
+
+	load.Args.Update = true
+	require.NoError(t, run())
+	golden, err := ioutil.ReadFile(goldenFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(golden), `"connections": 5`)
+	assert.Contains(t, string(golden), `"uptime": 350735.47`)
+	assert.NotContains(t, string(golden), "flex.commandTimeMs")
+
+	load.Args.Update = false
+	require.NoError(t, run())
+
+	require.NoError(t, ioutil.WriteFile(goldenFile, []byte(`{"samples": []}`), 0644))
+	assert.Error(t, run())
+}
+
+func TestDiffLines(t *testing.T) {
+	expected := []string{"{", "a", "b", "c", "d", "e", "f", "g", "}"}
+	actual := []string{"{", "a", "b", "c", "D", "e", "f", "g", "h", "}"}
+
+	assert.Empty(t, diffLines(expected, expected))
+	assert.Equal(t, []string{"  b", "  c", "- d", "+ D", "  e", "  f", "  g", "+ h", "  }"}, diffLines(expected, actual))
+}
@@ -0,0 +1,197 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/newrelic/nri-flex/internal/config"
+	"github.com/newrelic/nri-flex/internal/discovery"
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/sirupsen/logrus"
+)
+
+// fileState used to detect changes to a config file
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// configWatcher keeps the last good configs of each file watched by the daemon
+type configWatcher struct {
+	files   map[string]fileState
+	configs map[string][]load.Config
+}
+
+func newConfigWatcher() *configWatcher {
+	return &configWatcher{
+		files:   map[string]fileState{},
+		configs: map[string][]load.Config{},
+	}
+}
+
+// watchedFiles returns the state of every config file the daemon watches,
+// git synced configs are cloned within the config dir so are covered by it
+func watchedFiles() map[string]fileState {
+	files := map[string]fileState{}
+	if load.Args.ConfigFile != "" {
+		if info, err := os.Stat(load.Args.ConfigFile); err == nil {
+			files[filepath.Clean(load.Args.ConfigFile)] = fileState{info.ModTime(), info.Size()}
+		}
+	} else {
+		addWatchedDir(files, load.Args.ConfigDir)
+	}
+	if load.Args.ContainerDiscovery || load.Args.Fargate {
+		addWatchedDir(files, load.Args.ContainerDiscoveryDir)
+	}
+	return files
+}
+
+func addWatchedDir(files map[string]fileState, dir string) {
+	if dir == "" {
+		return
+	}
+	_ = filepath.Walk(filepath.FromSlash(dir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			// same folders skipped when loading configs
+			if strings.Contains(path, ".git") || strings.Contains(path, "nr-integrations") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(info.Name(), "yml") || strings.HasSuffix(info.Name(), "yaml") {
+			files[path] = fileState{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+}
+
+// isDiscoveryFile discovery files are templates applied by discovery.Run and not loaded directly
+func isDiscoveryFile(path string) bool {
+	if !load.Args.ContainerDiscovery && !load.Args.Fargate {
+		return false
+	}
+	dir := filepath.Clean(filepath.FromSlash(load.Args.ContainerDiscoveryDir))
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// reload loads the files that were added or changed since the last check and drops removed files.
+// A file that fails to load is rejected and its previous configs are kept.
+// Returns true if any watched file changed.
+func (w *configWatcher) reload() bool {
+	current := watchedFiles()
+	changed := false
+
+	for path, state := range current {
+		if previous, ok := w.files[path]; ok && previous == state {
+			continue
+		}
+		changed = true
+		w.files[path] = state
+		if isDiscoveryFile(path) {
+			continue
+		}
+
+		configs, err := loadWatchedFile(path)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"file":    path,
+				"running": len(w.configs[path]),
+			}).WithError(err).Error("runtime.Daemon: config rejected, keeping previous version")
+			continue
+		}
+		w.configs[path] = configs
+		log.WithFields(logrus.Fields{
+			"file":    path,
+			"configs": len(configs),
+		}).Info("runtime.Daemon: config loaded")
+	}
+
+	for path := range w.files {
+		if _, ok := current[path]; !ok {
+			changed = true
+			delete(w.files, path)
+			delete(w.configs, path)
+			log.WithFields(logrus.Fields{"file": path}).Info("runtime.Daemon: config removed")
+		}
+	}
+	return changed
+}
+
+// loadWatchedFile loads and checks the configs of a single file
+func loadWatchedFile(path string) ([]load.Config, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var configs []load.Config
+	if err := config.LoadFile(&configs, info, filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	for _, cfg := range configs {
+		if _, err := configInterval(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return configs, nil
+}
+
+// loaded returns the configs of all watched files, with container discovery applied
+func (w *configWatcher) loaded() []load.Config {
+	var paths []string
+	for path := range w.configs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var configs []load.Config
+	for _, path := range paths {
+		configs = append(configs, w.configs[path]...)
+	}
+	if load.Args.ContainerDiscovery || load.Args.Fargate {
+		discovery.Run(&configs)
+	}
+	return configs
+}
+
+// reloadConfigs syncs git configs and reloads changed files, returns the new configs if anything changed
+func (i *Daemon) reloadConfigs() ([]load.Config, bool) {
+	_, err := config.SyncGitConfigs("")
+	if err != nil {
+		log.WithError(err).Warn("runtime.Daemon: failed to sync git configs")
+	}
+	if !i.watcher.reload() {
+		return nil, false
+	}
+	return i.watcher.loaded(), true
+}
+
+// reschedule swaps the scheduled configs, keeping the next run of configs that already existed
+func reschedule(schedule []*scheduledConfig, configs []load.Config, now time.Time) []*scheduledConfig {
+	nextRuns := map[string]time.Time{}
+	for _, s := range schedule {
+		nextRuns[scheduleID(s.cfg)] = s.nextRun
+	}
+
+	updated := newSchedule(configs, now)
+	for _, s := range updated {
+		if nextRun, ok := nextRuns[scheduleID(s.cfg)]; ok && nextRun.Before(now.Add(s.interval)) {
+			s.nextRun = nextRun
+		}
+	}
+	return updated
+}
+
+func scheduleID(cfg load.Config) string {
+	return filepath.Join(cfg.FilePath, cfg.FileName) + ":" + cfg.Name
+}
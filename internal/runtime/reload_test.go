@@ -0,0 +1,91 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package runtime
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, path string, content string, modTime time.Time) {
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestConfigWatcherReload(t *testing.T) {
+	load.Refresh()
+	load.Args.DaemonInterval = "30s"
+	dir, err := ioutil.TempDir("", "flex-reload")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	load.Args.ConfigDir = dir
+	defer load.Refresh()
+
+	modTime := time.Now().Add(-time.Hour)
+	first := filepath.Join(dir, "first.yml")
+	second := filepath.Join(dir, "second.yml")
+	writeConfig(t, first, "name: first\napis:\n  - name: a\n", modTime)
+
+	w := newConfigWatcher()
+	require.True(t, w.reload())
+	configs := w.loaded()
+	require.Len(t, configs, 1)
+	assert.Equal(t, "first", configs[0].Name)
+	assert.False(t, w.reload())
+
+	// invalid yaml is rejected, the previous version keeps running
+	writeConfig(t, first, "name: [first\n", modTime.Add(time.Minute))
+	assert.True(t, w.reload())
+	configs = w.loaded()
+	require.Len(t, configs, 1)
+	assert.Equal(t, "first", configs[0].Name)
+
+	// an invalid interval is rejected as well
+	writeConfig(t, first, "name: first\ninterval: abc\napis:\n  - name: a\n", modTime.Add(2*time.Minute))
+	assert.True(t, w.reload())
+	require.Len(t, w.loaded(), 1)
+	assert.Equal(t, "", w.loaded()[0].Interval)
+
+	writeConfig(t, first, "name: firstFixed\ninterval: 1m\napis:\n  - name: a\n", modTime.Add(3*time.Minute))
+	writeConfig(t, second, "name: second\napis:\n  - name: b\n", modTime)
+	assert.True(t, w.reload())
+	configs = w.loaded()
+	require.Len(t, configs, 2)
+	assert.Equal(t, "firstFixed", configs[0].Name)
+	assert.Equal(t, "second", configs[1].Name)
+
+	require.NoError(t, os.Remove(second))
+	assert.True(t, w.reload())
+	require.Len(t, w.loaded(), 1)
+}
+
+func TestReschedule(t *testing.T) {
+	load.Args.DaemonInterval = "30s"
+	now := time.Now()
+	configs := []load.Config{
+		{Name: "kept", FileName: "kept.yml", Interval: "1m"},
+		{Name: "removed", FileName: "removed.yml"},
+	}
+	schedule := newSchedule(configs, now)
+	dueConfigs(schedule, now, nil)
+
+	later := now.Add(10 * time.Second)
+	schedule = reschedule(schedule, []load.Config{
+		{Name: "kept", FileName: "kept.yml", Interval: "1m"},
+		{Name: "added", FileName: "added.yml"},
+	}, later)
+
+	require.Len(t, schedule, 2)
+	assert.Equal(t, now.Add(time.Minute), schedule[0].nextRun)
+	assert.Equal(t, later, schedule[1].nextRun)
+}
@@ -0,0 +1,64 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+package runtime
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/newrelic/nri-flex/internal/config"
+	"github.com/newrelic/nri-flex/internal/load"
+	"github.com/sirupsen/logrus"
+)
+
+// RunValidate strictly loads and checks the config files without running them
+func RunValidate() error {
+	var configs []load.Config
+	var errors []error
+
+	if load.Args.ConfigFile != "" {
+		file, err := os.Stat(load.Args.ConfigFile)
+		if err != nil {
+			return fmt.Errorf("validate: failed to read %s: %v", load.Args.ConfigFile, err)
+		}
+		if err := config.LoadFile(&configs, file, filepath.Dir(load.Args.ConfigFile)); err != nil {
+			errors = append(errors, err)
+		}
+	} else {
+		errors = append(errors, validateDir(load.Args.ConfigDir, &configs)...)
+	}
+	if load.Args.ContainerDiscovery || load.Args.Fargate {
+		errors = append(errors, validateDir(load.Args.ContainerDiscoveryDir, &configs)...)
+	}
+
+	for _, cfg := range configs {
+		errors = append(errors, config.ValidateConfig(cfg)...)
+	}
+	for _, err := range errors {
+		log.WithError(err).Error("validate: invalid config")
+	}
+
+	log.WithFields(logrus.Fields{
+		"configs": len(configs),
+		"errors":  len(errors),
+	}).Info("validate: completed")
+
+	if len(errors) > 0 {
+		return fmt.Errorf("validate: %d error(s) found", len(errors))
+	}
+	return nil
+}
+
+func validateDir(dir string, configs *[]load.Config) []error {
+	configPath := filepath.FromSlash(dir)
+	files, err := ioutil.ReadDir(configPath)
+	if err != nil {
+		return []error{fmt.Errorf("validate: failed to read %s: %v", dir, err)}
+	}
+	return config.LoadFiles(configs, files, configPath)
+}
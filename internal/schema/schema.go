@@ -0,0 +1,211 @@
+/*
+* Copyright 2019 New Relic Corporation. All rights reserved.
+* SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package schema generates a JSON Schema for flex config files from the load config structs
+package schema
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+// Draft JSON Schema version generated
+const Draft = "http://json-schema.org/draft-07/schema#"
+
+// Enums known values of string fields, keyed by struct and field name
+var Enums = map[string][]string{
+	"Secret.Kind":               {"aws-kms", "vault", "local"},
+	"Secret.Type":               {"basic", "equal", "json"},
+	"ContainerDiscovery.Type":   {load.TypeContainer, load.Image},
+	"ContainerDiscovery.Mode":   {"contains", "prefix", "suffix", "regex"},
+	"ContainerDiscovery.IPMode": {load.Public, load.Private},
+	"Global.AuthType":           load.AuthTypes,
+	"API.AuthType":              load.AuthTypes,
+	"API.ResponseFormat":        load.ResponseFormats,
+	"API.Database":              {"postgres", "pg", "pq", "mssql", "sqlserver", "mysql", "mariadb", "hana", "go-hdb", "hdb", "vertica", "hpvertica"},
+	"API.Split":                 {"horizontal", load.TypeColumns},
+	"Command.Split":             {"horizontal", load.TypeColumns},
+	"Command.Output":            {"raw", load.Jmx, load.TypeJSON, load.TypeXML, load.TypeCSV},
+	"Command.Network":           {"tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "unix"},
+	"Filter.Mode":               {"regex", "contains", "prefix", "suffix"},
+	"MetricParser.Mode":         {"regex", "contains", "prefix", "suffix"},
+	"Parse.Type":                {"contains", "match", "hasPrefix", "regex"},
+}
+
+// Comments parses the go source file and returns the comments of struct fields keyed by struct and field name,
+// the comments of the structs themselves are keyed by struct name
+func Comments(filename string) (map[string]string, error) {
+	file, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("schema: failed to parse %s: %v", filename, err)
+	}
+
+	comments := map[string]string{}
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+			doc := typeSpec.Doc
+			if doc == nil {
+				doc = genDecl.Doc
+			}
+			if text := commentText(doc); text != "" {
+				comments[typeSpec.Name.Name] = text
+			}
+			structComments(comments, typeSpec.Name.Name, structType)
+		}
+	}
+	return comments, nil
+}
+
+// structComments stores the field comments of a struct, anonymous structs are keyed by their field path
+func structComments(comments map[string]string, prefix string, structType *ast.StructType) {
+	for _, field := range structType.Fields.List {
+		text := commentText(field.Comment)
+		if text == "" {
+			text = commentText(field.Doc)
+		}
+		for _, name := range field.Names {
+			if text != "" {
+				comments[prefix+"."+name.Name] = text
+			}
+			if nested, ok := field.Type.(*ast.StructType); ok {
+				structComments(comments, prefix+"."+name.Name, nested)
+			}
+		}
+	}
+}
+
+func commentText(group *ast.CommentGroup) string {
+	if group == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(group.Text()), " ")
+}
+
+// Generator builds the JSON Schema of a struct and every struct it references
+type Generator struct {
+	Comments    map[string]string
+	Enums       map[string][]string
+	definitions map[string]interface{}
+}
+
+// NewGenerator creates a generator using the given field comments as descriptions
+func NewGenerator(comments map[string]string) *Generator {
+	return &Generator{
+		Comments:    comments,
+		Enums:       Enums,
+		definitions: map[string]interface{}{},
+	}
+}
+
+// Generate returns the schema of a flex config file, either a flex config or a v4 integrations file with flex configs
+func (g *Generator) Generate() map[string]interface{} {
+	config := g.schema(reflect.TypeOf(load.Config{}), "")
+	agentConfig := g.schema(reflect.TypeOf(load.AgentConfig{}), "")
+
+	// the agent accepts more keys next to the integration config, eg. interval, env, inventory_source
+	g.definitions["ConfigEntry"].(map[string]interface{})["additionalProperties"] = true
+
+	return map[string]interface{}{
+		"$schema":     Draft,
+		"title":       "New Relic Flex config",
+		"anyOf":       []interface{}{config, agentConfig},
+		"definitions": g.definitions,
+	}
+}
+
+// schema returns the schema of a type, named structs are added to the definitions and referenced
+func (g *Generator) schema(t reflect.Type, path string) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem(), path)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem(), path)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t, path)
+		}
+		if _, ok := g.definitions[t.Name()]; !ok {
+			// reserve the definition first, structs can reference themselves eg. Secret.HTTP
+			g.definitions[t.Name()] = map[string]interface{}{}
+			g.definitions[t.Name()] = g.structSchema(t, t.Name())
+		}
+		return map[string]interface{}{"$ref": "#/definitions/" + t.Name()}
+	default:
+		// interface{} accepts any value
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema returns the object schema of a struct using the same keys as the yaml decoder
+func (g *Generator) structSchema(t reflect.Type, path string) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object"}
+	if description := g.Comments[path]; description != "" {
+		schema["description"] = description
+	}
+	if t.NumField() == 0 {
+		return schema
+	}
+
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(field.Name)
+		}
+
+		fieldPath := path + "." + field.Name
+		property := g.schema(field.Type, fieldPath)
+		if description := g.Comments[fieldPath]; description != "" && property["description"] == nil {
+			if _, ref := property["$ref"]; ref {
+				// keywords next to $ref are ignored in draft-07, so wrap the reference
+				property = map[string]interface{}{"allOf": []interface{}{property}}
+			}
+			property["description"] = description
+		}
+		if values, ok := g.Enums[fieldPath]; ok {
+			property["enum"] = values
+		}
+		properties[key] = property
+	}
+	schema["properties"] = properties
+	schema["additionalProperties"] = false
+	return schema
+}
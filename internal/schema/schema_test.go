@@ -0,0 +1,67 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/newrelic/nri-flex/internal/load"
+)
+
+func TestComments(t *testing.T) {
+	comments, err := Comments("../load/load.go")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Pagination handles request pagination", comments["Pagination"])
+	assert.Equal(t, "only run every N executions", comments["API.RunEvery"])
+	assert.Equal(t, "log open related errors", comments["API.Logging.Open"])
+	assert.Contains(t, comments["Namespace.CustomAttr"], "set your own custom namespace attribute")
+}
+
+func TestGenerate(t *testing.T) {
+	comments, err := Comments("../load/load.go")
+	require.NoError(t, err)
+
+	out, err := json.Marshal(NewGenerator(comments).Generate())
+	require.NoError(t, err)
+
+	var doc struct {
+		Definitions map[string]struct {
+			Properties           map[string]map[string]interface{}
+			AdditionalProperties interface{}
+		}
+	}
+	require.NoError(t, json.Unmarshal(out, &doc))
+
+	config := doc.Definitions["Config"]
+	assert.Equal(t, false, config.AdditionalProperties)
+	assert.Equal(t, map[string]interface{}{"type": "string"}, config.Properties["name"])
+	assert.Equal(t, "#/definitions/API", config.Properties["apis"]["items"].(map[string]interface{})["$ref"])
+	assert.Equal(t, true, doc.Definitions["ConfigEntry"].AdditionalProperties)
+
+	api := doc.Definitions["API"]
+	assert.Equal(t, "integer", api.Properties["run_every"]["type"])
+	assert.Equal(t, "only run every N executions", api.Properties["run_every"]["description"])
+	assert.Equal(t, []interface{}{"horizontal", "columns"}, api.Properties["split"]["enum"])
+	assert.Contains(t, api.Properties, "user")
+	assert.Contains(t, api.Properties, "ignorelines")
+	assert.Equal(t, "object", api.Properties["logging"]["type"])
+
+	pagination := api.Properties["pagination"]
+	assert.Equal(t, "#/definitions/Pagination", pagination["$ref"])
+
+	command := doc.Definitions["Command"]
+	assert.Contains(t, command.Properties["output"]["enum"], "jmx")
+	assert.Equal(t, []interface{}{"aws-kms", "vault", "local"}, doc.Definitions["Secret"].Properties["kind"]["enum"])
+	assert.Equal(t, "#/definitions/API", doc.Definitions["Secret"].Properties["http"]["$ref"])
+	assert.Contains(t, doc.Definitions, "Prometheus")
+
+	// the enums of the validated fields come from the validator
+	authTypes := []interface{}{"basic", "digest", "ntlm"}
+	assert.Equal(t, authTypes, api.Properties["auth_type"]["enum"])
+	assert.Equal(t, authTypes, doc.Definitions["Global"].Properties["auth_type"]["enum"])
+	assert.Len(t, api.Properties["response_format"]["enum"], len(load.ResponseFormats))
+	assert.Contains(t, api.Properties["response_format"]["enum"], "ndjson")
+}